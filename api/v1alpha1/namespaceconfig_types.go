@@ -18,11 +18,15 @@ package v1alpha1
 
 import (
 	"fmt"
-	"regexp"
+	"slices"
 
 	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,16 +36,134 @@ import (
 type NamespaceConfigSpec struct {
 	config.CommonSpec `json:",inline"`
 	Selector          NamespaceSelector `json:"selector,omitempty"`
+
+	// ResourceQuotas are created in every selected namespace.
+	// They are updated when the spec changes and deleted when they are removed from the spec,
+	// when the namespace stops matching or when the NamespaceConfig is deleted.
+	// +optional
+	ResourceQuotas []ResourceQuotaTemplate `json:"resourceQuotas,omitempty"`
+
+	// LimitRanges are created in every selected namespace, they set the default requests and limits of containers.
+	// They are set back when edited and deleted when they are removed from the spec,
+	// when the namespace stops matching or when the NamespaceConfig is deleted.
+	// +optional
+	LimitRanges []LimitRangeTemplate `json:"limitRanges,omitempty"`
+
+	// NetworkPolicies are created in every selected namespace, for example to deny ingress from other namespaces.
+	// They are set back when edited and deleted when they are removed from the spec,
+	// when the namespace stops matching or when the NamespaceConfig is deleted.
+	// +optional
+	NetworkPolicies []NetworkPolicyTemplate `json:"networkPolicies,omitempty"`
+
+	// RoleBindings are created in every selected namespace.
+	// The names and namespaces of their subjects can be templated from the namespace,
+	// for example {{ .Labels.team }}-admins. A binding is deleted when it is removed from the spec,
+	// when the namespace stops matching or when the NamespaceConfig is deleted, which removes the access it granted.
+	// +optional
+	RoleBindings []RoleBindingTemplate `json:"roleBindings,omitempty"`
+
+	// Resources are manifests of any namespaced kind created in every selected namespace,
+	// such as ConfigMaps, ServiceAccounts, Roles or the custom resources of other operators.
+	// The namespace of each manifest is set to the selected namespace.
+	// An object is deleted when its manifest is removed from the spec,
+	// when the namespace stops matching or when the NamespaceConfig is deleted.
+	// +optional
+	Resources []ResourceTemplate `json:"resources,omitempty"`
+}
+
+// ResourceQuotaTemplate is a ResourceQuota created in each selected namespace
+type ResourceQuotaTemplate struct {
+	// Name of the ResourceQuota in each namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Spec of the ResourceQuota
+	Spec corev1.ResourceQuotaSpec `json:"spec"`
+}
+
+// LimitRangeTemplate is a LimitRange created in each selected namespace
+type LimitRangeTemplate struct {
+	// Name of the LimitRange in each namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Spec of the LimitRange
+	Spec corev1.LimitRangeSpec `json:"spec"`
+}
+
+// NetworkPolicyTemplate is a NetworkPolicy created in each selected namespace
+type NetworkPolicyTemplate struct {
+	// Name of the NetworkPolicy in each namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Spec of the NetworkPolicy
+	Spec networkingv1.NetworkPolicySpec `json:"spec"`
+}
+
+// RoleBindingTemplate is a RoleBinding created in each selected namespace
+type RoleBindingTemplate struct {
+	// Name of the RoleBinding in each namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// RoleRef is the Role or ClusterRole bound in each namespace.
+	// It cannot be changed once the binding exists, a binding with a new role needs a new name.
+	RoleRef rbacv1.RoleRef `json:"roleRef"`
+	// Subjects bound to the role. Their names and namespaces may be templates,
+	// a subject that fails to render is left out of the binding until it renders again.
+	// +kubebuilder:validation:MinItems=1
+	Subjects []rbacv1.Subject `json:"subjects"`
+}
+
+// ResourceTemplate is an object created in each selected namespace
+type ResourceTemplate struct {
+	// Template renders the string values of the manifest from the namespace, for example {{ .Name }} or {{ .Labels.team }}.
+	// Without it the manifest is applied as written.
+	// +optional
+	Template bool `json:"template,omitempty"`
+	// Manifest of the object
+	Manifest ResourceManifest `json:"manifest"`
+}
+
+// ResourceManifest is the manifest of an object created in each selected namespace
+// It must set apiVersion, kind and metadata.name. The manifest is not validated as an object when the
+// NamespaceConfig is created, so label values can be templates; a manifest that does not render is reported per namespace.
+// +kubebuilder:pruning:PreserveUnknownFields
+// +kubebuilder:validation:Type=object
+type ResourceManifest struct {
+	runtime.RawExtension `json:",inline"`
 }
 
 // NamespaceConfigStatus defines the observed state of NamespaceConfig
 type NamespaceConfigStatus struct {
 	config.CommonStatus `json:",inline"`
+	// ManagedObjects are the objects the NamespaceConfig has created in its namespaces and the result of the last apply.
+	// Objects are deleted once they are no longer set for their namespace.
+	// +optional
+	ManagedObjects []ManagedObjectStatus `json:"managedObjects,omitempty"`
+}
+
+// ManagedObjectStatus is an object created by a NamespaceConfig in one of its namespaces
+type ManagedObjectStatus struct {
+	// Namespace the object is in
+	Namespace string `json:"namespace"`
+	// APIVersion of the object
+	APIVersion string `json:"apiVersion"`
+	// Kind of the object
+	Kind string `json:"kind"`
+	// Name of the object
+	Name string `json:"name"`
+	// Result of the last apply or delete, Applied or Failed
+	Result string `json:"result"`
+	// LastError is the error returned by the last failed apply or delete
+	// +optional
+	LastError string `json:"lastError,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Matched",type=integer,JSONPath=".status.matchedCount"
+// +kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=".status.appliedCount"
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=".status.failedCount"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
 
 // NamespaceConfig is the Schema for the namespaceconfigs API
 type NamespaceConfig struct {
@@ -66,22 +188,45 @@ func init() {
 }
 
 type NamespaceSelector struct {
+	// NamespaceSelector is a map of namespace labels to select namespaces
+	// Selector can be provided a plain string or a regex.
+	// If no selector is provided, all namespaces will be selected
 	NamespaceSelector map[string]string `json:"namespaceSelector,omitempty"`
+	// MatchExpressions is a list of label requirements that must all match.
+	// They are evaluated in addition to NamespaceSelector.
+	// +optional
+	MatchExpressions []config.SelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// Validate returns an error for each regex in the selector that does not compile
+func (s NamespaceSelector) Validate() error {
+	return config.ValidateSelector(s.NamespaceSelector, s.MatchExpressions)
+}
+
+// Matches returns true if the namespace satisfies the NamespaceSelector map and every match expression
+func (s NamespaceSelector) Matches(obj *corev1.Namespace) bool {
+	return config.MatchRegexMap(s.NamespaceSelector, obj.Labels) && config.MatchExpressions(s.MatchExpressions, obj.Labels)
 }
 
 func (nc *NamespaceConfig) RemoveFinalizer() {
 	config.RemoveFinalizer(&nc.ObjectMeta)
 }
 
-// Cleanup removes all labels, annotations, and taints from the NamespaceConfig
-// When passed to NodeUpdate, it will remove all labels, annotations, and taints from the node
+// Cleanup removes all labels, annotations, and objects from the NamespaceConfig
+// When passed to Update, it will remove all labels, annotations, and objects from the namespace
 func (c *NamespaceConfig) Cleanup() {
 	c.Spec.Labels = make(map[string]string)
 	c.Spec.Annotations = make(map[string]string)
+	c.Spec.ResourceQuotas = nil
+	c.Spec.LimitRanges = nil
+	c.Spec.NetworkPolicies = nil
+	c.Spec.RoleBindings = nil
+	c.Spec.Resources = nil
+	c.Spec.CleanupEnforcement()
 }
 
-// GetLabelSet compares the labels in the NamespaceConfig with the labels in the appliedLabels status
-// and returns a map of labels that need to be applied to the nodes.
+// GetLabelSet returns the labels owned by the NamespaceConfig.
+// Labels removed from the spec are dropped by server-side apply, so no removal markers are needed.
 func (c *NamespaceConfig) GetLabelSet() map[string]string {
 
 	// If the labels are nil, create a new map
@@ -89,7 +234,7 @@ func (c *NamespaceConfig) GetLabelSet() map[string]string {
 		c.Spec.Labels = make(map[string]string)
 	}
 
-	return config.ProcessMap(c.Spec.Labels, c.Status.AppliedLabels)
+	return c.Spec.Labels
 }
 
 // These two are basically identical, so we should replace them with a single function
@@ -100,22 +245,19 @@ func (nc *NamespaceConfig) GetAnnotationSet() map[string]string {
 		nc.Spec.Annotations = make(map[string]string)
 	}
 
-	return config.ProcessMap(nc.Spec.Annotations, nc.Status.AppliedAnnotations)
+	return nc.Spec.Annotations
 }
 
 func (c *NamespaceConfig) ErrorStatus() {
 	c.Status.AppliedLabels = c.Spec.Labels
 	c.Status.AppliedAnnotations = c.Spec.Annotations
-	c.Status.Conditions = []metav1.Condition{
-		{
-			Type:               "Applied",
-			Status:             metav1.ConditionFalse,
-			Reason:             "NamespaceConfigError",
-			Message:            fmt.Sprintf("%s MalFormed NamespaceConfig", fmt.Sprintf("%s/%s", c.Namespace, c.Name)),
-			LastTransitionTime: metav1.Now(),
-			ObservedGeneration: c.Generation,
-		},
-	}
+	meta.SetStatusCondition(&c.Status.Conditions, metav1.Condition{
+		Type:               "Applied",
+		Status:             metav1.ConditionFalse,
+		Reason:             "NamespaceConfigError",
+		Message:            fmt.Sprintf("%s MalFormed NamespaceConfig", fmt.Sprintf("%s/%s", c.Namespace, c.Name)),
+		ObservedGeneration: c.Generation,
+	})
 }
 
 func (c *NamespaceConfig) UpdateStatus() {
@@ -125,38 +267,95 @@ func (c *NamespaceConfig) UpdateStatus() {
 
 	c.Status.AppliedLabels = c.Spec.Labels
 	c.Status.AppliedAnnotations = c.Spec.Annotations
-	c.Status.Conditions = []metav1.Condition{
-		{
+
+	// Audit configs never change their namespaces, the result is reported by the Compliant condition
+	if c.Spec.Audits() {
+		c.Status.AppliedLabels = nil
+		c.Status.AppliedAnnotations = nil
+		meta.RemoveStatusCondition(&c.Status.Conditions, "Applied")
+		return
+	}
+
+	// The Applied condition is only true when every selected object was updated
+	if c.Status.FailedCount > 0 {
+		meta.SetStatusCondition(&c.Status.Conditions, metav1.Condition{
 			Type:               "Applied",
-			Status:             metav1.ConditionTrue,
-			Reason:             "NamespaceConfigReady",
-			Message:            fmt.Sprintf("%s Applied", fmt.Sprintf("%s/%s", c.Namespace, c.Name)),
-			LastTransitionTime: metav1.Now(),
+			Status:             metav1.ConditionFalse,
+			Reason:             "NamespaceConfigApplyFailed",
+			Message:            fmt.Sprintf("%s failed on %d of %d namespaces", fmt.Sprintf("%s/%s", c.Namespace, c.Name), c.Status.FailedCount, c.Status.MatchedCount),
 			ObservedGeneration: c.Generation,
-		},
+		})
+		return
 	}
+
+	meta.SetStatusCondition(&c.Status.Conditions, metav1.Condition{
+		Type:               "Applied",
+		Status:             metav1.ConditionTrue,
+		Reason:             "NamespaceConfigReady",
+		Message:            fmt.Sprintf("%s Applied", fmt.Sprintf("%s/%s", c.Namespace, c.Name)),
+		ObservedGeneration: c.Generation,
+	})
 }
 
-// Match checks if the node matches all selectors in the NamespaceConfig
-func (nc *NamespaceConfig) Match(obj *corev1.Namespace) bool {
+// GetPriority returns the priority used to order NamespaceConfigs that select the same namespace
+func (nc *NamespaceConfig) GetPriority() int32 {
+	return nc.Spec.Priority
+}
 
-	if nc.Spec.Selector.NamespaceSelector == nil {
+// ConflictStatus sets the Conflict condition for keys lost to higher priority NamespaceConfigs
+func (nc *NamespaceConfig) ConflictStatus(conflicts []config.Conflict) {
+	config.SetConflictCondition(&nc.Status.Conditions, conflicts, nc.Generation)
+}
+
+// Competes returns true if other sets any of the same labels or annotations as the NamespaceConfig,
+// or the NamespaceConfig has already lost keys to another config
+func (nc *NamespaceConfig) Competes(other *NamespaceConfig) bool {
+	if meta.IsStatusConditionTrue(nc.Status.Conditions, config.ConditionConflict) {
 		return true
 	}
 
-	for SelectorKey, SelectorValue := range nc.Spec.Selector.NamespaceSelector {
+	return config.SharesKeys(nc.Spec.Labels, other.Spec.Labels) || config.SharesKeys(nc.Spec.Annotations, other.Spec.Annotations)
+}
+
+// TemplatesValues reports whether the label and annotation values of the NamespaceConfig are templates
+func (nc *NamespaceConfig) TemplatesValues() bool {
+	return nc.Spec.TemplateValues
+}
 
-		//  All Selector Labels must match
-		if _, exists := obj.Labels[SelectorKey]; !exists {
-			return false
-		}
+// Captures returns the named capture groups of the selector regexes matched against the namespace
+// They are used to render templated label and annotation values
+func (nc *NamespaceConfig) Captures(object metav1.Object) map[string]string {
+	captures := make(map[string]string)
 
-		if match, err := regexp.MatchString(SelectorValue, obj.Labels[SelectorKey]); err != nil || !match {
-			// If the regex does not match, return false
-			return false
+	config.CaptureRegexMap(nc.Spec.Selector.NamespaceSelector, object.GetLabels(), captures)
+	config.CaptureExpressions(nc.Spec.Selector.MatchExpressions, object.GetLabels(), captures)
 
+	return captures
+}
+
+// Match checks if the namespace matches all selectors in the NamespaceConfig
+func (nc *NamespaceConfig) Match(obj *corev1.Namespace) bool {
+	return nc.Spec.Selector.Matches(obj)
+}
+
+// ManagedObjectsIn returns the objects the NamespaceConfig has created in the named namespace
+func (nc *NamespaceConfig) ManagedObjectsIn(namespace string) []ManagedObjectStatus {
+	var objects []ManagedObjectStatus
+	for _, object := range nc.Status.ManagedObjects {
+		if object.Namespace == namespace {
+			objects = append(objects, object)
 		}
 	}
+	return objects
+}
 
-	return true
+// ManagedNamespaces returns the namespaces the NamespaceConfig has created objects in
+func (nc *NamespaceConfig) ManagedNamespaces() []string {
+	var namespaces []string
+	for _, object := range nc.Status.ManagedObjects {
+		if !slices.Contains(namespaces, object.Namespace) {
+			namespaces = append(namespaces, object.Namespace)
+		}
+	}
+	return namespaces
 }
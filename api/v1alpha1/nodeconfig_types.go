@@ -17,13 +17,18 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
+	"slices"
+	"time"
 
 	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // https://book.kubebuilder.io/reference/markers/crd-validation
@@ -34,12 +39,155 @@ type NodeConfigSpec struct {
 	config.CommonSpec `json:",inline"`
 
 	// Taints to Apply to Selected Nodes, If no selector is provided, all nodes will be selected
+	// A taint is identified by its key and effect, so the same key may be set with several effects.
+	// +listType=map
+	// +listMapKey=key
+	// +listMapKey=effect
 	// +optional
 	Taints []corev1.Taint `json:"taints,omitempty"`
 
 	// NodeSelector is a map of node labels to select nodes
 	// +optional
 	Selector NodeSelector `json:"selector"`
+
+	// Unschedulable cordons the selected nodes
+	// +optional
+	Unschedulable bool `json:"unschedulable,omitempty"`
+
+	// Drain evicts the pods from the selected nodes. Drained nodes are always cordoned.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+
+	// Rollout applies changes to the selected nodes in batches rather than all at once
+	// +optional
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
+}
+
+// RolloutStrategy controls how quickly a NodeConfig change rolls through the selected nodes.
+// Nodes are updated in batches ordered by name, a new rollout starts whenever the NodeConfig changes.
+type RolloutStrategy struct {
+	// MaxUnavailable is the number or percentage of selected nodes updated in each batch, defaults to 1
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Pause is how long to wait after a batch before starting the next one
+	// +optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
+	// ReadinessGate waits for every updated node to report Ready before starting the next batch
+	// +optional
+	ReadinessGate bool `json:"readinessGate,omitempty"`
+}
+
+// GetBatchSize returns the number of nodes updated in each batch out of total selected nodes
+// Percentages are rounded down and every batch updates at least one node
+func (r *RolloutStrategy) GetBatchSize(total int) int {
+	maxUnavailable := intstr.FromInt32(1)
+	if r.MaxUnavailable != nil {
+		maxUnavailable = *r.MaxUnavailable
+	}
+
+	size, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, total, false)
+	if err != nil || size < 1 {
+		return 1
+	}
+	return size
+}
+
+// GetPause returns the pause between batches
+func (r *RolloutStrategy) GetPause() time.Duration {
+	if r.Pause == nil {
+		return 0
+	}
+	return r.Pause.Duration
+}
+
+// RolloutPhase is the progress of a NodeConfig rollout
+type RolloutPhase string
+
+const (
+	// RolloutPhaseProgressing is set while selected nodes are waiting for their batch
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhaseComplete is set once every selected node has been updated
+	RolloutPhaseComplete RolloutPhase = "Complete"
+)
+
+// RolloutStatus is the progress of rolling the current NodeConfig generation through the selected nodes
+type RolloutStatus struct {
+	// ObservedGeneration is the NodeConfig generation being rolled out
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// Phase is Progressing or Complete
+	Phase RolloutPhase `json:"phase"`
+	// UpdatedNodes are the nodes the current generation has been applied to
+	// +optional
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+	// UpdatedCount is the number of selected nodes that have been updated
+	UpdatedCount int32 `json:"updatedCount"`
+	// PendingCount is the number of selected nodes waiting for their batch
+	PendingCount int32 `json:"pendingCount"`
+	// LastBatchTime is when the last batch was started
+	// +optional
+	LastBatchTime *metav1.Time `json:"lastBatchTime,omitempty"`
+	// Message describes what the rollout is waiting for
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DefaultDrainTimeout is used when a DrainSpec does not set a timeout
+const DefaultDrainTimeout = 10 * time.Minute
+
+// DrainSpec configures how pods are evicted from the selected nodes.
+// Pods are evicted through the Eviction API so PodDisruptionBudgets are honored.
+// DaemonSet and mirror pods are never evicted.
+type DrainSpec struct {
+	// GracePeriodSeconds overrides the termination grace period of evicted pods
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	// Timeout is how long a node may take to drain before it is reported as TimedOut, defaults to 10m.
+	// A timed out drain is not retried until the NodeConfig changes.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// GetTimeout returns the drain timeout or DefaultDrainTimeout if none is set
+func (d *DrainSpec) GetTimeout() time.Duration {
+	if d.Timeout == nil || d.Timeout.Duration <= 0 {
+		return DefaultDrainTimeout
+	}
+	return d.Timeout.Duration
+}
+
+// DrainPhase is the progress of draining a single node
+type DrainPhase string
+
+const (
+	// DrainPhaseDraining is set while pods remain on the node
+	DrainPhaseDraining DrainPhase = "Draining"
+	// DrainPhaseDrained is set once every evictable pod has left the node
+	DrainPhaseDrained DrainPhase = "Drained"
+	// DrainPhaseTimedOut is set when pods remain on the node after the drain timeout
+	DrainPhaseTimedOut DrainPhase = "TimedOut"
+)
+
+// NodeDrainStatus is the drain progress of a single node
+type NodeDrainStatus struct {
+	// Node is the name of the node being drained
+	Node string `json:"node"`
+	// Phase is one of Draining, Drained or TimedOut
+	Phase DrainPhase `json:"phase"`
+	// PodsRemaining is the number of evictable pods still on the node
+	PodsRemaining int32 `json:"podsRemaining"`
+	// PodsBlocked is the number of pods whose eviction was refused by a PodDisruptionBudget on the last attempt
+	// +optional
+	PodsBlocked int32 `json:"podsBlocked,omitempty"`
+	// StartTime is when the drain of the node started
+	StartTime metav1.Time `json:"startTime"`
+	// ObservedGeneration is the NodeConfig generation the drain was last attempted for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Message describes why the node is not drained yet
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // NodeConfigStatus defines the observed state of NodeConfig
@@ -48,11 +196,21 @@ type NodeConfigStatus struct {
 	// Taints applied to the nodes
 	AppliedTaints   []corev1.Taint `json:"appliedTaints,omitempty"`
 	AppliedSelector NodeSelector   `json:"appliedSelector"`
+	// Drain is the drain progress of each selected node when spec.drain is set
+	// +optional
+	Drain []NodeDrainStatus `json:"drain,omitempty"`
+	// Rollout is the progress of the current rollout when spec.rollout is set
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Matched",type=integer,JSONPath=".status.matchedCount"
+// +kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=".status.appliedCount"
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=".status.failedCount"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
 // NodeConfig is the Schema for the nodeconfigs API
 type NodeConfig struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -80,11 +238,165 @@ type NodeSelector struct {
 	// Selector can be provided a plain string or a regex.
 	// If no selector is provided, all nodes will be selected
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// MatchExpressions is a list of label requirements that must all match.
+	// They are evaluated in addition to NodeSelector.
+	// +optional
+	MatchExpressions []config.SelectorRequirement `json:"matchExpressions,omitempty"`
+	// Fields select nodes by name and status rather than labels.
+	// They are evaluated in addition to NodeSelector and MatchExpressions.
+	// +optional
+	Fields *NodeFieldSelector `json:"fields,omitempty"`
+}
+
+// NodeFieldSelector selects nodes by metadata.name, status.nodeInfo, status.conditions and status.allocatable
+// All string fields are regexes, every field that is set must match.
+type NodeFieldSelector struct {
+	// Name is a regex matched against the node name
+	// +optional
+	Name string `json:"name,omitempty"`
+	// KubeletVersion is a regex matched against status.nodeInfo.kubeletVersion
+	// +optional
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+	// OSImage is a regex matched against status.nodeInfo.osImage
+	// +optional
+	OSImage string `json:"osImage,omitempty"`
+	// KernelVersion is a regex matched against status.nodeInfo.kernelVersion
+	// +optional
+	KernelVersion string `json:"kernelVersion,omitempty"`
+	// ContainerRuntimeVersion is a regex matched against status.nodeInfo.containerRuntimeVersion
+	// +optional
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion,omitempty"`
+	// OperatingSystem is a regex matched against status.nodeInfo.operatingSystem
+	// +optional
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+	// Architecture is a regex matched against status.nodeInfo.architecture
+	// +optional
+	Architecture string `json:"architecture,omitempty"`
+	// Conditions the node must report, for example type Ready with status True
+	// +optional
+	Conditions []NodeConditionRequirement `json:"conditions,omitempty"`
+	// MinAllocatable is the minimum allocatable quantity of each resource the node must have
+	// +optional
+	MinAllocatable corev1.ResourceList `json:"minAllocatable,omitempty"`
+	// MaxAllocatable is the maximum allocatable quantity of each resource the node may have
+	// +optional
+	MaxAllocatable corev1.ResourceList `json:"maxAllocatable,omitempty"`
+}
+
+// NodeConditionRequirement requires a node condition to have the given status
+type NodeConditionRequirement struct {
+	// Type of the node condition, for example Ready or MemoryPressure
+	Type corev1.NodeConditionType `json:"type"`
+	// Status the condition must have
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status corev1.ConditionStatus `json:"status"`
+}
+
+// IsEmpty returns true if the selector has no requirements and so selects all nodes
+func (s NodeSelector) IsEmpty() bool {
+	return len(s.NodeSelector) == 0 && len(s.MatchExpressions) == 0 && s.Fields == nil
+}
+
+// Validate returns an error for each regex in the selector that does not compile
+func (s NodeSelector) Validate() error {
+	err := config.ValidateSelector(s.NodeSelector, s.MatchExpressions)
+	if s.Fields == nil {
+		return err
+	}
+
+	return errors.Join(err,
+		config.ValidateRegex("fields.name", s.Fields.Name),
+		config.ValidateRegex("fields.kubeletVersion", s.Fields.KubeletVersion),
+		config.ValidateRegex("fields.osImage", s.Fields.OSImage),
+		config.ValidateRegex("fields.kernelVersion", s.Fields.KernelVersion),
+		config.ValidateRegex("fields.containerRuntimeVersion", s.Fields.ContainerRuntimeVersion),
+		config.ValidateRegex("fields.operatingSystem", s.Fields.OperatingSystem),
+		config.ValidateRegex("fields.architecture", s.Fields.Architecture),
+	)
+}
+
+// Matches returns true if the node satisfies the NodeSelector map, every match expression and the field selector
+func (s NodeSelector) Matches(node *corev1.Node) bool {
+	if !config.MatchRegexMap(s.NodeSelector, node.Labels) || !config.MatchExpressions(s.MatchExpressions, node.Labels) {
+		return false
+	}
+
+	return s.Fields == nil || s.Fields.Matches(node)
+}
+
+// regexFields returns pairs of each regex that is set and the node field it is matched against
+func (f *NodeFieldSelector) regexFields(node *corev1.Node) [][2]string {
+	info := node.Status.NodeInfo
+
+	var fields [][2]string
+	for _, field := range [][2]string{
+		{f.Name, node.Name},
+		{f.KubeletVersion, info.KubeletVersion},
+		{f.OSImage, info.OSImage},
+		{f.KernelVersion, info.KernelVersion},
+		{f.ContainerRuntimeVersion, info.ContainerRuntimeVersion},
+		{f.OperatingSystem, info.OperatingSystem},
+		{f.Architecture, info.Architecture},
+	} {
+		if field[0] != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// Matches returns true if the node satisfies every field that is set
+func (f *NodeFieldSelector) Matches(node *corev1.Node) bool {
+	for _, field := range f.regexFields(node) {
+		// If the regex fails to compile we treat it as no match
+		if match, err := regexp.MatchString(field[0], field[1]); err != nil || !match {
+			return false
+		}
+	}
+
+	for _, requirement := range f.Conditions {
+		if !hasNodeCondition(node, requirement) {
+			return false
+		}
+	}
+
+	for resource, min := range f.MinAllocatable {
+		allocatable, exists := node.Status.Allocatable[resource]
+		if !exists || allocatable.Cmp(min) < 0 {
+			return false
+		}
+	}
+
+	for resource, max := range f.MaxAllocatable {
+		allocatable, exists := node.Status.Allocatable[resource]
+		if !exists || allocatable.Cmp(max) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Captures adds the named capture groups of the field selector regexes matched against node to captures
+func (f *NodeFieldSelector) Captures(node *corev1.Node, captures map[string]string) {
+	for _, field := range f.regexFields(node) {
+		config.CaptureNamed(field[0], field[1], captures)
+	}
+}
+
+func hasNodeCondition(node *corev1.Node, requirement NodeConditionRequirement) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == requirement.Type {
+			return condition.Status == requirement.Status
+		}
+	}
+	return false
 }
 
 func (nc *NodeConfig) DetectChange() bool {
 
-	if !reflect.DeepEqual(nc.Status.AppliedSelector, nc.Spec.Selector) && nc.Status.AppliedSelector.NodeSelector != nil {
+	if !reflect.DeepEqual(nc.Status.AppliedSelector, nc.Spec.Selector) && !nc.Status.AppliedSelector.IsEmpty() {
 		return true
 	}
 	return false
@@ -100,10 +412,69 @@ func (nc *NodeConfig) Cleanup() {
 	nc.Spec.Labels = make(map[string]string)
 	nc.Spec.Annotations = make(map[string]string)
 	nc.Spec.Taints = make([]corev1.Taint, 0)
+	nc.Spec.Unschedulable = false
+	nc.Spec.Drain = nil
+	nc.Spec.Rollout = nil
+	nc.Spec.CleanupEnforcement()
+}
+
+// RemoveTaints drops the given taints from the spec by key and effect
+// A taint without an effect drops the key with every effect
+func (nc *NodeConfig) RemoveTaints(taints []corev1.Taint) {
+	nc.Spec.Taints = slices.DeleteFunc(nc.Spec.Taints, func(taint corev1.Taint) bool {
+		return slices.ContainsFunc(taints, func(removed corev1.Taint) bool {
+			return removed.Key == taint.Key && (removed.Effect == "" || removed.Effect == taint.Effect)
+		})
+	})
+}
+
+// Cordons returns true if the NodeConfig marks the selected nodes unschedulable
+func (nc *NodeConfig) Cordons() bool {
+	return nc.Spec.Unschedulable || nc.Spec.Drain != nil
 }
 
-// GetLabelSet compares the labels in the NodeConfig with the labels in the appliedLabels status
-// and returns a map of labels that need to be applied to the nodes.
+// FindDrainStatus returns the drain status recorded for the named node
+func (nc *NodeConfig) FindDrainStatus(node string) (NodeDrainStatus, bool) {
+	for _, status := range nc.Status.Drain {
+		if status.Node == node {
+			return status, true
+		}
+	}
+	return NodeDrainStatus{}, false
+}
+
+// RollingOut returns true if the current generation has not been rolled out to every selected node
+func (nc *NodeConfig) RollingOut() bool {
+	return nc.Status.Rollout != nil && nc.Status.Rollout.Phase == RolloutPhaseProgressing
+}
+
+// RolloutPending returns true if the node is still waiting for its batch of the current rollout
+// Watcher events for pending nodes are skipped so they are not updated ahead of the rollout
+func (nc *NodeConfig) RolloutPending(node string) bool {
+	if nc.Spec.Rollout == nil {
+		return false
+	}
+
+	rollout := nc.Status.Rollout
+	if rollout == nil || rollout.ObservedGeneration != nc.Generation {
+		return true
+	}
+
+	return !slices.Contains(rollout.UpdatedNodes, node)
+}
+
+// Draining returns true if any selected node is still being drained
+func (nc *NodeConfig) Draining() bool {
+	for _, status := range nc.Status.Drain {
+		if status.Phase == DrainPhaseDraining {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLabelSet returns the labels owned by the NodeConfig.
+// Labels removed from the spec are dropped by server-side apply, so no removal markers are needed.
 func (nc *NodeConfig) GetLabelSet() map[string]string {
 
 	// If the labels are nil, create a new map
@@ -111,7 +482,7 @@ func (nc *NodeConfig) GetLabelSet() map[string]string {
 		nc.Spec.Labels = make(map[string]string)
 	}
 
-	return config.ProcessMap(nc.Spec.Labels, nc.Status.AppliedLabels)
+	return nc.Spec.Labels
 }
 
 // These two are basically identical, so we should replace them with a single function
@@ -122,7 +493,7 @@ func (nc *NodeConfig) GetAnnotationSet() map[string]string {
 		nc.Spec.Annotations = make(map[string]string)
 	}
 
-	return config.ProcessMap(nc.Spec.Annotations, nc.Status.AppliedAnnotations)
+	return nc.Spec.Annotations
 }
 
 func (nc *NodeConfig) ErrorStatus() {
@@ -130,16 +501,13 @@ func (nc *NodeConfig) ErrorStatus() {
 	nc.Status.AppliedAnnotations = nc.Spec.Annotations
 	nc.Status.AppliedTaints = nc.Spec.Taints
 	nc.Status.AppliedSelector = nc.Spec.Selector
-	nc.Status.Conditions = []metav1.Condition{
-		{
-			Type:               "Applied",
-			Status:             metav1.ConditionFalse,
-			Reason:             "NodeConfigError",
-			Message:            fmt.Sprintf("%s MalFormed NodeConfig", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name)),
-			LastTransitionTime: metav1.Now(),
-			ObservedGeneration: nc.Generation,
-		},
-	}
+	meta.SetStatusCondition(&nc.Status.Conditions, metav1.Condition{
+		Type:               "Applied",
+		Status:             metav1.ConditionFalse,
+		Reason:             "NodeConfigError",
+		Message:            fmt.Sprintf("%s MalFormed NodeConfig", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name)),
+		ObservedGeneration: nc.Generation,
+	})
 }
 
 func (nc *NodeConfig) UpdateStatus() {
@@ -151,73 +519,144 @@ func (nc *NodeConfig) UpdateStatus() {
 	nc.Status.AppliedAnnotations = nc.Spec.Annotations
 	nc.Status.AppliedTaints = nc.Spec.Taints
 	nc.Status.AppliedSelector = nc.Spec.Selector
-	nc.Status.Conditions = []metav1.Condition{
-		{
+
+	// Audit configs never change their nodes, the result is reported by the Compliant condition
+	if nc.Spec.Audits() {
+		nc.Status.AppliedLabels = nil
+		nc.Status.AppliedAnnotations = nil
+		nc.Status.AppliedTaints = nil
+		meta.RemoveStatusCondition(&nc.Status.Conditions, "Applied")
+		return
+	}
+
+	// The Applied condition is only true when every selected object was updated
+	if nc.Status.FailedCount > 0 {
+		meta.SetStatusCondition(&nc.Status.Conditions, metav1.Condition{
 			Type:               "Applied",
-			Status:             metav1.ConditionTrue,
-			Reason:             "NodeConfigReady",
-			Message:            fmt.Sprintf("%s Applied", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name)),
-			LastTransitionTime: metav1.Now(),
+			Status:             metav1.ConditionFalse,
+			Reason:             "NodeConfigApplyFailed",
+			Message:            fmt.Sprintf("%s failed on %d of %d nodes", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name), nc.Status.FailedCount, nc.Status.MatchedCount),
 			ObservedGeneration: nc.Generation,
-		},
+		})
+		return
 	}
+
+	if nc.RollingOut() {
+		meta.SetStatusCondition(&nc.Status.Conditions, metav1.Condition{
+			Type:               "Applied",
+			Status:             metav1.ConditionFalse,
+			Reason:             "NodeConfigRollingOut",
+			Message:            fmt.Sprintf("%s applied to %d of %d nodes", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name), nc.Status.AppliedCount, nc.Status.MatchedCount),
+			ObservedGeneration: nc.Generation,
+		})
+		return
+	}
+
+	meta.SetStatusCondition(&nc.Status.Conditions, metav1.Condition{
+		Type:               "Applied",
+		Status:             metav1.ConditionTrue,
+		Reason:             "NodeConfigReady",
+		Message:            fmt.Sprintf("%s Applied", fmt.Sprintf("%s/%s", nc.Namespace, nc.Name)),
+		ObservedGeneration: nc.Generation,
+	})
 }
 
-// Match checks if the node matches all selectors in the NodeConfig
-// This is used to determine if the NodeConfig should be applied to the node when triggered by a watcher event
-func (nc *NodeConfig) Match(node *corev1.Node) bool {
-	if nc.Spec.Selector.NodeSelector == nil {
+// GetPriority returns the priority used to order NodeConfigs that select the same node
+func (nc *NodeConfig) GetPriority() int32 {
+	return nc.Spec.Priority
+}
+
+// ConflictStatus sets the Conflict condition for keys lost to higher priority NodeConfigs
+func (nc *NodeConfig) ConflictStatus(conflicts []config.Conflict) {
+	config.SetConflictCondition(&nc.Status.Conditions, conflicts, nc.Generation)
+}
+
+// Competes returns true if other sets any of the same labels, annotations or taints as the NodeConfig,
+// or the NodeConfig has already lost keys to another config
+func (nc *NodeConfig) Competes(other *NodeConfig) bool {
+	if meta.IsStatusConditionTrue(nc.Status.Conditions, config.ConditionConflict) {
 		return true
 	}
 
-	for SelectorKey, SelectorValue := range nc.Spec.Selector.NodeSelector {
+	if config.SharesKeys(nc.Spec.Labels, other.Spec.Labels) || config.SharesKeys(nc.Spec.Annotations, other.Spec.Annotations) {
+		return true
+	}
 
-		//  All Selector Labels must match
-		if _, exists := node.Labels[SelectorKey]; !exists {
-			return false
+	for _, taint := range nc.Spec.Taints {
+		if _, exists := other.FindTaint(taint); exists {
+			return true
 		}
+	}
 
-		if match, err := regexp.MatchString(SelectorValue, node.Labels[SelectorKey]); err != nil || !match {
-			// If the regex does not match, return false
-			return false
+	return false
+}
 
-		}
+// TemplatesValues reports whether the label and annotation values of the NodeConfig are templates
+func (nc *NodeConfig) TemplatesValues() bool {
+	return nc.Spec.TemplateValues
+}
+
+// Captures returns the named capture groups of the selector regexes matched against the node
+// They are used to render templated label and annotation values
+func (nc *NodeConfig) Captures(object metav1.Object) map[string]string {
+	captures := make(map[string]string)
+
+	node, ok := object.(*corev1.Node)
+	if !ok {
+		return captures
 	}
 
-	return true
+	selector := nc.Spec.Selector
+	config.CaptureRegexMap(selector.NodeSelector, node.Labels, captures)
+	config.CaptureExpressions(selector.MatchExpressions, node.Labels, captures)
+	if selector.Fields != nil {
+		selector.Fields.Captures(node, captures)
+	}
+
+	return captures
 }
 
-// WIP will come back to this
+// Match checks if the node matches all selectors in the NodeConfig
+// This is used to determine if the NodeConfig should be applied to the node when triggered by a watcher event
+func (nc *NodeConfig) Match(node *corev1.Node) bool {
+	return nc.Spec.Selector.Matches(node)
+}
 
+// GetTaintSet returns the taints the NodeConfig sets on its nodes
 func (nc *NodeConfig) GetTaintSet() []corev1.Taint {
 	// If the taints are nil, create a new slice
 	if nc.Spec.Taints == nil {
 		nc.Spec.Taints = make([]corev1.Taint, 0)
 	}
 
-	taintSet := nc.Spec.Taints
+	return nc.Spec.Taints
+}
 
-	// The possible scenarios are
-	// 1. The taint is in AppliedTaints and in the spec, so do nothing
-	// 2. The taint is in the spec, but not in the appliedTaints, so add it to the taintSet handled on 216
-	// 3. The taint is in the appliedTaints, but not in the spec, mark for removal
+// GetRemovedTaints returns the taints previously applied by the NodeConfig that are no longer in the spec.
+// Taints are identified by key and effect, so changing the effect of a taint removes the taint with the old effect.
+func (nc *NodeConfig) GetRemovedTaints() []corev1.Taint {
+	var removed []corev1.Taint
 
-	// If the taint is in the appliedTaints status, but not in the spec, remove it from the taintSet
 	for _, taint := range nc.Status.AppliedTaints {
-		if _, exists := nc.FindTaint(taint.Key); !exists {
-			taint.Effect = ""
-			taintSet = append(taintSet, taint)
+		if _, exists := nc.FindTaint(taint); !exists {
+			removed = append(removed, taint)
 		}
 	}
 
-	return taintSet
+	return removed
 }
 
-// Match checks if the node matches all selectors in the NodeConfig
-func (nc *NodeConfig) FindTaint(key string) (corev1.Taint, bool) {
-	for _, taint := range nc.Spec.Taints {
-		if taint.Key == key {
-			return taint, true
+// ManagesTaints returns true if the NodeConfig sets taints or has previously applied taints.
+// The node taint list is atomic, so a config that manages taints must always apply the full list.
+func (nc *NodeConfig) ManagesTaints() bool {
+	return len(nc.Spec.Taints) > 0 || len(nc.Status.AppliedTaints) > 0
+}
+
+// FindTaint returns the taint in the spec with the same key and effect as taint
+func (nc *NodeConfig) FindTaint(taint corev1.Taint) (corev1.Taint, bool) {
+	for _, specTaint := range nc.Spec.Taints {
+		if specTaint.MatchTaint(&taint) {
+			return specTaint, true
 		}
 	}
 	return corev1.Taint{}, false
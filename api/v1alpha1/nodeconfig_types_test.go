@@ -6,6 +6,8 @@ import (
 	"github.com/rjbrown57/factotum/pkg/factotum/config"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -44,10 +46,14 @@ func TestGetLabelSet(t *testing.T) {
 
 	labelSet := nc.GetLabelSet()
 
+	// key3 is no longer in the spec, it is removed by server-side apply rather than a "" marker
 	expected := map[string]string{
 		"key1": "value1",
 		"key2": "value2",
-		"key3": "",
+	}
+
+	if len(labelSet) != len(expected) {
+		t.Errorf("expected %d labels, got %d", len(expected), len(labelSet))
 	}
 
 	for k, v := range expected {
@@ -195,7 +201,183 @@ func TestGetTaintSet(t *testing.T) {
 
 	expected := nc.GetTaintSet()
 
-	if len(expected) != 2 {
-		t.Errorf("expected 2 taints, got %d", len(expected))
+	if len(expected) != 1 {
+		t.Errorf("expected 1 taint, got %d", len(expected))
+	}
+}
+
+func TestGetRemovedTaints(t *testing.T) {
+	nc := &NodeConfig{
+		Spec: NodeConfigSpec{
+			Taints: []corev1.Taint{
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+			},
+		},
+		Status: NodeConfigStatus{
+			AppliedTaints: []corev1.Taint{
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+				{Key: "key2", Value: "value2", Effect: corev1.TaintEffectNoSchedule},
+			},
+		},
+	}
+
+	removed := nc.GetRemovedTaints()
+
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 removed taints, got %d", len(removed))
+	}
+
+	// Removed taints keep their effect so they can be told apart from taints with the same key
+	if removed[0].Key != "dedicated" || removed[0].Effect != corev1.TaintEffectNoSchedule {
+		t.Errorf("expected dedicated:NoSchedule to be removed, got %s", removed[0].ToString())
+	}
+
+	if _, exists := nc.FindTaint(corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule}); exists {
+		t.Errorf("expected dedicated:NoSchedule to not be found in the spec")
+	}
+}
+
+func TestRemoveTaints(t *testing.T) {
+	taints := []corev1.Taint{
+		{Key: "maintenance", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "maintenance", Effect: corev1.TaintEffectNoExecute},
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+	}
+	nc := &NodeConfig{Spec: NodeConfigSpec{Taints: taints}}
+
+	// An effect only removes the taint with that effect, no effect removes the key with every effect
+	nc.RemoveTaints([]corev1.Taint{
+		{Key: "maintenance", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated"},
+	})
+
+	if len(nc.Spec.Taints) != 1 {
+		t.Fatalf("expected 1 taint to be kept, got %v", nc.Spec.Taints)
+	}
+	if nc.Spec.Taints[0].Key != "maintenance" || nc.Spec.Taints[0].Effect != corev1.TaintEffectNoExecute {
+		t.Errorf("expected maintenance:NoExecute to be kept, got %s", nc.Spec.Taints[0].ToString())
+	}
+}
+
+func TestFieldSelectorMatch(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "worker-gpu-1",
+			Labels: map[string]string{"pool": "gpu"},
+		},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{
+				KubeletVersion:          "v1.33.1",
+				OSImage:                 "Ubuntu 24.04 LTS",
+				KernelVersion:           "6.8.0-45-generic",
+				ContainerRuntimeVersion: "containerd://2.0.0",
+				OperatingSystem:         "linux",
+				Architecture:            "arm64",
+			},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse},
+			},
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("8"),
+				corev1.ResourceMemory: resource.MustParse("32Gi"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		fields NodeFieldSelector
+		want   bool
+	}{
+		{
+			name:   "name regex",
+			fields: NodeFieldSelector{Name: "^worker-gpu-[0-9]+$"},
+			want:   true,
+		},
+		{
+			name:   "node info",
+			fields: NodeFieldSelector{KubeletVersion: `^v1\.33\.`, Architecture: "arm64", OperatingSystem: "linux", OSImage: "Ubuntu", KernelVersion: "^6\\.", ContainerRuntimeVersion: "^containerd"},
+			want:   true,
+		},
+		{
+			name:   "node info mismatch",
+			fields: NodeFieldSelector{Architecture: "amd64"},
+			want:   false,
+		},
+		{
+			name:   "ready condition",
+			fields: NodeFieldSelector{Conditions: []NodeConditionRequirement{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+			want:   true,
+		},
+		{
+			name:   "not ready condition",
+			fields: NodeFieldSelector{Conditions: []NodeConditionRequirement{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}},
+			want:   false,
+		},
+		{
+			name:   "missing condition",
+			fields: NodeFieldSelector{Conditions: []NodeConditionRequirement{{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse}}},
+			want:   false,
+		},
+		{
+			name:   "min allocatable",
+			fields: NodeFieldSelector{MinAllocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("16Gi")}},
+			want:   true,
+		},
+		{
+			name:   "min allocatable not met",
+			fields: NodeFieldSelector{MinAllocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("16")}},
+			want:   false,
+		},
+		{
+			name:   "max allocatable exceeded",
+			fields: NodeFieldSelector{MaxAllocatable: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Gi")}},
+			want:   false,
+		},
+		{
+			name:   "missing resource",
+			fields: NodeFieldSelector{MinAllocatable: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := &NodeConfig{
+				Spec: NodeConfigSpec{
+					Selector: NodeSelector{
+						NodeSelector: map[string]string{"pool": "gpu"},
+						Fields:       &tt.fields,
+					},
+				},
+			}
+
+			if got := nc.Match(node); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFailed(t *testing.T) {
+	nc := &NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-nodeconfig",
+		},
+	}
+
+	nc.Status.SetObjects([]config.ObjectStatus{
+		{Name: "node1", Result: config.ResultApplied},
+		{Name: "node2", Result: config.ResultFailed, LastError: "conflict"},
+	})
+
+	nc.UpdateStatus()
+
+	condition := meta.FindStatusCondition(nc.Status.Conditions, "Applied")
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("expected Applied condition to be false, got %+v", condition)
 	}
 }
@@ -37,6 +37,7 @@ import (
 
 	factotumiov1alpha1 "github.com/rjbrown57/factotum/api/v1alpha1"
 	"github.com/rjbrown57/factotum/internal/controller"
+	"github.com/rjbrown57/factotum/pkg/factotum/workers"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -79,6 +80,12 @@ func main() {
 	flag.BoolVar(&NodeController, "node-controller", NodeController,
 		"Enable the NodeConfig controller. ")
 
+	// Number of objects each controller updates in parallel
+	var workerCount int
+	flag.IntVar(&workerCount, "workers", workers.DefaultWorkers,
+		"The number of nodes or namespaces each controller updates in parallel. "+
+			"Updates to the same node or namespace are never run in parallel.")
+
 	opts := zap.Options{
 		Development: true,
 	}
@@ -156,8 +163,9 @@ func main() {
 
 	if NodeController {
 		if err = (&controller.NodeConfigReconciler{
-			Client: mgr.GetClient(),
-			Scheme: mgr.GetScheme(),
+			Client:  mgr.GetClient(),
+			Scheme:  mgr.GetScheme(),
+			Workers: workerCount,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "NodeConfig")
 			os.Exit(1)
@@ -166,8 +174,9 @@ func main() {
 
 	if nsController {
 		if err = (&controller.NamespaceConfigReconciler{
-			Client: mgr.GetClient(),
-			Scheme: mgr.GetScheme(),
+			Client:  mgr.GetClient(),
+			Scheme:  mgr.GetScheme(),
+			Workers: workerCount,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "NamespaceConfig")
 			os.Exit(1)
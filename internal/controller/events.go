@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+// eventSource is the component events are reported as
+const eventSource = "factotum"
+
+// notifyQueueSize is how many notifications from the controllers can wait for the reconciler
+const notifyQueueSize = 100
+
+// auditEvents reports each object that differs from an Audit config as a Warning event on the config
+// The recorder aggregates repeated events, so an unchanged difference does not add a new event on every audit
+func auditEvents(recorder record.EventRecorder, obj runtime.Object, objects []config.ObjectStatus) {
+	for _, object := range objects {
+		if object.Result == config.ResultNonCompliant {
+			recorder.Eventf(obj, corev1.EventTypeWarning, config.EventReasonNonCompliant, "%s: %s", object.Name, strings.Join(object.Differences, "; "))
+		}
+	}
+}
+
+// driftEvents reports each correction as a Warning event on the config and on the corrected object
+// and returns the corrections to record in the config status
+func driftEvents(recorder record.EventRecorder, obj client.Object, drifts []config.Drift) []config.DriftRecord {
+	records := make([]config.DriftRecord, 0, len(drifts))
+	for _, drift := range drifts {
+		recorder.Event(obj, corev1.EventTypeWarning, config.EventReasonDrift, drift.Record.String())
+		if drift.Object != nil {
+			recorder.Eventf(drift.Object, corev1.EventTypeWarning, config.EventReasonDrift, "%s by %s", drift.Record.String(), obj.GetName())
+		}
+		records = append(records, drift.Record)
+	}
+	return records
+}
+
+// configNotifier returns a function that requeues the named config when a controller has something for its status,
+// such as drift or exhausted retries
+// The send never blocks the processor, a full queue already has the config waiting to be reconciled
+func configNotifier(ch chan<- event.GenericEvent, newObject func(name string) client.Object) func(string) {
+	return func(name string) {
+		select {
+		case ch <- event.GenericEvent{Object: newObject(name)}:
+		default:
+		}
+	}
+}
+
+// applyEvents summarises the per object results of an enforced config as a single event on the config
+// Failures are reported per object by the controllers, on the objects themselves
+func applyEvents(recorder record.EventRecorder, obj runtime.Object, status *config.CommonStatus, kind string) {
+	if status.FailedCount > 0 {
+		recorder.Eventf(obj, corev1.EventTypeWarning, config.EventReasonApplyFailed, "failed on %d of %d %s", status.FailedCount, status.MatchedCount, kind)
+		return
+	}
+
+	recorder.Eventf(obj, corev1.EventTypeNormal, config.EventReasonApplied, "applied to %d of %d %s", status.AppliedCount, status.MatchedCount, kind)
+}
+
+// invalidSpecEvent reports a config that cannot be applied as intended
+func invalidSpecEvent(recorder record.EventRecorder, obj runtime.Object, err error) {
+	recorder.Event(obj, corev1.EventTypeWarning, config.EventReasonInvalidSpec, fmt.Sprintf("invalid spec: %s", err))
+}
@@ -18,17 +18,33 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"slices"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
 	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	controller "github.com/rjbrown57/factotum/pkg/factotum/controllers/namespaceController"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	"github.com/rjbrown57/factotum/pkg/k8s"
 )
 
@@ -36,9 +52,12 @@ import (
 type NamespaceConfigReconciler struct {
 	client.Client
 	Scheme          *runtime.Scheme
-	k8sClient       *kubernetes.Clientset
+	k8sClient       kubernetes.Interface
 	NamspaceConfigs map[string]*v1alpha1.NamespaceConfig
 	Controller      *controller.NamespaceController
+	Recorder        record.EventRecorder
+	// Workers is the number of objects updated in parallel
+	Workers int
 }
 
 // +kubebuilder:rbac:groups=factotum.io,resources=namespaceconfigs,verbs=get;list;watch;create;update;patch;delete
@@ -46,6 +65,14 @@ type NamespaceConfigReconciler struct {
 // +kubebuilder:rbac:groups=factotum.io,resources=namespaceconfigs/finalizers,verbs=update
 
 // +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;update;create;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=resourcequotas,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=limitranges,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=bind,resourceNames=admin;edit;view
+// +kubebuilder:rbac:groups="",resources=configmaps;serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,27 +103,50 @@ func (r *NamespaceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		// Handle deletion logic
 		DebugLog.Info("NamespaceConfig is being deleted", "name", req.NamespacedName.Name)
 
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonCleanupStarted, "removing NamespaceConfig from its namespaces")
+
 		// Cleanup the NamespaceConfig instance
-		// This will remove all labels, annotations, and taints from the NamespaceConfig
-		// When passed to NodeUpdate, it will remove all labels, annotations, and taints from the node
+		// This will remove all labels, annotations, and objects from the NamespaceConfig
+		// When passed to Update, it will remove all labels, annotations, and objects from the namespace
 		fConfig.Cleanup()
-		r.Controller.Mu.Lock()
-		r.NamspaceConfigs[req.NamespacedName.String()] = fConfig
-		r.Controller.Mu.Unlock()
+		shared := r.share(req.NamespacedName.String(), fConfig)
 
 		// Cleanup up the NamespaceConfig instance
-		r.Controller.Notify(controller.Msg{
+		objects := controller.NewObjectResults()
+		pctx, cancel := context.WithTimeout(ctx, processTimeout)
+		defer cancel()
+		done := make(chan struct{})
+		if err := r.Controller.Notify(pctx, controller.Msg{
 			Header:    "Cleanup",
 			Namespace: nil,
-			Config:    fConfig.DeepCopy(),
-		})
+			Config:    shared,
+			Objects:   objects,
+			Done:      done,
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
 
 		// Wait for the NodeController to finish processing
-		r.Controller.Wg.Wait()
+		if err := waitProcessed(pctx, metrics.Namespace, done); err != nil {
+			controllerLog.Error(err, "NamespaceConfig was not removed from its namespaces in time", "name", req.NamespacedName.String())
+			return ctrl.Result{}, err
+		}
+
+		// Objects that could not be deleted keep the finalizer, they are deleted again on the next reconcile
+		// Audit configs never change their namespaces, so objects they created before are left alone
+		if remaining := objects.Objects(); len(remaining) > 0 && !fConfig.Spec.Audits() {
+			fConfig.Status.ManagedObjects = remaining
+			r.share(req.NamespacedName.String(), fConfig)
+			err := fmt.Errorf("%d objects were not deleted from their namespaces", len(remaining))
+			controllerLog.Error(err, "NamespaceConfig was not removed from its namespaces", "name", req.NamespacedName.String())
+			return ctrl.Result{}, errors.Join(err, r.Status().Update(ctx, fConfig))
+		}
 
 		r.Controller.Mu.Lock()
 		delete(r.NamspaceConfigs, req.NamespacedName.String())
 		r.Controller.Mu.Unlock()
+		metrics.Forget(metrics.Namespace, fConfig.Name)
+		r.Controller.Retries.ForgetConfig(fConfig.Name)
 
 		// Remove the finalizer from the NamespaceConfig
 		fConfig.RemoveFinalizer()
@@ -107,6 +157,8 @@ func (r *NamespaceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			}, err
 		}
 
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonCleanupFinished, "removed NamespaceConfig from its namespaces")
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonFinalizerRemoved, "removed finalizer")
 		controllerLog.Info("Removed finalizer from NamespaceConfig", "name", req.NamespacedName.String())
 		return ctrl.Result{}, nil
 	}
@@ -121,51 +173,201 @@ func (r *NamespaceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 				Requeue: true,
 			}, err
 		}
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonFinalizerAdded, "added finalizer")
 		controllerLog.Info("Added finalizer to NamespaceConfig", "name", req.NamespacedName.Name)
 	}
 
+	// A scheduled NamespaceConfig is cleaned from its namespaces outside its window, the same as when it is deleted
+	active, err := config.EvaluateSchedule(&fConfig.Spec.CommonSpec, &fConfig.Status.CommonStatus, fConfig.Generation, time.Now())
+	if err != nil {
+		controllerLog.Error(err, "Invalid schedule, NamespaceConfig will not be applied", "name", req.NamespacedName.String())
+		invalidSpecEvent(r.Recorder, fConfig, err)
+		return ctrl.Result{}, r.Status().Update(ctx, fConfig)
+	}
+
+	// Expired entries are dropped from the spec, an expired NamespaceConfig is cleaned from its namespaces
+	expiry := config.EvaluateExpiry(&fConfig.Spec.CommonSpec, &fConfig.Status.CommonStatus, fConfig.CreationTimestamp.Time, fConfig.Generation, time.Now())
+
+	switch {
+	case expiry.Expired:
+		DebugLog.Info("NamespaceConfig has expired, cleaning", "name", req.NamespacedName.String())
+		fConfig.Cleanup()
+	case !active:
+		DebugLog.Info("NamespaceConfig is outside its window, cleaning", "name", req.NamespacedName.String())
+		fConfig.Cleanup()
+	}
+
+	// Invalid regexes never match, so the NamespaceConfig is applied to fewer namespaces than intended
+	if err := fConfig.Spec.Selector.Validate(); err != nil {
+		controllerLog.Error(err, "Invalid selector", "name", req.NamespacedName.String())
+		invalidSpecEvent(r.Recorder, fConfig, err)
+	}
+
+	cleaning := expiry.Expired || !active
+	if cleaning {
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonCleanupStarted, "removing NamespaceConfig from its namespaces")
+	}
+
 	// The NamespaceConfig instance is being created or updated
 	// We need to update the NamespaceConfig instance in the map
 	DebugLog.Info("NamespaceConfig found, updating map", "name", req.NamespacedName, "labels", fConfig.Spec.Labels)
-	r.Controller.Mu.Lock()
-	r.NamspaceConfigs[req.NamespacedName.String()] = fConfig
-	r.Controller.Mu.Unlock()
+	shared := r.share(req.NamespacedName.String(), fConfig)
 
 	// Send a message to the NodeController to process the config
 	DebugLog.Info("Sending message to NodeController to apply configs", "NamespaceConfigs", len(r.NamspaceConfigs))
-	r.Controller.Notify(controller.Msg{
+	results := config.NewResults()
+	objects := controller.NewObjectResults()
+	pctx, cancel := context.WithTimeout(ctx, processTimeout)
+	defer cancel()
+	done := make(chan struct{})
+	if err := r.Controller.Notify(pctx, controller.Msg{
 		Header:    "Reconciler",
 		Namespace: nil,
-		Config:    fConfig,
-	})
+		Config:    shared,
+		Results:   results,
+		Objects:   objects,
+		Done:      done,
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Wait for the NodeController to finish processing
-	r.Controller.Wg.Wait()
+	if err := waitProcessed(pctx, metrics.Namespace, done); err != nil {
+		controllerLog.Error(err, "NamespaceConfig was not applied to its namespaces in time", "name", req.NamespacedName.String())
+		return ctrl.Result{}, err
+	}
+
+	fConfig.Status.SetObjects(results.Objects())
+	metrics.SetObjects(metrics.Namespace, fConfig.Name, fConfig.Status.Objects)
+	fConfig.Status.ExhaustedRetries = r.Controller.Retries.Exhausted(fConfig.Name)
+
+	// Keys set back on namespaces since the last reconcile are reported and counted
+	fConfig.Status.RecordDrift(driftEvents(r.Recorder, fConfig, r.Controller.Drift.Take(fConfig.Name)))
+	fConfig.Status.ComplianceStatus(fConfig.Spec.GetEnforcement(), fConfig.Generation)
+	auditEvents(r.Recorder, fConfig, fConfig.Status.Objects)
+
+	switch {
+	case cleaning:
+		r.Recorder.Event(fConfig, corev1.EventTypeNormal, config.EventReasonCleanupFinished, "removed NamespaceConfig from its namespaces")
+	case !fConfig.Spec.Audits():
+		applyEvents(r.Recorder, fConfig, &fConfig.Status.CommonStatus, "namespaces")
+	}
 
 	controllerLog.Info("Reconciling NamespaceConfig complete", "name", req.NamespacedName.String())
 
+	// Record any keys lost to higher priority NamespaceConfigs
+	fConfig.ConflictStatus(r.Controller.GetConflicts(fConfig))
+
 	// Update the status of the NamespaceConfig
-	r.Controller.Mu.Lock()
+	fConfig.Status.ManagedObjects = objects.Objects()
 	fConfig.UpdateStatus()
+
+	// The managed objects are read by the namespace watcher, so they are shared once the status is complete
+	r.share(req.NamespacedName.String(), fConfig)
+
+	if err := r.Status().Update(ctx, fConfig); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The finalizer removes the expired NamespaceConfig, it has already been cleaned from its namespaces
+	if expiry.Expired && fConfig.Spec.DeleteOnExpiry {
+		controllerLog.Info("Deleting expired NamespaceConfig", "name", req.NamespacedName.String())
+		return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, fConfig))
+	}
+
+	// A scheduled NamespaceConfig is reconciled again when its window opens or closes, and when its next entry expires
+	requeueAfter := soonest(fConfig.Status.WindowRequeueAfter(time.Now()), expiry.RequeueAfter)
+
+	// Audit configs are not told about changes to their namespaces, so they check them again periodically
+	if fConfig.Spec.Audits() {
+		requeueAfter = soonest(requeueAfter, auditRequeueInterval)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// share stores a copy of fConfig in NamspaceConfigs for the NamespaceController and returns it.
+// The workers read the copy without holding Mu, so it is never changed once stored.
+// The reconciler keeps changing fConfig, such as recording the status.
+func (r *NamespaceConfigReconciler) share(key string, fConfig *v1alpha1.NamespaceConfig) *v1alpha1.NamespaceConfig {
+	shared := fConfig.DeepCopy()
+
+	r.Controller.Mu.Lock()
+	r.NamspaceConfigs[key] = shared
 	r.Controller.Mu.Unlock()
 
-	return ctrl.Result{}, r.Status().Update(ctx, fConfig)
+	return shared
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NamespaceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	notify := make(chan event.GenericEvent, notifyQueueSize)
+
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.NamespaceConfig{}).
+		// When a NamespaceConfig spec changes, competing NamespaceConfigs are requeued so their Conflict condition stays current
+		Watches(&v1alpha1.NamespaceConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.competingConfigs),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// A NamespaceConfig is reconciled when the namespace watcher sets back keys someone else changed,
+		// or when the retries for a namespace are exhausted, so they are recorded in status
+		WatchesRawSource(source.Channel(notify, &handler.EnqueueRequestForObject{})).
 		Complete(r)
 
 	if err != nil {
 		return err
 	}
 
+	r.Recorder = mgr.GetEventRecorderFor(eventSource)
+
+	if err := r.setupController(k8s.NewK8sClient(), k8s.NewDynamicClient(), mgr.GetRESTMapper(), notify); err != nil {
+		return err
+	}
+
+	// The informer and processor run with the manager, reconciles wait until the cache has synced
+	return mgr.Add(r.Controller)
+}
+
+// setupController creates the NamespaceController and gives it the map the reconciler stores NamespaceConfigs in,
+// so the namespace watcher, the retries and conflict resolution see every config the reconciler has applied
+func (r *NamespaceConfigReconciler) setupController(k8sClient kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, notify chan<- event.GenericEvent) error {
+	var err error
+
 	r.NamspaceConfigs = make(map[string]*v1alpha1.NamespaceConfig)
+	r.k8sClient = k8sClient
+	r.Controller, err = controller.NewNamespaceController(r.k8sClient, dynamicClient, mapper, r.NamspaceConfigs, r.Recorder)
+	if err != nil {
+		return err
+	}
+
+	r.Controller.Workers = r.Workers
+
+	notifier := configNotifier(notify, func(name string) client.Object {
+		return &v1alpha1.NamespaceConfig{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	})
+	r.Controller.Drift.OnDrift(notifier)
+	r.Controller.Retries.OnExhausted(notifier)
+
+	return nil
+}
+
+// competingConfigs returns a request for every other NamespaceConfig that competes with obj
+func (r *NamespaceConfigReconciler) competingConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+
+	changed, ok := obj.(*v1alpha1.NamespaceConfig)
+	if !ok {
+		return requests
+	}
 
-	r.k8sClient = k8s.NewK8sClient()
-	r.Controller, err = controller.NewNamespaceController(r.k8sClient, r.NamspaceConfigs)
+	r.Controller.Mu.Lock()
+	defer r.Controller.Mu.Unlock()
+
+	for _, other := range r.NamspaceConfigs {
+		if other.Name != changed.Name && other.Competes(changed) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: other.Name}})
+		}
+	}
 
-	return err
+	return requests
 }
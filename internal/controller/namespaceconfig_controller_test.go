@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+// namespaceReconcilerTest runs a NamespaceConfigReconciler and its NamespaceController against fake clients
+type namespaceReconcilerTest struct {
+	t         *testing.T
+	ctx       context.Context
+	r         *NamespaceConfigReconciler
+	clientset *k8sfake.Clientset
+}
+
+// newNamespaceReconcilerTest starts the NamespaceController with namespaces in the cluster and configs ready to be reconciled
+// The dynamic client shares the store of the clientset, so objects created by a config are seen by the object informers
+func newNamespaceReconcilerTest(t *testing.T, namespaces []*corev1.Namespace, configs ...*v1alpha1.NamespaceConfig) *namespaceReconcilerTest {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.NamespaceConfig{})
+	for _, cfg := range configs {
+		builder.WithObjects(cfg)
+	}
+
+	var objects []runtime.Object
+	for _, namespace := range namespaces {
+		objects = append(objects, namespace)
+	}
+	clientset := k8sfake.NewClientset(objects...)
+
+	// The tracker returns typed objects, the dynamic client expects them unstructured
+	react := k8stesting.ObjectReaction(clientset.Tracker())
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme)
+	dynamicClient.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		handled, obj, err := react(action)
+		if err != nil || obj == nil {
+			return handled, obj, err
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		return handled, &unstructured.Unstructured{Object: content}, err
+	})
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []string{"ResourceQuota", "LimitRange", "ConfigMap", "ServiceAccount"} {
+		mapper.Add(corev1.SchemeGroupVersion.WithKind(gvk), meta.RESTScopeNamespace)
+	}
+	mapper.Add(networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), meta.RESTScopeNamespace)
+
+	r := &NamespaceConfigReconciler{
+		Client:   builder.Build(),
+		Scheme:   scheme,
+		Recorder: &record.FakeRecorder{},
+	}
+	if err := r.setupController(clientset, dynamicClient, mapper, make(chan event.GenericEvent, notifyQueueSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = r.Controller.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	return &namespaceReconcilerTest{t: t, ctx: ctx, r: r, clientset: clientset}
+}
+
+// reconcile reconciles the named NamespaceConfig and returns it as stored after the reconcile
+func (rt *namespaceReconcilerTest) reconcile(name string) *v1alpha1.NamespaceConfig {
+	rt.t.Helper()
+
+	key := types.NamespacedName{Name: name}
+	if _, err := rt.r.Reconcile(rt.ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		rt.t.Fatalf("reconciling %s: %v", name, err)
+	}
+
+	cfg := &v1alpha1.NamespaceConfig{}
+	if err := rt.r.Get(rt.ctx, key, cfg); err != nil {
+		rt.t.Fatal(err)
+	}
+	return cfg
+}
+
+// eventually fails the test when condition is not true within a few seconds
+func (rt *namespaceReconcilerTest) eventually(what string, condition func() bool) {
+	rt.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			rt.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNamespaceReconcilerRestoresObjects(t *testing.T) {
+	rt := newNamespaceReconcilerTest(t,
+		[]*corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}},
+		&v1alpha1.NamespaceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-defaults"},
+			Spec: v1alpha1.NamespaceConfigSpec{
+				LimitRanges: []v1alpha1.LimitRangeTemplate{{
+					Name: "defaults",
+					Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypeContainer}}},
+				}},
+			},
+		},
+	)
+
+	if cfg := rt.reconcile("team-defaults"); len(cfg.Status.ManagedObjects) != 1 {
+		t.Fatalf("got managed objects %+v, want the LimitRange", cfg.Status.ManagedObjects)
+	}
+
+	limitRanges := rt.clientset.CoreV1().LimitRanges("team-a")
+	exists := func() bool {
+		_, err := limitRanges.Get(rt.ctx, "defaults", metav1.GetOptions{})
+		return err == nil
+	}
+	rt.eventually("the LimitRange to be created", exists)
+
+	// The object watcher finds the config the reconciler stored and creates the LimitRange again
+	if err := limitRanges.Delete(rt.ctx, "defaults", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rt.eventually("the deleted LimitRange to be created again", exists)
+
+	if cfg := rt.reconcile("team-defaults"); len(cfg.Status.RecentDrift) != 1 || !cfg.Status.RecentDrift[0].Recreated {
+		t.Errorf("got recent drift %+v, want the recreated LimitRange", cfg.Status.RecentDrift)
+	}
+}
+
+func TestNamespaceReconcilerResolvesConflicts(t *testing.T) {
+	teamConfig := func(name, team string, priority int32) *v1alpha1.NamespaceConfig {
+		cfg := &v1alpha1.NamespaceConfig{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		cfg.Spec.Labels = map[string]string{"team": team}
+		cfg.Spec.Priority = priority
+		return cfg
+	}
+
+	rt := newNamespaceReconcilerTest(t,
+		[]*corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}},
+		teamConfig("platform", "platform", 10),
+		teamConfig("defaults", "unassigned", 0),
+	)
+
+	rt.reconcile("platform")
+	defaults := rt.reconcile("defaults")
+
+	// The lower priority config loses the team label to the platform config
+	if !meta.IsStatusConditionTrue(defaults.Status.Conditions, config.ConditionConflict) {
+		t.Errorf("got conditions %+v, want the Conflict condition set", defaults.Status.Conditions)
+	}
+
+	namespace, err := rt.clientset.CoreV1().Namespaces().Get(rt.ctx, "team-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace.Labels["team"] != "platform" {
+		t.Errorf("got team label %q, want the higher priority value platform", namespace.Labels["team"])
+	}
+}
+
+func TestNamespaceReconcilerPrunesDeselectedNamespaces(t *testing.T) {
+	rt := newNamespaceReconcilerTest(t,
+		[]*corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"env": "dev"}}}},
+		&v1alpha1.NamespaceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-defaults"},
+			Spec: v1alpha1.NamespaceConfigSpec{
+				CommonSpec: config.CommonSpec{Labels: map[string]string{"quota-tier": "small"}},
+				Selector:   v1alpha1.NamespaceSelector{NamespaceSelector: map[string]string{"env": "dev"}},
+				LimitRanges: []v1alpha1.LimitRangeTemplate{{
+					Name: "defaults",
+					Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypeContainer}}},
+				}},
+			},
+		},
+	)
+
+	rt.reconcile("dev-defaults")
+
+	limitRanges := rt.clientset.CoreV1().LimitRanges("team-a")
+	exists := func() bool {
+		_, err := limitRanges.Get(rt.ctx, "defaults", metav1.GetOptions{})
+		return err == nil
+	}
+	rt.eventually("the LimitRange to be created", exists)
+
+	namespaces := rt.clientset.CoreV1().Namespaces()
+	tierLabel := func() bool {
+		namespace, err := namespaces.Get(rt.ctx, "team-a", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, set := namespace.Labels["quota-tier"]
+		return set
+	}
+	rt.eventually("the quota-tier label to be set", tierLabel)
+
+	// The namespace watcher finds the config no longer selects the namespace, removes its label and deletes the LimitRange
+	patch := []byte(`{"metadata":{"labels":{"env":"prod"}}}`)
+	if _, err := namespaces.Patch(rt.ctx, "team-a", types.MergePatchType, patch, metav1.PatchOptions{FieldManager: "kubectl"}); err != nil {
+		t.Fatal(err)
+	}
+	rt.eventually("the LimitRange to be deleted", func() bool { return !exists() })
+	rt.eventually("the quota-tier label to be removed", func() bool { return !tierLabel() })
+
+	if cfg := rt.reconcile("dev-defaults"); len(cfg.Status.ManagedObjects) != 0 {
+		t.Errorf("got managed objects %+v, want none", cfg.Status.ManagedObjects)
+	}
+}
+
+func TestNamespaceReconcilerEnforcesChangedNamespaces(t *testing.T) {
+	cfg := &v1alpha1.NamespaceConfig{ObjectMeta: metav1.ObjectMeta{Name: "team-labels"}}
+	cfg.Spec.Labels = map[string]string{"team": "a"}
+
+	rt := newNamespaceReconcilerTest(t, []*corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}}, cfg)
+	rt.reconcile("team-labels")
+
+	namespaces := rt.clientset.CoreV1().Namespaces()
+	teamLabel := func() string {
+		namespace, err := namespaces.Get(rt.ctx, "team-a", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return namespace.Labels["team"]
+	}
+	rt.eventually("the team label to be set", func() bool { return teamLabel() == "a" })
+
+	// The namespace watcher sets the changed label back and records the drift for the reconciler
+	namespace, err := namespaces.Get(rt.ctx, "team-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespace.Labels["team"] = "b"
+	if _, err := namespaces.Update(rt.ctx, namespace, metav1.UpdateOptions{FieldManager: "kubectl"}); err != nil {
+		t.Fatal(err)
+	}
+	rt.eventually("the team label to be set back", func() bool { return teamLabel() == "a" })
+
+	// The watcher may set the label back again before its own change reaches the cache
+	if cfg := rt.reconcile("team-labels"); len(cfg.Status.RecentDrift) == 0 || cfg.Status.RecentDrift[0].Key != "team" {
+		t.Errorf("got recent drift %+v, want the changed team label", cfg.Status.RecentDrift)
+	}
+}
+
+func TestNamespaceReconcilerAppliesOnce(t *testing.T) {
+	cfg := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-defaults"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			LimitRanges: []v1alpha1.LimitRangeTemplate{{
+				Name: "defaults",
+				Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypeContainer}}},
+			}},
+		},
+	}
+	cfg.Spec.Enforcement = config.EnforcementApplyOnce
+
+	rt := newNamespaceReconcilerTest(t, []*corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}}, cfg)
+	rt.reconcile("team-defaults")
+
+	// The config owns no keys of the namespace, it is still marked as applied
+	rt.eventually("the namespace to be marked as applied", func() bool {
+		namespace, exists := rt.r.Controller.Cache.Get("team-a")
+		if !exists {
+			return false
+		}
+		_, applied := namespace.Annotations[config.AppliedAnnotation("team-defaults")]
+		return applied
+	})
+
+	limitRanges := rt.clientset.CoreV1().LimitRanges("team-a")
+	if err := limitRanges.Delete(rt.ctx, "defaults", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rt.reconcile("team-defaults")
+	if _, err := limitRanges.Get(rt.ctx, "defaults", metav1.GetOptions{}); err == nil {
+		t.Error("the LimitRange was created again after the config was applied once")
+	}
+}
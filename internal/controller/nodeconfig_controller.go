@@ -19,26 +19,44 @@ package controller
 import (
 	"context"
 	"slices"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
 	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	nc "github.com/rjbrown57/factotum/pkg/factotum/controllers/nodeController"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	"github.com/rjbrown57/factotum/pkg/k8s"
 )
 
+// drainRequeueInterval is how often a NodeConfig is reconciled while its nodes are draining
+const drainRequeueInterval = 10 * time.Second
+
 // NodeConfigReconciler reconciles a NodeConfig object
 type NodeConfigReconciler struct {
 	client.Client
 	Scheme      *runtime.Scheme
-	K8sClient   *kubernetes.Clientset
+	K8sClient   kubernetes.Interface
 	NodeConfigs map[string]*v1alpha1.NodeConfig
 	Nc          *nc.NodeController
+	Recorder    record.EventRecorder
+	// Workers is the number of objects updated in parallel
+	Workers int
 }
 
 // +kubebuilder:rbac:groups=factotum.io,resources=nodeconfigs,verbs=get;list;watch;create;update;patch;delete
@@ -46,6 +64,9 @@ type NodeConfigReconciler struct {
 // +kubebuilder:rbac:groups=factotum.io,resources=nodeconfigs/finalizers,verbs=update
 
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,27 +92,38 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// Handle deletion logic
 		DebugLog.Info("NodeConfig is being deleted", "name", req.NamespacedName.Name)
 
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonCleanupStarted, "removing NodeConfig from its nodes")
+
 		// Cleanup the NodeConfig instance
 		// This will remove all labels, annotations, and taints from the NodeConfig
 		// When passed to NodeUpdate, it will remove all labels, annotations, and taints from the node
 		nodeConfig.Cleanup()
-		r.Nc.NcMu.Lock()
-		r.NodeConfigs[req.NamespacedName.String()] = nodeConfig
-		r.Nc.NcMu.Unlock()
+		shared := r.share(req.NamespacedName.String(), nodeConfig)
 
 		// Cleanup up the NodeConfig instance
-		r.Nc.Notify(nc.NcMsg{
+		pctx, cancel := context.WithTimeout(ctx, processTimeout)
+		defer cancel()
+		done := make(chan struct{})
+		if err := r.Nc.Notify(pctx, nc.NcMsg{
 			Header: "Cleanup",
 			Node:   nil,
-			Config: nodeConfig.DeepCopy(),
-		})
+			Config: shared,
+			Done:   done,
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
 
 		// Wait for the NodeController to finish processing
-		r.Nc.Wg.Wait()
+		if err := waitProcessed(pctx, metrics.Node, done); err != nil {
+			controllerLog.Error(err, "NodeConfig was not removed from its nodes in time", "name", req.NamespacedName.String())
+			return ctrl.Result{}, err
+		}
 
 		r.Nc.NcMu.Lock()
 		delete(r.NodeConfigs, req.NamespacedName.String())
 		r.Nc.NcMu.Unlock()
+		metrics.Forget(metrics.Node, nodeConfig.Name)
+		r.Nc.Retries.ForgetConfig(nodeConfig.Name)
 
 		// Remove the finalizer from the NodeConfig
 		nodeConfig.RemoveFinalizer()
@@ -102,6 +134,8 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			}, err
 		}
 
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonCleanupFinished, "removed NodeConfig from its nodes")
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonFinalizerRemoved, "removed finalizer")
 		controllerLog.Info("Removed finalizer from NodeConfig", "name", req.NamespacedName.String())
 		return ctrl.Result{}, nil
 	}
@@ -116,41 +150,170 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 				Requeue: true,
 			}, err
 		}
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonFinalizerAdded, "added finalizer")
 		controllerLog.Info("Added finalizer to NodeConfig", "name", req.NamespacedName.Name)
 	}
 
+	// A scheduled NodeConfig is cleaned from its nodes outside its window, the same as when it is deleted
+	active, err := config.EvaluateSchedule(&nodeConfig.Spec.CommonSpec, &nodeConfig.Status.CommonStatus, nodeConfig.Generation, time.Now())
+	if err != nil {
+		controllerLog.Error(err, "Invalid schedule, NodeConfig will not be applied", "name", req.NamespacedName.String())
+		invalidSpecEvent(r.Recorder, nodeConfig, err)
+		return ctrl.Result{}, r.Status().Update(ctx, nodeConfig)
+	}
+
+	// Expired entries are dropped from the spec, an expired NodeConfig is cleaned from its nodes
+	expiry := config.EvaluateExpiry(&nodeConfig.Spec.CommonSpec, &nodeConfig.Status.CommonStatus, nodeConfig.CreationTimestamp.Time, nodeConfig.Generation, time.Now())
+	nodeConfig.RemoveTaints(expiry.Taints)
+
+	switch {
+	case expiry.Expired:
+		DebugLog.Info("NodeConfig has expired, cleaning", "name", req.NamespacedName.String())
+		nodeConfig.Cleanup()
+	case !active:
+		DebugLog.Info("NodeConfig is outside its window, cleaning", "name", req.NamespacedName.String())
+		nodeConfig.Cleanup()
+	}
+
+	// Invalid regexes never match, so the NodeConfig is applied to fewer nodes than intended
+	if err := nodeConfig.Spec.Selector.Validate(); err != nil {
+		controllerLog.Error(err, "Invalid selector", "name", req.NamespacedName.String())
+		invalidSpecEvent(r.Recorder, nodeConfig, err)
+	}
+
+	cleaning := expiry.Expired || !active
+	if cleaning {
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonCleanupStarted, "removing NodeConfig from its nodes")
+	}
+
 	// The NodeConfig instance is being created or updated
 	// We need to update the NodeConfig instance in the map
 	DebugLog.Info("NodeConfig found, updating map", "name", req.NamespacedName, "labels", nodeConfig.Spec.Labels)
-	r.Nc.NcMu.Lock()
-	r.NodeConfigs[req.NamespacedName.String()] = nodeConfig
-	r.Nc.NcMu.Unlock()
+	shared := r.share(req.NamespacedName.String(), nodeConfig)
+
+	if nodeConfig.DetectChange() {
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonSelectorChanged, "selector changed, removing NodeConfig from nodes that no longer match")
+	}
 
 	// Send a message to the NodeController to process the config
 	DebugLog.Info("Sending message to NodeController to apply configs", "NodeConfigs", len(r.NodeConfigs))
-	r.Nc.Notify(nc.NcMsg{
-		Header: "Reconciler",
-		Node:   nil,
-		Config: nodeConfig,
-	})
+	results := config.NewResults()
+	drains := nc.NewDrainResults()
+	rollout := &v1alpha1.RolloutStatus{}
+	pctx, cancel := context.WithTimeout(ctx, processTimeout)
+	defer cancel()
+	done := make(chan struct{})
+	if err := r.Nc.Notify(pctx, nc.NcMsg{
+		Header:  "Reconciler",
+		Node:    nil,
+		Config:  shared,
+		Results: results,
+		Drains:  drains,
+		Rollout: rollout,
+		Done:    done,
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Wait for the NodeController to finish processing
-	r.Nc.Wg.Wait()
+	if err := waitProcessed(pctx, metrics.Node, done); err != nil {
+		controllerLog.Error(err, "NodeConfig was not applied to its nodes in time", "name", req.NamespacedName.String())
+		return ctrl.Result{}, err
+	}
+
+	nodeConfig.Status.SetObjects(results.Objects())
+	metrics.SetObjects(metrics.Node, nodeConfig.Name, nodeConfig.Status.Objects)
+	nodeConfig.Status.ExhaustedRetries = r.Nc.Retries.Exhausted(nodeConfig.Name)
+	nodeConfig.Status.Drain = drains.Nodes()
+
+	// Keys set back on nodes since the last reconcile are reported and counted
+	nodeConfig.Status.RecordDrift(driftEvents(r.Recorder, nodeConfig, r.Nc.Drift.Take(nodeConfig.Name)))
+	nodeConfig.Status.ComplianceStatus(nodeConfig.Spec.GetEnforcement(), nodeConfig.Generation)
+	auditEvents(r.Recorder, nodeConfig, nodeConfig.Status.Objects)
+
+	switch {
+	case cleaning:
+		r.Recorder.Event(nodeConfig, corev1.EventTypeNormal, config.EventReasonCleanupFinished, "removed NodeConfig from its nodes")
+	case !nodeConfig.Spec.Audits():
+		applyEvents(r.Recorder, nodeConfig, &nodeConfig.Status.CommonStatus, "nodes")
+	}
 
 	controllerLog.Info("Reconciling NodeConfig complete", "name", req.NamespacedName.String())
 
+	// Record any keys lost to higher priority NodeConfigs
+	nodeConfig.ConflictStatus(r.Nc.GetConflicts(nodeConfig))
+
 	// Update the status of the NodeConfig
-	r.Nc.NcMu.Lock()
+	nodeConfig.Status.Rollout = nil
+	if nodeConfig.Spec.Rollout != nil {
+		nodeConfig.Status.Rollout = rollout
+	}
 	nodeConfig.UpdateStatus()
+
+	// The applied keys and rollout status are read by the node watcher, so they are shared once the status is complete
+	r.share(req.NamespacedName.String(), nodeConfig)
+
+	if err := r.Status().Update(ctx, nodeConfig); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The finalizer removes the expired NodeConfig, it has already been cleaned from its nodes
+	if expiry.Expired && nodeConfig.Spec.DeleteOnExpiry {
+		controllerLog.Info("Deleting expired NodeConfig", "name", req.NamespacedName.String())
+		return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, nodeConfig))
+	}
+
+	now := time.Now()
+
+	// A scheduled NodeConfig is reconciled again when its window opens or closes, and when its next entry expires
+	requeueAfter := soonest(nodeConfig.Status.WindowRequeueAfter(now), expiry.RequeueAfter)
+
+	// Audit configs are not told about changes to their nodes, so they check them again periodically
+	if nodeConfig.Spec.Audits() {
+		requeueAfter = soonest(requeueAfter, auditRequeueInterval)
+	}
+
+	// Eviction is retried until every node is drained or has timed out
+	if nodeConfig.Draining() {
+		DebugLog.Info("Nodes are still draining, requeueing", "name", req.NamespacedName.String())
+		requeueAfter = soonest(requeueAfter, drainRequeueInterval)
+	}
+
+	// The next batch of a rollout is started once the pause between batches has passed
+	if nodeConfig.RollingOut() {
+		DebugLog.Info("Rollout in progress, requeueing", "name", req.NamespacedName.String())
+		requeueAfter = soonest(requeueAfter, nc.RolloutRequeueAfter(nodeConfig, now))
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// share stores a copy of nodeConfig in NodeConfigs for the NodeController and returns it.
+// The workers read the copy without holding NcMu, so it is never changed once stored.
+// The reconciler keeps changing nodeConfig, such as dropping expired taints and recording the status.
+func (r *NodeConfigReconciler) share(key string, nodeConfig *v1alpha1.NodeConfig) *v1alpha1.NodeConfig {
+	shared := nodeConfig.DeepCopy()
+
+	r.Nc.NcMu.Lock()
+	r.NodeConfigs[key] = shared
 	r.Nc.NcMu.Unlock()
 
-	return ctrl.Result{}, r.Status().Update(ctx, nodeConfig)
+	return shared
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NodeConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	notify := make(chan event.GenericEvent, notifyQueueSize)
+
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.NodeConfig{}).
+		// When a NodeConfig spec changes, competing NodeConfigs are requeued so their Conflict condition stays current
+		Watches(&v1alpha1.NodeConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.competingConfigs),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// A NodeConfig is reconciled when the node watcher sets back keys someone else changed,
+		// or when the retries for a node are exhausted, so they are recorded in status
+		WatchesRawSource(source.Channel(notify, &handler.EnqueueRequestForObject{})).
 		Complete(r)
 
 	if err != nil {
@@ -158,14 +321,48 @@ func (r *NodeConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	r.NodeConfigs = make(map[string]*v1alpha1.NodeConfig)
+	r.Recorder = mgr.GetEventRecorderFor(eventSource)
 
 	r.K8sClient = k8s.NewK8sClient()
-	r.Nc, err = nc.NewNodeController(r.K8sClient)
+	r.Nc, err = nc.NewNodeController(r.K8sClient, r.Recorder)
 	if err != nil {
 		return err
 	}
 
+	r.Nc.Workers = r.Workers
+
+	// The informer and processor run with the manager, reconciles wait until the cache has synced
+	if err := mgr.Add(r.Nc); err != nil {
+		return err
+	}
+
 	r.Nc.NodeConfigs = r.NodeConfigs
+	notifier := configNotifier(notify, func(name string) client.Object {
+		return &v1alpha1.NodeConfig{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	})
+	r.Nc.Drift.OnDrift(notifier)
+	r.Nc.Retries.OnExhausted(notifier)
 
 	return nil
 }
+
+// competingConfigs returns a request for every other NodeConfig that competes with obj
+func (r *NodeConfigReconciler) competingConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+
+	changed, ok := obj.(*v1alpha1.NodeConfig)
+	if !ok {
+		return requests
+	}
+
+	r.Nc.NcMu.Lock()
+	defer r.Nc.NcMu.Unlock()
+
+	for _, other := range r.NodeConfigs {
+		if other.Name != changed.Name && other.Competes(changed) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: other.Name}})
+		}
+	}
+
+	return requests
+}
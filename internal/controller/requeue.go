@@ -0,0 +1,18 @@
+package controller
+
+import "time"
+
+// auditRequeueInterval is how often an Audit config checks its objects again
+const auditRequeueInterval = 5 * time.Minute
+
+// soonest returns the shortest positive duration, or 0 if there is none
+// It is used to combine the requeue intervals a config may need into a single RequeueAfter
+func soonest(durations ...time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, d := range durations {
+		if d > 0 && (shortest == 0 || d < shortest) {
+			shortest = d
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
+)
+
+// processTimeout is how long a reconcile waits for a controller to process a config
+// Work still running when it passes is cancelled and the reconcile fails, so the config is reconciled again with a backoff
+const processTimeout = 10 * time.Minute
+
+// waitProcessed waits until the message sent to controller is processed and closes done, or until ctx is done
+func waitProcessed(ctx context.Context, controller string, done <-chan struct{}) error {
+	start := time.Now()
+	defer metrics.ObserveWait(controller, start)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the %s controller: %w", controller, ctx.Err())
+	}
+}
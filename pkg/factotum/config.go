@@ -1,6 +1,21 @@
 package factotum
 
+import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 type Config interface {
 	GetAnnotationSet() map[string]string
 	GetLabelSet() map[string]string
 }
+
+// Capturer is implemented by configs whose selector regexes capture values from the selected object.
+// Named capture groups are made available to templated label and annotation values.
+type Capturer interface {
+	Captures(object v1.Object) map[string]string
+}
+
+// Templater is implemented by configs whose label and annotation values can be templates.
+type Templater interface {
+	TemplatesValues() bool
+}
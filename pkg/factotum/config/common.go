@@ -16,18 +16,42 @@ type CommonSpec struct {
 	// Labels to Apply to Selected Objects
 	// +optional
 	Labels map[string]string `json:"labels,omitempty"`
-}
-
-func ProcessMap(desiredMap, statusMap map[string]string) map[string]string {
-	// Mark all keys in the desiredMap as "" if they are not present in the statusMap
-
-	for key := range statusMap {
-		if _, exists := desiredMap[key]; !exists {
-			desiredMap[key] = ""
-		}
-	}
-
-	return desiredMap
+	// TemplateValues renders label and annotation values as Go templates for each selected object, for example {{ .Labels.pool }}.
+	// Without it values are set as written.
+	// +optional
+	TemplateValues bool `json:"templateValues,omitempty"`
+	// Priority is used when several configs select the same object and set the same key to different values.
+	// The config with the highest priority wins, configs with equal priority are ordered by name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// Schedule limits the config to a recurring maintenance window.
+	// Outside the window the config is removed from the selected objects as if it was deleted.
+	// +optional
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// TTL removes the config from the selected objects this long after the config was created
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt removes the config from the selected objects at a fixed time, it takes precedence over TTL
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// DeleteOnExpiry deletes the config once it has expired and been removed from the selected objects
+	// +optional
+	DeleteOnExpiry bool `json:"deleteOnExpiry,omitempty"`
+	// Expirations remove individual labels, annotations or taints from the selected objects
+	// +optional
+	Expirations []Expiration `json:"expirations,omitempty"`
+	// AdoptionPolicy decides what happens to a label, annotation or taint that already exists on a selected object with a different value.
+	// Adopt, the default, takes the key over and restores the previous value when the config releases it,
+	// Skip leaves the key alone and Fail leaves the key alone and reports the object as failed.
+	// +kubebuilder:default=Adopt
+	// +optional
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// Enforcement decides how the config keeps the selected objects in line with the spec.
+	// Enforce corrects every change to the keys the config sets, ApplyOnce applies the config when an object
+	// first matches and then leaves it alone, and Audit never changes objects and only reports how they differ.
+	// +kubebuilder:default=Enforce
+	// +optional
+	Enforcement Enforcement `json:"enforcement,omitempty"`
 }
 
 func (c *CommonSpec) Clean() {
@@ -52,6 +76,72 @@ type CommonStatus struct {
 	AppliedLabels map[string]string `json:"appliedLabels,omitempty"`
 	// Annotations applied to the objects
 	AppliedAnnotations map[string]string `json:"appliedAnnotations,omitempty"`
+	// Objects selected by the config and the result of the last apply to each of them
+	// +optional
+	Objects []ObjectStatus `json:"objects,omitempty"`
+	// MatchedCount is the number of objects selected by the config
+	MatchedCount int32 `json:"matchedCount"`
+	// AppliedCount is the number of selected objects the config was applied to
+	AppliedCount int32 `json:"appliedCount"`
+	// FailedCount is the number of selected objects the config failed to apply to
+	FailedCount int32 `json:"failedCount"`
+	// NonCompliantCount is the number of selected objects that differ from an Audit config
+	// +optional
+	NonCompliantCount int32 `json:"nonCompliantCount,omitempty"`
+	// Window is the state of the maintenance window when spec.schedule is set
+	// +optional
+	Window *WindowStatus `json:"window,omitempty"`
+	// ExpiresAt is when the config expires when spec.ttl or spec.expiresAt is set
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Expirations is when each entry in spec.expirations expires
+	// +optional
+	Expirations []ExpirationStatus `json:"expirations,omitempty"`
+	// DriftCount is the number of times a key set by the config was changed on an object and set back
+	// +optional
+	DriftCount int64 `json:"driftCount,omitempty"`
+	// LastDriftTime is when drift was last corrected
+	// +optional
+	LastDriftTime *metav1.Time `json:"lastDriftTime,omitempty"`
+	// RecentDrift are the most recent corrections
+	// +optional
+	RecentDrift []DriftRecord `json:"recentDrift,omitempty"`
+	// ExhaustedRetries are the objects the config still failed to apply to after every retry.
+	// An object is removed once the config is applied to it.
+	// +optional
+	ExhaustedRetries []ExhaustedRetry `json:"exhaustedRetries,omitempty"`
+}
+
+// SetObjects records the per object results and updates the matched, applied and failed counts
+// The transition time of an object is kept when its result has not changed, so an unchanged status is not rewritten
+func (s *CommonStatus) SetObjects(objects []ObjectStatus) {
+	previous := make(map[string]ObjectStatus, len(s.Objects))
+	for _, object := range s.Objects {
+		previous[object.Name] = object
+	}
+
+	for i, object := range objects {
+		if p, exists := previous[object.Name]; exists && p.Result == object.Result && p.LastError == object.LastError && slices.Equal(p.Differences, object.Differences) {
+			objects[i].LastTransitionTime = p.LastTransitionTime
+		}
+	}
+
+	s.Objects = objects
+	s.MatchedCount = int32(len(objects))
+	s.AppliedCount = 0
+	s.FailedCount = 0
+	s.NonCompliantCount = 0
+
+	for _, object := range objects {
+		switch object.Result {
+		case ResultApplied:
+			s.AppliedCount++
+		case ResultFailed:
+			s.FailedCount++
+		case ResultNonCompliant:
+			s.NonCompliantCount++
+		}
+	}
 }
 
 func RemoveFinalizer(m *metav1.ObjectMeta) {
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionConflict is set on a config that lost one or more keys to a higher priority config
+	ConditionConflict string = "Conflict"
+
+	// Kinds used to describe a disputed key
+	KindLabel      string = "label"
+	KindAnnotation string = "annotation"
+	KindTaint      string = "taint"
+)
+
+// Prioritized is implemented by configs that can be ordered when they select the same object
+type Prioritized interface {
+	GetName() string
+	GetPriority() int32
+}
+
+// ComparePriority orders configs by descending priority, configs with equal priority are ordered by name
+// It can be passed to slices.SortFunc to get a deterministic order of configs
+func ComparePriority(a, b Prioritized) int {
+	if c := cmp.Compare(b.GetPriority(), a.GetPriority()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.GetName(), b.GetName())
+}
+
+// Outranks returns true if a wins a conflict against b
+func Outranks(a, b Prioritized) bool {
+	return ComparePriority(a, b) < 0
+}
+
+// Conflict records the keys a config lost to a competing config
+type Conflict struct {
+	// Config is the name of the competing config
+	Config string
+	// Keys in dispute in the form kind/key, for example label/team
+	Keys []string
+}
+
+// Add records keys of kind that were lost to the competing config
+func (c *Conflict) Add(kind string, keys ...string) {
+	for _, key := range keys {
+		c.Keys = append(c.Keys, fmt.Sprintf("%s/%s", kind, key))
+	}
+}
+
+// DisputedKeys returns the keys in mine that theirs sets to a different value
+func DisputedKeys(mine, theirs map[string]string) []string {
+	var keys []string
+	for key, value := range mine {
+		if theirValue, exists := theirs[key]; exists && theirValue != value {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// SharesKeys returns true if a and b have any key in common
+func SharesKeys(a, b map[string]string) bool {
+	for key := range a {
+		if _, exists := b[key]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeConflicts combines conflicts with the same competing config and removes duplicate keys
+// The result is sorted by config name so it can be compared between reconciles
+func MergeConflicts(conflicts []Conflict) []Conflict {
+	byConfig := make(map[string][]string)
+	for _, c := range conflicts {
+		byConfig[c.Config] = append(byConfig[c.Config], c.Keys...)
+	}
+
+	merged := make([]Conflict, 0, len(byConfig))
+	for name, keys := range byConfig {
+		slices.Sort(keys)
+		merged = append(merged, Conflict{Config: name, Keys: slices.Compact(keys)})
+	}
+
+	slices.SortFunc(merged, func(a, b Conflict) int {
+		return cmp.Compare(a.Config, b.Config)
+	})
+
+	return merged
+}
+
+// SetConflictCondition sets the Conflict condition on conditions
+// The condition is True when the config lost keys to a competing config and names each competitor and key
+func SetConflictCondition(conditions *[]metav1.Condition, conflicts []Conflict, generation int64) {
+
+	if len(conflicts) == 0 {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               ConditionConflict,
+			Status:             metav1.ConditionFalse,
+			Reason:             "NoConflict",
+			Message:            "No competing configs",
+			ObservedGeneration: generation,
+		})
+		return
+	}
+
+	msgs := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", c.Config, strings.Join(c.Keys, ", ")))
+	}
+
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               ConditionConflict,
+		Status:             metav1.ConditionTrue,
+		Reason:             "LostToHigherPriority",
+		Message:            strings.Join(msgs, "; "),
+		ObservedGeneration: generation,
+	})
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testConfig struct {
+	name     string
+	priority int32
+}
+
+func (t testConfig) GetName() string    { return t.name }
+func (t testConfig) GetPriority() int32 { return t.priority }
+
+func TestComparePriority(t *testing.T) {
+	configs := []testConfig{
+		{name: "b", priority: 0},
+		{name: "c", priority: 10},
+		{name: "a", priority: 0},
+	}
+
+	slices.SortFunc(configs, func(a, b testConfig) int {
+		return ComparePriority(a, b)
+	})
+
+	expected := []string{"c", "a", "b"}
+	for i, c := range configs {
+		if c.name != expected[i] {
+			t.Errorf("expected %s at index %d, got %s", expected[i], i, c.name)
+		}
+	}
+
+	if !Outranks(configs[0], configs[1]) || Outranks(configs[2], configs[1]) {
+		t.Errorf("unexpected ranking %v", configs)
+	}
+}
+
+func TestDisputedKeys(t *testing.T) {
+	mine := map[string]string{"key1": "value1", "key2": "value2", "key3": "value3"}
+	theirs := map[string]string{"key1": "value1", "key2": "other", "key3": ""}
+
+	expected := []string{"key2", "key3"}
+	if got := DisputedKeys(mine, theirs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := DisputedKeys(nil, theirs); len(got) != 0 {
+		t.Errorf("expected no disputed keys, got %v", got)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	a := Conflict{Config: "b-config"}
+	a.Add(KindLabel, "team")
+	b := Conflict{Config: "a-config"}
+	b.Add(KindTaint, "dedicated")
+	c := Conflict{Config: "b-config"}
+	c.Add(KindLabel, "team", "zone")
+
+	expected := []Conflict{
+		{Config: "a-config", Keys: []string{"taint/dedicated"}},
+		{Config: "b-config", Keys: []string{"label/team", "label/zone"}},
+	}
+
+	if got := MergeConflicts([]Conflict{a, b, c}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSetConflictCondition(t *testing.T) {
+	var conditions []metav1.Condition
+
+	SetConflictCondition(&conditions, []Conflict{{Config: "winner", Keys: []string{"label/team"}}}, 1)
+
+	condition := meta.FindStatusCondition(conditions, ConditionConflict)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Fatalf("expected Conflict condition to be true, got %+v", condition)
+	}
+
+	if condition.Message != "winner: label/team" {
+		t.Errorf("expected message to name the competing config and keys, got %s", condition.Message)
+	}
+
+	SetConflictCondition(&conditions, nil, 2)
+
+	if len(conditions) != 1 || meta.IsStatusConditionTrue(conditions, ConditionConflict) {
+		t.Errorf("expected Conflict condition to be cleared, got %+v", conditions)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxRecentDrift is how many corrections are kept in status.recentDrift
+const maxRecentDrift = 10
+
+// DriftRecord is a single correction of a key that was changed on an object after the config set it
+// +k8s:deepcopy-gen=true
+type DriftRecord struct {
+	// Object is the name of the corrected object
+	Object string `json:"object"`
+	// Kind is label, annotation or taint, or the kind of an object the config created in a namespace
+	Kind string `json:"kind"`
+	// Key of the label or annotation, key:effect of the taint, or the name of the created object
+	Key string `json:"key"`
+	// OldValue is the value found on the object
+	// +optional
+	OldValue string `json:"oldValue,omitempty"`
+	// Removed is true when the key had been removed from the object
+	// +optional
+	Removed bool `json:"removed,omitempty"`
+	// Recreated is true when an object created by the config in the namespace named by Object had been deleted
+	// and was created again
+	// +optional
+	Recreated bool `json:"recreated,omitempty"`
+	// NewValue is the value the config set back
+	NewValue string `json:"newValue"`
+	// Time is when the drift was corrected
+	Time metav1.Time `json:"time"`
+}
+
+// String describes the correction, for example label team on worker-1 was "b", set back to "a"
+func (d DriftRecord) String() string {
+	if d.Recreated {
+		return fmt.Sprintf("%s %s in %s was deleted, created again", d.Kind, d.Key, d.Object)
+	}
+	if d.Removed {
+		return fmt.Sprintf("%s %s on %s was removed, set back to %q", d.Kind, d.Key, d.Object, d.NewValue)
+	}
+	return fmt.Sprintf("%s %s on %s was %q, set back to %q", d.Kind, d.Key, d.Object, d.OldValue, d.NewValue)
+}
+
+// RecordDrift adds corrections to the drift count and the most recent corrections
+func (s *CommonStatus) RecordDrift(records []DriftRecord) {
+	for _, record := range records {
+		s.DriftCount++
+		if s.LastDriftTime == nil || record.Time.After(s.LastDriftTime.Time) {
+			s.LastDriftTime = record.Time.DeepCopy()
+		}
+		s.RecentDrift = append(s.RecentDrift, record)
+	}
+
+	if len(s.RecentDrift) > maxRecentDrift {
+		s.RecentDrift = s.RecentDrift[len(s.RecentDrift)-maxRecentDrift:]
+	}
+}
+
+// Drift is a correction and the object it was made to, the reference is used to report the drift on the object
+type Drift struct {
+	Record DriftRecord
+	Object *corev1.ObjectReference
+}
+
+// Drifts returns the drift found by claims as corrections made to object at now
+func Drifts(object *corev1.ObjectReference, now time.Time, claims ...Claim) []Drift {
+	var drifts []Drift
+	for _, claim := range claims {
+		for _, record := range claim.Drift {
+			record.Object = object.Name
+			record.Time = metav1.NewTime(now)
+			drifts = append(drifts, Drift{Record: record, Object: object})
+		}
+	}
+	return drifts
+}
+
+// Drifted returns true if any of claims found an owned key that was changed by someone else
+// Setting those keys back conflicts with the field manager that changed them, so the apply has to take them over
+func Drifted(claims ...Claim) bool {
+	for _, claim := range claims {
+		if len(claim.Drift) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DriftLog holds corrections made by a controller until the reconciler of the config records them in status
+type DriftLog struct {
+	mu      sync.Mutex
+	pending map[string][]Drift
+	notify  func(configName string)
+}
+
+func NewDriftLog() *DriftLog {
+	return &DriftLog{
+		pending: make(map[string][]Drift),
+	}
+}
+
+// OnDrift sets the function called with the name of a config whenever drift is recorded for it
+func (d *DriftLog) OnDrift(notify func(configName string)) {
+	d.mu.Lock()
+	d.notify = notify
+	d.mu.Unlock()
+}
+
+// Record stores corrections made for the named config and notifies its reconciler
+// A nil DriftLog is ignored
+func (d *DriftLog) Record(configName string, drifts []Drift) {
+	if d == nil || len(drifts) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	d.pending[configName] = append(d.pending[configName], drifts...)
+	notify := d.notify
+	d.mu.Unlock()
+
+	if notify != nil {
+		notify(configName)
+	}
+}
+
+// Take returns and forgets the corrections stored for the named config
+func (d *DriftLog) Take(configName string) []Drift {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	drifts := d.pending[configName]
+	delete(d.pending, configName)
+
+	return drifts
+}
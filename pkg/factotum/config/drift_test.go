@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClaimKeysDrift(t *testing.T) {
+	record := OwnershipRecord{Labels: map[string]OwnedValue{
+		"team": {Value: "a"},
+		"zone": {Value: "1"},
+		"pool": {Value: "gpu"},
+	}}
+
+	// team was changed and zone removed by someone else, pool was changed in the config
+	current := map[string]string{"team": "b", "pool": "gpu"}
+	desired := map[string]string{"team": "a", "zone": "1", "pool": "cpu"}
+
+	claim := ClaimKeys(KindLabel, current, desired, record, nil, nil, AdoptionFail)
+
+	if len(claim.Drift) != 2 {
+		t.Fatalf("expected 2 drifted keys, got %+v", claim.Drift)
+	}
+
+	if claim.Drift[0].Key != "team" || claim.Drift[0].OldValue != "b" || claim.Drift[0].NewValue != "a" {
+		t.Errorf("unexpected drift %+v", claim.Drift[0])
+	}
+
+	if claim.Drift[1].Key != "zone" || !claim.Drift[1].Removed {
+		t.Errorf("unexpected drift %+v", claim.Drift[1])
+	}
+
+	if !Drifted(ClaimKeys(KindAnnotation, nil, nil, record, nil, nil, AdoptionFail), claim) {
+		t.Errorf("expected the claims to have drifted")
+	}
+	unchanged := map[string]string{"team": "a", "zone": "1", "pool": "gpu"}
+	if Drifted(ClaimKeys(KindLabel, unchanged, unchanged, record, nil, nil, AdoptionFail)) {
+		t.Errorf("expected no drift when every key has the value the config set")
+	}
+}
+
+func TestDriftLog(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	object := &corev1.ObjectReference{Kind: "Node", Name: "worker-1"}
+	claim := Claim{Drift: []DriftRecord{{Kind: KindLabel, Key: "team", OldValue: "b", NewValue: "a"}}}
+
+	var notified []string
+	log := NewDriftLog()
+	log.OnDrift(func(name string) {
+		notified = append(notified, name)
+	})
+
+	log.Record("config-a", Drifts(object, now, claim))
+	log.Record("config-a", nil)
+
+	if len(notified) != 1 || notified[0] != "config-a" {
+		t.Errorf("expected config-a to be notified once, got %v", notified)
+	}
+
+	drifts := log.Take("config-a")
+	if len(drifts) != 1 || drifts[0].Record.Object != "worker-1" || !drifts[0].Record.Time.Time.Equal(now) {
+		t.Fatalf("unexpected drifts %+v", drifts)
+	}
+
+	if len(log.Take("config-a")) != 0 {
+		t.Errorf("expected taken drift to be forgotten")
+	}
+
+	// A nil DriftLog is safe to use
+	var none *DriftLog
+	none.Record("config-a", drifts)
+	if none.Take("config-a") != nil {
+		t.Errorf("expected a nil drift log to return no drift")
+	}
+}
+
+func TestRecordDrift(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	status := CommonStatus{}
+
+	var records []DriftRecord
+	for i := range maxRecentDrift + 2 {
+		records = append(records, DriftRecord{Object: "worker-1", Kind: KindLabel, Key: "team", NewValue: "a", Time: metav1.NewTime(start.Add(time.Duration(i) * time.Minute))})
+	}
+
+	status.RecordDrift(records)
+
+	if status.DriftCount != int64(maxRecentDrift+2) {
+		t.Errorf("expected drift count %d, got %d", maxRecentDrift+2, status.DriftCount)
+	}
+
+	if len(status.RecentDrift) != maxRecentDrift {
+		t.Errorf("expected %d recent corrections, got %d", maxRecentDrift, len(status.RecentDrift))
+	}
+
+	if !status.LastDriftTime.Time.Equal(records[len(records)-1].Time.Time) {
+		t.Errorf("expected the last drift time to be the latest correction, got %v", status.LastDriftTime)
+	}
+}
+
+func TestDriftRecordString(t *testing.T) {
+	tests := []struct {
+		record   DriftRecord
+		expected string
+	}{
+		{
+			record:   DriftRecord{Object: "worker-1", Kind: KindLabel, Key: "team", OldValue: "b", NewValue: "a"},
+			expected: `label team on worker-1 was "b", set back to "a"`,
+		},
+		{
+			record:   DriftRecord{Object: "worker-1", Kind: KindLabel, Key: "team", Removed: true, NewValue: "a"},
+			expected: `label team on worker-1 was removed, set back to "a"`,
+		},
+		{
+			record:   DriftRecord{Object: "team-a", Kind: "NetworkPolicy", Key: "default-deny", Recreated: true},
+			expected: "NetworkPolicy default-deny in team-a was deleted, created again",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.record.String(); got != tt.expected {
+			t.Errorf("String() = %q, want %q", got, tt.expected)
+		}
+	}
+}
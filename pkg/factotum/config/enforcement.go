@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionCompliant reports whether every object selected by an Audit config matches it
+const ConditionCompliant = "Compliant"
+
+// AppliedAnnotationPrefix is the prefix of the annotation an ApplyOnce config marks the objects it was applied to with
+const AppliedAnnotationPrefix = "applied.factotum.io/"
+
+// Enforcement decides how a config keeps its objects in line with the spec
+// +kubebuilder:validation:Enum=Enforce;ApplyOnce;Audit
+type Enforcement string
+
+const (
+	// EnforcementEnforce applies the config and corrects every change to the keys it sets
+	EnforcementEnforce Enforcement = "Enforce"
+	// EnforcementApplyOnce applies the config when an object first matches and then leaves the object alone
+	EnforcementApplyOnce Enforcement = "ApplyOnce"
+	// EnforcementAudit never changes objects and only reports how they differ from the config
+	EnforcementAudit Enforcement = "Audit"
+)
+
+// GetEnforcement returns the enforcement mode of the config, defaulting to Enforce
+func (c *CommonSpec) GetEnforcement() Enforcement {
+	if c.Enforcement == "" {
+		return EnforcementEnforce
+	}
+	return c.Enforcement
+}
+
+// Audits returns true if the config only reports differences
+func (c *CommonSpec) Audits() bool {
+	return c.GetEnforcement() == EnforcementAudit
+}
+
+// CleanupEnforcement makes a cleaned ApplyOnce config remove what it applied.
+// Audit configs have never changed their objects, so there is nothing for them to remove.
+func (c *CommonSpec) CleanupEnforcement() {
+	if c.Enforcement == EnforcementApplyOnce {
+		c.Enforcement = EnforcementEnforce
+	}
+}
+
+// AppliedAnnotation returns the annotation that marks an object the named ApplyOnce config was applied to
+func AppliedAnnotation(configName string) string {
+	return configAnnotation(AppliedAnnotationPrefix, configName)
+}
+
+// MarkApplied adds the applied annotation of an ApplyOnce config to annotations.
+// The object is marked even when the config owns none of its keys, so it is not applied to again.
+func (c *CommonSpec) MarkApplied(annotations map[string]string, configName string) {
+	if c.GetEnforcement() == EnforcementApplyOnce {
+		annotations[AppliedAnnotation(configName)] = "true"
+	}
+}
+
+// AppliedOnce returns true if an ApplyOnce config has already been applied to an object with annotations
+// Objects applied to before the applied annotation existed only have the ownership record of the config
+func (c *CommonSpec) AppliedOnce(annotations map[string]string, configName string) bool {
+	if c.GetEnforcement() != EnforcementApplyOnce {
+		return false
+	}
+
+	_, applied := annotations[AppliedAnnotation(configName)]
+	_, owned := annotations[OwnershipAnnotation(configName)]
+	return applied || owned
+}
+
+// Differences describes each key of kind where current does not match desired, for example label team is "b", want "a"
+func Differences(kind string, current, desired map[string]string) []string {
+	var differences []string
+
+	for _, key := range slices.Sorted(maps.Keys(desired)) {
+		switch value, exists := current[key]; {
+		case !exists:
+			differences = append(differences, fmt.Sprintf("%s %s is missing, want %q", kind, key, desired[key]))
+		case value != desired[key]:
+			differences = append(differences, fmt.Sprintf("%s %s is %q, want %q", kind, key, value, desired[key]))
+		}
+	}
+
+	return differences
+}
+
+// ComplianceStatus sets the Compliant condition of an Audit config from its object results.
+// The condition is removed from configs that are not audited.
+func (s *CommonStatus) ComplianceStatus(enforcement Enforcement, generation int64) {
+	if enforcement != EnforcementAudit {
+		meta.RemoveStatusCondition(&s.Conditions, ConditionCompliant)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               ConditionCompliant,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Compliant",
+		Message:            fmt.Sprintf("%d objects match the config", s.MatchedCount),
+		ObservedGeneration: generation,
+	}
+
+	if s.NonCompliantCount > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NonCompliant"
+		condition.Message = fmt.Sprintf("%d of %d objects differ from the config", s.NonCompliantCount, s.MatchedCount)
+	}
+
+	meta.SetStatusCondition(&s.Conditions, condition)
+}
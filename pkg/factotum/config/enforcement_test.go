@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+func TestDifferences(t *testing.T) {
+	current := map[string]string{"team": "b", "zone": "1", "other": "x"}
+	desired := map[string]string{"team": "a", "zone": "1", "pool": "gpu"}
+
+	expected := []string{
+		`label pool is missing, want "gpu"`,
+		`label team is "b", want "a"`,
+	}
+
+	if got := Differences(KindLabel, current, desired); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestAppliedOnce(t *testing.T) {
+	annotations := map[string]string{OwnershipAnnotation("config-a"): "{}"}
+
+	spec := CommonSpec{Enforcement: EnforcementApplyOnce}
+	if !spec.AppliedOnce(annotations, "config-a") {
+		t.Errorf("expected an ApplyOnce config with an ownership record to have been applied")
+	}
+	if spec.AppliedOnce(annotations, "config-b") {
+		t.Errorf("expected an ApplyOnce config without an ownership record to not have been applied")
+	}
+
+	// A config that owns no keys is marked as applied
+	marked := make(map[string]string)
+	spec.MarkApplied(marked, "config-b")
+	if !spec.AppliedOnce(marked, "config-b") {
+		t.Errorf("expected an ApplyOnce config marked as applied to have been applied")
+	}
+
+	spec.CleanupEnforcement()
+	spec.MarkApplied(marked, "config-c")
+	if _, exists := marked[AppliedAnnotation("config-c")]; exists {
+		t.Errorf("expected a cleaned ApplyOnce config to not mark objects as applied")
+	}
+	if spec.AppliedOnce(annotations, "config-a") {
+		t.Errorf("expected a cleaned ApplyOnce config to be enforced")
+	}
+
+	audit := CommonSpec{Enforcement: EnforcementAudit}
+	audit.CleanupEnforcement()
+	if !audit.Audits() {
+		t.Errorf("expected a cleaned Audit config to keep auditing")
+	}
+}
+
+func TestComplianceStatus(t *testing.T) {
+	status := CommonStatus{}
+	status.SetObjects([]ObjectStatus{
+		{Name: "a", Result: ResultCompliant},
+		{Name: "b", Result: ResultNonCompliant, Differences: []string{`label team is missing, want "a"`}},
+	})
+
+	if status.NonCompliantCount != 1 {
+		t.Errorf("expected 1 non compliant object, got %d", status.NonCompliantCount)
+	}
+
+	status.ComplianceStatus(EnforcementAudit, 1)
+	if condition := meta.FindStatusCondition(status.Conditions, ConditionCompliant); condition == nil || condition.Reason != "NonCompliant" {
+		t.Errorf("expected the Compliant condition to be false, got %+v", condition)
+	}
+
+	status.ComplianceStatus(EnforcementEnforce, 1)
+	if meta.FindStatusCondition(status.Conditions, ConditionCompliant) != nil {
+		t.Errorf("expected the Compliant condition to be removed from enforced configs")
+	}
+}
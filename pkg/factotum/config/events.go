@@ -0,0 +1,15 @@
+package config
+
+// Reasons of the events factotum records on configs and the objects they select
+const (
+	EventReasonFinalizerAdded   = "FinalizerAdded"
+	EventReasonFinalizerRemoved = "FinalizerRemoved"
+	EventReasonApplied          = "Applied"
+	EventReasonApplyFailed      = "ApplyFailed"
+	EventReasonCleanupStarted   = "CleanupStarted"
+	EventReasonCleanupFinished  = "CleanupFinished"
+	EventReasonSelectorChanged  = "SelectorChanged"
+	EventReasonInvalidSpec      = "InvalidSpec"
+	EventReasonNonCompliant     = "NonCompliant"
+	EventReasonDrift            = "Drift"
+)
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionExpired reports whether a config has passed its expiry
+const ConditionExpired = "Expired"
+
+// ExpirationKind is the kind of entry an Expiration applies to
+// +kubebuilder:validation:Enum=Label;Annotation;Taint
+type ExpirationKind string
+
+const (
+	ExpirationLabel      ExpirationKind = "Label"
+	ExpirationAnnotation ExpirationKind = "Annotation"
+	ExpirationTaint      ExpirationKind = "Taint"
+)
+
+// Expiration removes a single label, annotation or taint from the selected objects after a TTL or at a fixed time
+// +k8s:deepcopy-gen=true
+// +kubebuilder:validation:XValidation:rule="has(self.ttl) != has(self.expiresAt)",message="exactly one of ttl or expiresAt must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.effect) || self.kind == 'Taint'",message="effect is only used by taint expirations"
+type Expiration struct {
+	// Kind is Label, Annotation or Taint
+	Kind ExpirationKind `json:"kind"`
+	// Key of the label, annotation or taint
+	Key string `json:"key"`
+	// Effect of the taint, a taint expiration without an effect expires the key with every effect
+	// +kubebuilder:validation:Enum=NoSchedule;PreferNoSchedule;NoExecute
+	// +optional
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+	// TTL is how long the entry is kept after the controller first sees the expiration
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt is when the entry is removed
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// ExpirationStatus is when a single entry expires
+// +k8s:deepcopy-gen=true
+type ExpirationStatus struct {
+	// Kind is Label, Annotation or Taint
+	Kind ExpirationKind `json:"kind"`
+	// Key of the label, annotation or taint
+	Key string `json:"key"`
+	// Effect of the taint, empty for every effect
+	// +optional
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+	// ExpiresAt is when the entry is removed
+	ExpiresAt metav1.Time `json:"expiresAt"`
+	// Expired is true once the entry has been removed
+	Expired bool `json:"expired"`
+}
+
+// ExpiryResult is the outcome of evaluating the expiry of a config
+type ExpiryResult struct {
+	// Expired is true when the whole config has expired and should be cleaned from its objects
+	Expired bool
+	// Taints are the expired taints by key and effect, removing them is left to configs that have taints.
+	// A taint with no effect expires the key with every effect.
+	Taints []corev1.Taint
+	// RequeueAfter is how long until the next entry or the config expires, 0 if nothing will expire
+	RequeueAfter time.Duration
+}
+
+// EvaluateExpiry removes expired labels and annotations from spec and records when the config and its entries expire in status.
+// A config TTL counts from created, an entry TTL counts from when the entry was first evaluated.
+func EvaluateExpiry(spec *CommonSpec, status *CommonStatus, created time.Time, generation int64, now time.Time) ExpiryResult {
+	var result ExpiryResult
+	var next time.Time
+
+	// soonest future expiry, used to requeue at the next expiry rather than polling
+	upcoming := func(at time.Time) {
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+
+	status.ExpiresAt = nil
+	switch {
+	case spec.ExpiresAt != nil:
+		status.ExpiresAt = spec.ExpiresAt.DeepCopy()
+	case spec.TTL != nil:
+		expiresAt := metav1.NewTime(created.Add(spec.TTL.Duration))
+		status.ExpiresAt = &expiresAt
+	}
+
+	if status.ExpiresAt != nil {
+		result.Expired = !now.Before(status.ExpiresAt.Time)
+		upcoming(status.ExpiresAt.Time)
+	}
+
+	previous := make(map[string]ExpirationStatus, len(status.Expirations))
+	for _, entry := range status.Expirations {
+		previous[expirationKey(entry.Kind, entry.Key, entry.Effect)] = entry
+	}
+
+	var expired []string
+	entries := make([]ExpirationStatus, 0, len(spec.Expirations))
+
+	for _, expiration := range spec.Expirations {
+		entry := ExpirationStatus{Kind: expiration.Kind, Key: expiration.Key, Effect: expiration.Effect}
+		key := expirationKey(expiration.Kind, expiration.Key, expiration.Effect)
+
+		switch p, exists := previous[key]; {
+		case expiration.ExpiresAt != nil:
+			entry.ExpiresAt = *expiration.ExpiresAt.DeepCopy()
+		case exists:
+			entry.ExpiresAt = p.ExpiresAt
+		case expiration.TTL != nil:
+			entry.ExpiresAt = metav1.NewTime(now.Add(expiration.TTL.Duration))
+		default:
+			continue
+		}
+
+		entry.Expired = !now.Before(entry.ExpiresAt.Time)
+		upcoming(entry.ExpiresAt.Time)
+
+		if entry.Expired {
+			expired = append(expired, key)
+
+			switch expiration.Kind {
+			case ExpirationLabel:
+				delete(spec.Labels, expiration.Key)
+			case ExpirationAnnotation:
+				delete(spec.Annotations, expiration.Key)
+			case ExpirationTaint:
+				result.Taints = append(result.Taints, corev1.Taint{Key: expiration.Key, Effect: expiration.Effect})
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	status.Expirations = nil
+	if len(entries) > 0 {
+		status.Expirations = entries
+	}
+
+	if !result.Expired && !next.IsZero() {
+		// Requeue just after the expiry so the entry has expired when the config is reconciled
+		result.RequeueAfter = next.Sub(now) + time.Second
+	}
+
+	setExpiredCondition(&status.Conditions, result.Expired, expired, status.ExpiresAt != nil || len(entries) > 0, generation)
+
+	return result
+}
+
+// setExpiredCondition sets the Expired condition, it is removed from configs that have nothing that expires
+func setExpiredCondition(conditions *[]metav1.Condition, expired bool, entries []string, expires bool, generation int64) {
+	if !expires {
+		meta.RemoveStatusCondition(conditions, ConditionExpired)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               ConditionExpired,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NotExpired",
+		Message:            "config has not expired",
+		ObservedGeneration: generation,
+	}
+
+	switch {
+	case expired:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ConfigExpired"
+		condition.Message = "config has expired and was removed from its objects"
+	case len(entries) > 0:
+		condition.Reason = "EntriesExpired"
+		condition.Message = fmt.Sprintf("expired entries removed: %s", strings.Join(entries, ", "))
+	}
+
+	meta.SetStatusCondition(conditions, condition)
+}
+
+// expirationKey formats an entry as kind/key, for example Label/debugging
+// Taints with an effect are formatted as kind/key:effect, for example Taint/maintenance:NoSchedule
+func expirationKey(kind ExpirationKind, key string, effect corev1.TaintEffect) string {
+	if effect != "" {
+		return fmt.Sprintf("%s/%s:%s", kind, key, effect)
+	}
+	return fmt.Sprintf("%s/%s", kind, key)
+}
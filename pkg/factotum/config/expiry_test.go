@@ -0,0 +1,127 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluateExpiry(t *testing.T) {
+	created := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := created.Add(2 * time.Hour)
+	past := metav1.NewTime(now.Add(-time.Minute))
+
+	spec := CommonSpec{
+		Labels:      map[string]string{"debugging": "true", "team": "a"},
+		Annotations: map[string]string{"note": "temporary"},
+		TTL:         &metav1.Duration{Duration: 24 * time.Hour},
+		Expirations: []Expiration{
+			{Kind: ExpirationLabel, Key: "debugging", TTL: &metav1.Duration{Duration: time.Hour}},
+			{Kind: ExpirationAnnotation, Key: "note", ExpiresAt: &past},
+			{Kind: ExpirationTaint, Key: "maintenance", ExpiresAt: &past},
+		},
+	}
+	status := CommonStatus{}
+
+	// The label TTL starts when the entry is first seen
+	result := EvaluateExpiry(&spec, &status, created, 1, now)
+	if result.Expired {
+		t.Fatalf("expected the config to not be expired")
+	}
+
+	if _, exists := spec.Labels["debugging"]; !exists {
+		t.Errorf("expected the label to be kept until its ttl passes")
+	}
+
+	if _, exists := spec.Annotations["note"]; exists {
+		t.Errorf("expected the expired annotation to be removed")
+	}
+
+	if len(result.Taints) != 1 || result.Taints[0].Key != "maintenance" || result.Taints[0].Effect != "" {
+		t.Errorf("expected the maintenance taint to expire, got %v", result.Taints)
+	}
+
+	if result.RequeueAfter != time.Hour+time.Second {
+		t.Errorf("expected to requeue when the label expires, got %v", result.RequeueAfter)
+	}
+
+	if condition := meta.FindStatusCondition(status.Conditions, ConditionExpired); condition == nil || condition.Reason != "EntriesExpired" {
+		t.Errorf("expected the Expired condition to list the expired entries, got %+v", condition)
+	}
+
+	// The deadline recorded in status is kept on later evaluations
+	later := now.Add(time.Hour)
+	result = EvaluateExpiry(&spec, &status, created, 1, later)
+	if _, exists := spec.Labels["debugging"]; exists {
+		t.Errorf("expected the label to be removed once its ttl has passed")
+	}
+
+	if spec.Labels["team"] != "a" {
+		t.Errorf("expected labels without an expiration to be kept")
+	}
+
+	if result.RequeueAfter != 21*time.Hour+time.Second {
+		t.Errorf("expected to requeue when the config expires, got %v", result.RequeueAfter)
+	}
+
+	// The config ttl counts from creation
+	result = EvaluateExpiry(&spec, &status, created, 1, created.Add(25*time.Hour))
+	if !result.Expired || result.RequeueAfter != 0 {
+		t.Errorf("expected the config to be expired with no requeue, got %+v", result)
+	}
+
+	if !meta.IsStatusConditionTrue(status.Conditions, ConditionExpired) {
+		t.Errorf("expected the Expired condition to be true")
+	}
+}
+
+func TestEvaluateExpiryNothingExpires(t *testing.T) {
+	spec := CommonSpec{Labels: map[string]string{"team": "a"}}
+	status := CommonStatus{
+		Conditions: []metav1.Condition{{Type: ConditionExpired, Status: metav1.ConditionFalse, Reason: "NotExpired"}},
+	}
+
+	result := EvaluateExpiry(&spec, &status, time.Now(), 1, time.Now())
+	if result.Expired || result.RequeueAfter != 0 || len(result.Taints) != 0 {
+		t.Errorf("expected nothing to expire, got %+v", result)
+	}
+
+	if status.ExpiresAt != nil || status.Expirations != nil || meta.FindStatusCondition(status.Conditions, ConditionExpired) != nil {
+		t.Errorf("expected the expiry status to be cleared")
+	}
+}
+
+func TestEvaluateExpiryTaintEffects(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	past := metav1.NewTime(now.Add(-time.Minute))
+
+	// The same key expires with one effect and is kept with the other
+	spec := CommonSpec{
+		Expirations: []Expiration{
+			{Kind: ExpirationTaint, Key: "maintenance", Effect: corev1.TaintEffectNoSchedule, ExpiresAt: &past},
+			{Kind: ExpirationTaint, Key: "maintenance", Effect: corev1.TaintEffectNoExecute, TTL: &metav1.Duration{Duration: time.Hour}},
+		},
+	}
+	status := CommonStatus{}
+
+	result := EvaluateExpiry(&spec, &status, now, 1, now)
+
+	want := []corev1.Taint{{Key: "maintenance", Effect: corev1.TaintEffectNoSchedule}}
+	if !reflect.DeepEqual(result.Taints, want) {
+		t.Errorf("expected only maintenance:NoSchedule to expire, got %v", result.Taints)
+	}
+
+	if len(status.Expirations) != 2 || !status.Expirations[0].Expired || status.Expirations[1].Expired {
+		t.Fatalf("expected an expiry per effect, got %+v", status.Expirations)
+	}
+
+	// The ttl of each effect is kept separately on later evaluations
+	result = EvaluateExpiry(&spec, &status, now, 1, now.Add(30*time.Minute))
+	if len(result.Taints) != 1 || status.Expirations[1].ExpiresAt.Time != now.Add(time.Hour) {
+		t.Errorf("expected the NoExecute ttl to count from the first evaluation, got %+v", status.Expirations)
+	}
+}
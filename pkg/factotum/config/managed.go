@@ -0,0 +1,16 @@
+package config
+
+const (
+	// ManagedByLabel is set to ManagedBy on every object a config creates
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedBy is the value of ManagedByLabel on objects created by factotum
+	ManagedBy = "factotum"
+	// ManagedConfigAnnotation is set to the name of the config that created an object
+	// Objects are only deleted by the config named in the annotation
+	ManagedConfigAnnotation = "factotum.io/config"
+)
+
+// ManagedByConfig returns true if the object with annotations was created by the named config
+func ManagedByConfig(annotations map[string]string, configName string) bool {
+	return annotations[ManagedConfigAnnotation] == configName
+}
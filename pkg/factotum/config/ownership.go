@@ -0,0 +1,246 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// OwnershipAnnotationPrefix is the prefix of the annotation each config keeps its ownership record in
+const OwnershipAnnotationPrefix = "ownership.factotum.io/"
+
+// AdoptionPolicy decides what a config does with a key that already exists on an object with a different value
+// +kubebuilder:validation:Enum=Adopt;Skip;Fail
+type AdoptionPolicy string
+
+const (
+	// AdoptionAdopt takes over the key, the previous value is restored when the config releases it
+	AdoptionAdopt AdoptionPolicy = "Adopt"
+	// AdoptionSkip leaves the existing value alone
+	AdoptionSkip AdoptionPolicy = "Skip"
+	// AdoptionFail leaves the existing value alone and reports the object as failed
+	AdoptionFail AdoptionPolicy = "Fail"
+)
+
+// GetAdoptionPolicy returns the adoption policy of the config, defaulting to Adopt
+func (c *CommonSpec) GetAdoptionPolicy() AdoptionPolicy {
+	if c.AdoptionPolicy == "" {
+		return AdoptionAdopt
+	}
+	return c.AdoptionPolicy
+}
+
+// OwnedValue is a key set by a config and the value it replaced
+type OwnedValue struct {
+	// Value set by the config
+	Value string `json:"value"`
+	// Previous value of the key, nil if the config added the key
+	Previous *string `json:"previous,omitempty"`
+}
+
+// OwnershipRecord is the set of keys a config has set on a single object
+// Taints are keyed by key:effect
+type OwnershipRecord struct {
+	Labels      map[string]OwnedValue `json:"labels,omitempty"`
+	Annotations map[string]OwnedValue `json:"annotations,omitempty"`
+	Taints      map[string]OwnedValue `json:"taints,omitempty"`
+}
+
+// IsEmpty returns true if the record does not own any keys
+func (r OwnershipRecord) IsEmpty() bool {
+	return len(r.Labels) == 0 && len(r.Annotations) == 0 && len(r.Taints) == 0
+}
+
+// Keys returns the owned keys of kind, which is KindLabel, KindAnnotation or KindTaint
+func (r OwnershipRecord) Keys(kind string) map[string]OwnedValue {
+	switch kind {
+	case KindLabel:
+		return r.Labels
+	case KindAnnotation:
+		return r.Annotations
+	case KindTaint:
+		return r.Taints
+	}
+	return nil
+}
+
+// Encode returns the record as the value of its ownership annotation
+func (r OwnershipRecord) Encode() string {
+	// Maps are marshalled with sorted keys so the annotation is stable between applies
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// OwnershipAnnotation returns the annotation the named config keeps its ownership record in
+func OwnershipAnnotation(configName string) string {
+	return configAnnotation(OwnershipAnnotationPrefix, configName)
+}
+
+// configAnnotation returns the annotation with prefix for the named config
+// Names that are not valid annotation names are replaced with a hash of the name
+func configAnnotation(prefix, configName string) string {
+	if len(validation.IsQualifiedName(prefix+configName)) == 0 {
+		return prefix + configName
+	}
+
+	sum := sha256.Sum256([]byte(configName))
+	return prefix + hex.EncodeToString(sum[:])[:32]
+}
+
+// IsOwnershipAnnotation returns true if key is the ownership record of any config
+func IsOwnershipAnnotation(key string) bool {
+	return strings.HasPrefix(key, OwnershipAnnotationPrefix)
+}
+
+// ReadOwnershipRecords returns the record of the named config and the records of every other config found in annotations
+// Records that cannot be decoded are treated as empty
+func ReadOwnershipRecords(annotations map[string]string, configName string) (OwnershipRecord, []OwnershipRecord) {
+	var mine OwnershipRecord
+	var others []OwnershipRecord
+
+	own := OwnershipAnnotation(configName)
+
+	// Records are read in order so the first other owner of a key is always the same config
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		if !IsOwnershipAnnotation(key) {
+			continue
+		}
+
+		var record OwnershipRecord
+		if err := json.Unmarshal([]byte(annotations[key]), &record); err != nil {
+			continue
+		}
+
+		if key == own {
+			mine = record
+		} else {
+			others = append(others, record)
+		}
+	}
+
+	return mine, others
+}
+
+// Claim is the outcome of claiming the keys of one kind on an object
+type Claim struct {
+	// Apply are the keys and values the config sets
+	Apply map[string]string
+	// Owned is the ownership record for the kind after the claim
+	Owned map[string]OwnedValue
+	// Restore are keys the config releases and the previous value to set them back to
+	Restore map[string]string
+	// Remove are keys the config added and releases
+	Remove []string
+	// Drift are owned keys that were changed on the object since the config set them, Object and Time are left to the caller
+	Drift []DriftRecord
+	// Err reports keys that were not claimed because of the Fail adoption policy
+	Err error
+}
+
+// ClaimKeys decides which desired keys a config sets on an object and what happens to the keys it no longer wants.
+//
+// current are the keys of kind on the object, record is the ownership record of the config and others the records of other configs on the object.
+// legacy are keys the config set before ownership records existed, they are treated as added by the config.
+//
+// A key the config does not own yet is claimed when it is missing, owned by another config or already has the desired value.
+// A key that already has the desired value has nothing to restore, it is removed when the config releases it.
+// A key with a different value is handled by the adoption policy.
+// An owned key that no longer has the value the config set is reported as drift.
+// A released key is restored to its previous value, or removed if the config added it.
+// Keys that were changed by someone else since the config set them are left alone.
+func ClaimKeys(kind string, current, desired map[string]string, record OwnershipRecord, others []OwnershipRecord, legacy map[string]bool, policy AdoptionPolicy) Claim {
+	claim := Claim{
+		Apply:   make(map[string]string),
+		Owned:   make(map[string]OwnedValue),
+		Restore: make(map[string]string),
+	}
+
+	// Keys set before ownership records existed were added by the config
+	owned := maps.Clone(record.Keys(kind))
+	if owned == nil {
+		owned = make(map[string]OwnedValue)
+	}
+	for key := range legacy {
+		if value, exists := current[key]; exists {
+			if _, recorded := owned[key]; !recorded {
+				owned[key] = OwnedValue{Value: value}
+			}
+		}
+	}
+
+	var failed []string
+
+	for _, key := range slices.Sorted(maps.Keys(desired)) {
+		value := desired[key]
+
+		if ownedValue, exists := owned[key]; exists {
+			claim.Apply[key] = value
+			claim.Owned[key] = OwnedValue{Value: value, Previous: ownedValue.Previous}
+
+			// A key that no longer has the value the config set was changed by someone else
+			if currentValue, exists := current[key]; !exists || currentValue != ownedValue.Value {
+				claim.Drift = append(claim.Drift, DriftRecord{Kind: kind, Key: key, OldValue: currentValue, Removed: !exists, NewValue: value})
+			}
+			continue
+		}
+
+		currentValue, exists := current[key]
+		switch {
+		case !exists:
+			claim.Apply[key] = value
+			claim.Owned[key] = OwnedValue{Value: value}
+		case ownedByOther(kind, key, others) != nil:
+			// Another config holds the key, so the value to restore is the one it replaced
+			claim.Apply[key] = value
+			claim.Owned[key] = OwnedValue{Value: value, Previous: ownedByOther(kind, key, others).Previous}
+		case currentValue == value:
+			// Nothing changes on the object, so the key is treated as added by the config and removed when it is released
+			claim.Apply[key] = value
+			claim.Owned[key] = OwnedValue{Value: value}
+		case policy == AdoptionAdopt:
+			claim.Apply[key] = value
+			claim.Owned[key] = OwnedValue{Value: value, Previous: &currentValue}
+		case policy == AdoptionFail:
+			failed = append(failed, key)
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(owned)) {
+		if _, exists := desired[key]; exists {
+			continue
+		}
+
+		ownedValue := owned[key]
+		if currentValue, exists := current[key]; !exists || currentValue != ownedValue.Value {
+			continue
+		}
+
+		if ownedValue.Previous != nil {
+			claim.Restore[key] = *ownedValue.Previous
+		} else {
+			claim.Remove = append(claim.Remove, key)
+		}
+	}
+
+	if len(failed) > 0 {
+		claim.Err = fmt.Errorf("%s %s already set with a different value and adoptionPolicy is Fail", kind, strings.Join(failed, ", "))
+	}
+
+	return claim
+}
+
+// ownedByOther returns the entry of the first other config that owns key
+func ownedByOther(kind, key string, others []OwnershipRecord) *OwnedValue {
+	for _, other := range others {
+		if value, exists := other.Keys(kind)[key]; exists {
+			return &value
+		}
+	}
+	return nil
+}
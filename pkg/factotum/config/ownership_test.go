@@ -0,0 +1,196 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestClaimKeys(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         map[string]string
+		desired         map[string]string
+		record          OwnershipRecord
+		others          []OwnershipRecord
+		legacy          map[string]bool
+		policy          AdoptionPolicy
+		expectedApply   map[string]string
+		expectedOwned   map[string]OwnedValue
+		expectedRestore map[string]string
+		expectedRemove  []string
+		expectedErr     bool
+	}{
+		{
+			name:          "Missing key is added",
+			current:       map[string]string{},
+			desired:       map[string]string{"team": "a"},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{"team": "a"},
+			expectedOwned: map[string]OwnedValue{"team": {Value: "a"}},
+		},
+		{
+			name:          "Existing key with the same value is adopted",
+			current:       map[string]string{"team": "a"},
+			desired:       map[string]string{"team": "a"},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{"team": "a"},
+			expectedOwned: map[string]OwnedValue{"team": {Value: "a"}},
+		},
+		{
+			name:          "Adopt takes over a different value",
+			current:       map[string]string{"team": "b"},
+			desired:       map[string]string{"team": "a"},
+			policy:        AdoptionAdopt,
+			expectedApply: map[string]string{"team": "a"},
+			expectedOwned: map[string]OwnedValue{"team": {Value: "a", Previous: ptr("b")}},
+		},
+		{
+			name:          "Skip leaves a different value alone",
+			current:       map[string]string{"team": "b"},
+			desired:       map[string]string{"team": "a"},
+			policy:        AdoptionSkip,
+			expectedApply: map[string]string{},
+			expectedOwned: map[string]OwnedValue{},
+		},
+		{
+			name:          "Fail leaves a different value alone and reports it",
+			current:       map[string]string{"team": "b"},
+			desired:       map[string]string{"team": "a"},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{},
+			expectedOwned: map[string]OwnedValue{},
+			expectedErr:   true,
+		},
+		{
+			name:          "Owned key is updated and keeps its previous value",
+			current:       map[string]string{"team": "a"},
+			desired:       map[string]string{"team": "c"},
+			record:        OwnershipRecord{Labels: map[string]OwnedValue{"team": {Value: "a", Previous: ptr("b")}}},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{"team": "c"},
+			expectedOwned: map[string]OwnedValue{"team": {Value: "c", Previous: ptr("b")}},
+		},
+		{
+			name:          "Key held by another config keeps the original previous value",
+			current:       map[string]string{"team": "b"},
+			desired:       map[string]string{"team": "a"},
+			others:        []OwnershipRecord{{Labels: map[string]OwnedValue{"team": {Value: "b"}}}},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{"team": "a"},
+			expectedOwned: map[string]OwnedValue{"team": {Value: "a"}},
+		},
+		{
+			name:            "Released key is restored",
+			current:         map[string]string{"team": "a"},
+			desired:         map[string]string{},
+			record:          OwnershipRecord{Labels: map[string]OwnedValue{"team": {Value: "a", Previous: ptr("b")}}},
+			policy:          AdoptionFail,
+			expectedApply:   map[string]string{},
+			expectedOwned:   map[string]OwnedValue{},
+			expectedRestore: map[string]string{"team": "b"},
+		},
+		{
+			name:           "Released key the config added is removed",
+			current:        map[string]string{"team": "a"},
+			desired:        map[string]string{},
+			record:         OwnershipRecord{Labels: map[string]OwnedValue{"team": {Value: "a"}}},
+			policy:         AdoptionFail,
+			expectedApply:  map[string]string{},
+			expectedOwned:  map[string]OwnedValue{},
+			expectedRemove: []string{"team"},
+		},
+		{
+			name:          "Released key changed by someone else is left alone",
+			current:       map[string]string{"team": "d"},
+			desired:       map[string]string{},
+			record:        OwnershipRecord{Labels: map[string]OwnedValue{"team": {Value: "a", Previous: ptr("b")}}},
+			policy:        AdoptionFail,
+			expectedApply: map[string]string{},
+			expectedOwned: map[string]OwnedValue{},
+		},
+		{
+			name:           "Legacy key is treated as added by the config",
+			current:        map[string]string{"team": "a", "zone": "1"},
+			desired:        map[string]string{"zone": "2"},
+			legacy:         map[string]bool{"team": true, "zone": true},
+			policy:         AdoptionFail,
+			expectedApply:  map[string]string{"zone": "2"},
+			expectedOwned:  map[string]OwnedValue{"zone": {Value: "2"}},
+			expectedRemove: []string{"team"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := ClaimKeys(KindLabel, tt.current, tt.desired, tt.record, tt.others, tt.legacy, tt.policy)
+
+			if !reflect.DeepEqual(claim.Apply, tt.expectedApply) {
+				t.Errorf("expected apply %v, got %v", tt.expectedApply, claim.Apply)
+			}
+			if !reflect.DeepEqual(claim.Owned, tt.expectedOwned) {
+				t.Errorf("expected owned %v, got %v", tt.expectedOwned, claim.Owned)
+			}
+			expectedRestore := tt.expectedRestore
+			if expectedRestore == nil {
+				expectedRestore = map[string]string{}
+			}
+			if !reflect.DeepEqual(claim.Restore, expectedRestore) {
+				t.Errorf("expected restore %v, got %v", expectedRestore, claim.Restore)
+			}
+			if !reflect.DeepEqual(claim.Remove, tt.expectedRemove) {
+				t.Errorf("expected remove %v, got %v", tt.expectedRemove, claim.Remove)
+			}
+			if (claim.Err != nil) != tt.expectedErr {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, claim.Err)
+			}
+		})
+	}
+}
+
+func TestReadOwnershipRecords(t *testing.T) {
+	mine := OwnershipRecord{Labels: map[string]OwnedValue{"team": {Value: "a", Previous: ptr("b")}}}
+	other := OwnershipRecord{Taints: map[string]OwnedValue{"dedicated:NoSchedule": {Value: "gpu"}}}
+
+	annotations := map[string]string{
+		OwnershipAnnotation("config-a"): mine.Encode(),
+		OwnershipAnnotation("config-b"): other.Encode(),
+		OwnershipAnnotation("config-c"): "not json",
+		"unrelated":                     "value",
+	}
+
+	gotMine, gotOthers := ReadOwnershipRecords(annotations, "config-a")
+
+	if !reflect.DeepEqual(gotMine, mine) {
+		t.Errorf("expected record %+v, got %+v", mine, gotMine)
+	}
+
+	if len(gotOthers) != 1 || !reflect.DeepEqual(gotOthers[0], other) {
+		t.Errorf("expected only the other valid record, got %+v", gotOthers)
+	}
+}
+
+func TestOwnershipAnnotation(t *testing.T) {
+	if got := OwnershipAnnotation("nodeconfig-sample"); got != "ownership.factotum.io/nodeconfig-sample" {
+		t.Errorf("expected ownership.factotum.io/nodeconfig-sample, got %s", got)
+	}
+
+	long := OwnershipAnnotation(strings.Repeat("a", 100))
+	if long == OwnershipAnnotationPrefix+strings.Repeat("a", 100) || !IsOwnershipAnnotation(long) {
+		t.Errorf("expected a hashed ownership annotation for a long name, got %s", long)
+	}
+}
+
+func TestGetAdoptionPolicy(t *testing.T) {
+	if got := (&CommonSpec{}).GetAdoptionPolicy(); got != AdoptionAdopt {
+		t.Errorf("expected %s by default, got %s", AdoptionAdopt, got)
+	}
+
+	if got := (&CommonSpec{AdoptionPolicy: AdoptionFail}).GetAdoptionPolicy(); got != AdoptionFail {
+		t.Errorf("expected %s, got %s", AdoptionFail, got)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ResultApplied is recorded when a config was applied to an object
+	ResultApplied string = "Applied"
+	// ResultFailed is recorded when applying a config to an object returned an error
+	ResultFailed string = "Failed"
+	// ResultPending is recorded when an object is waiting for its turn in a rollout
+	ResultPending string = "Pending"
+	// ResultCompliant is recorded when an object matches an Audit config
+	ResultCompliant string = "Compliant"
+	// ResultNonCompliant is recorded when an object differs from an Audit config
+	ResultNonCompliant string = "NonCompliant"
+)
+
+// ObjectStatus is the result of applying a config to a single object
+// +k8s:deepcopy-gen=true
+type ObjectStatus struct {
+	// Name of the object
+	Name string `json:"name"`
+	// Result of the last apply, Applied, Failed or Pending, or Compliant or NonCompliant for Audit configs
+	Result string `json:"result"`
+	// LastError is the error returned by the last failed apply
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// Differences are how the object differs from an Audit config
+	// +optional
+	Differences []string `json:"differences,omitempty"`
+	// LastTransitionTime is when the result for the object last changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// Results collects the per object results of processing a config
+// It is passed to a controller with the config and read by the reconciler once processing is done
+type Results struct {
+	mu      sync.Mutex
+	objects map[string]ObjectStatus
+}
+
+func NewResults() *Results {
+	return &Results{
+		objects: make(map[string]ObjectStatus),
+	}
+}
+
+// Record stores the result of applying the config to the named object
+// A nil Results is ignored so callers that do not need results can skip creating one
+func (r *Results) Record(name string, err error) {
+	if r == nil {
+		return
+	}
+
+	status := ObjectStatus{
+		Name:               name,
+		Result:             ResultApplied,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	if err != nil {
+		status.Result = ResultFailed
+		status.LastError = err.Error()
+	}
+
+	r.mu.Lock()
+	r.objects[name] = status
+	r.mu.Unlock()
+}
+
+// RecordPending stores that the named object is selected but has not been applied to yet
+func (r *Results) RecordPending(name string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.objects[name] = ObjectStatus{
+		Name:               name,
+		Result:             ResultPending,
+		LastTransitionTime: metav1.Now(),
+	}
+	r.mu.Unlock()
+}
+
+// RecordAudit stores how the named object differs from an Audit config
+// An error, such as a template that failed to render, is recorded as a failure
+func (r *Results) RecordAudit(name string, differences []string, err error) {
+	if r == nil {
+		return
+	}
+
+	status := ObjectStatus{
+		Name:               name,
+		Result:             ResultCompliant,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	switch {
+	case err != nil:
+		status.Result = ResultFailed
+		status.LastError = err.Error()
+	case len(differences) > 0:
+		status.Result = ResultNonCompliant
+		status.Differences = differences
+	}
+
+	r.mu.Lock()
+	r.objects[name] = status
+	r.mu.Unlock()
+}
+
+// Objects returns the recorded results sorted by object name
+func (r *Results) Objects() []ObjectStatus {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	objects := make([]ObjectStatus, 0, len(r.objects))
+	for _, status := range r.objects {
+		objects = append(objects, status)
+	}
+
+	slices.SortFunc(objects, func(a, b ObjectStatus) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return objects
+}
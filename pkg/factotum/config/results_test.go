@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResults(t *testing.T) {
+	results := NewResults()
+
+	results.Record("node2", errors.New("conflict"))
+	results.Record("node1", nil)
+	results.RecordPending("node3")
+	results.RecordAudit("node4", []string{`label team is missing, want "a"`}, nil)
+	results.RecordAudit("node5", nil, nil)
+
+	objects := results.Objects()
+	if len(objects) != 5 {
+		t.Fatalf("expected 5 objects, got %d", len(objects))
+	}
+
+	if objects[0].Name != "node1" || objects[0].Result != ResultApplied {
+		t.Errorf("unexpected result %+v", objects[0])
+	}
+
+	if objects[1].Name != "node2" || objects[1].Result != ResultFailed || objects[1].LastError != "conflict" {
+		t.Errorf("unexpected result %+v", objects[1])
+	}
+
+	if objects[2].Name != "node3" || objects[2].Result != ResultPending {
+		t.Errorf("unexpected result %+v", objects[2])
+	}
+
+	if objects[3].Name != "node4" || objects[3].Result != ResultNonCompliant || len(objects[3].Differences) != 1 {
+		t.Errorf("unexpected result %+v", objects[3])
+	}
+
+	if objects[4].Name != "node5" || objects[4].Result != ResultCompliant {
+		t.Errorf("unexpected result %+v", objects[4])
+	}
+
+	// A nil Results is safe to use
+	var none *Results
+	none.Record("node1", nil)
+	none.RecordPending("node1")
+	if none.Objects() != nil {
+		t.Errorf("expected nil results to return no objects")
+	}
+}
+
+func TestSetObjects(t *testing.T) {
+	then := metav1.Unix(100, 0)
+
+	status := CommonStatus{
+		Objects: []ObjectStatus{
+			{Name: "node1", Result: ResultApplied, LastTransitionTime: then},
+			{Name: "node2", Result: ResultApplied, LastTransitionTime: then},
+		},
+	}
+
+	status.SetObjects([]ObjectStatus{
+		{Name: "node1", Result: ResultApplied, LastTransitionTime: metav1.Now()},
+		{Name: "node2", Result: ResultFailed, LastError: "conflict", LastTransitionTime: metav1.Now()},
+		{Name: "node3", Result: ResultApplied, LastTransitionTime: metav1.Now()},
+		{Name: "node4", Result: ResultPending, LastTransitionTime: metav1.Now()},
+	})
+
+	// Pending objects are matched but neither applied nor failed
+	if status.MatchedCount != 4 || status.AppliedCount != 2 || status.FailedCount != 1 {
+		t.Errorf("unexpected counts matched=%d applied=%d failed=%d", status.MatchedCount, status.AppliedCount, status.FailedCount)
+	}
+
+	if !status.Objects[0].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected unchanged result to keep its transition time")
+	}
+
+	if status.Objects[1].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected changed result to get a new transition time")
+	}
+}
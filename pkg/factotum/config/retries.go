@@ -0,0 +1,18 @@
+package config
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExhaustedRetry is an object the config still failed to apply to after every retry
+// +k8s:deepcopy-gen=true
+type ExhaustedRetry struct {
+	// Object is the name of the object
+	Object string `json:"object"`
+	// Attempts is the number of times the config was applied to the object
+	Attempts int32 `json:"attempts"`
+	// LastError is the error returned by the last attempt
+	LastError string `json:"lastError"`
+	// Time is when the last attempt failed
+	Time metav1.Time `json:"time"`
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionInWindow reports whether a scheduled config is inside its maintenance window
+const ConditionInWindow = "InWindow"
+
+// Schedule limits a config to a recurring maintenance window.
+// The window opens at each Start time and closes at the following End time.
+// +k8s:deepcopy-gen=true
+type Schedule struct {
+	// Start is a standard five field cron expression for when the window opens, for example "0 18 * * 5"
+	Start string `json:"start"`
+	// End is a standard five field cron expression for when the window closes, for example "0 6 * * 1"
+	End string `json:"end"`
+	// TimeZone is the IANA time zone Start and End are evaluated in, defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// WindowState is Open while a scheduled config is applied and Closed while it is cleaned up
+type WindowState string
+
+const (
+	WindowOpen   WindowState = "Open"
+	WindowClosed WindowState = "Closed"
+)
+
+// WindowStatus is the current state of a config's maintenance window
+// +k8s:deepcopy-gen=true
+type WindowStatus struct {
+	// State is Open or Closed
+	State WindowState `json:"state"`
+	// NextTransitionTime is when the window next opens or closes
+	NextTransitionTime metav1.Time `json:"nextTransitionTime"`
+}
+
+// Window returns the state of the window at now and when it next changes
+// The window is open when the next End comes before the next Start
+func (s *Schedule) Window(now time.Time) (WindowStatus, error) {
+	location := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.TimeZone); err != nil {
+			return WindowStatus{}, fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+		}
+	}
+
+	start, err := cron.ParseStandard(s.Start)
+	if err != nil {
+		return WindowStatus{}, fmt.Errorf("invalid start %q: %w", s.Start, err)
+	}
+
+	end, err := cron.ParseStandard(s.End)
+	if err != nil {
+		return WindowStatus{}, fmt.Errorf("invalid end %q: %w", s.End, err)
+	}
+
+	local := now.In(location)
+	nextStart := start.Next(local)
+	nextEnd := end.Next(local)
+
+	if nextEnd.Before(nextStart) {
+		return WindowStatus{State: WindowOpen, NextTransitionTime: metav1.NewTime(nextEnd)}, nil
+	}
+
+	return WindowStatus{State: WindowClosed, NextTransitionTime: metav1.NewTime(nextStart)}, nil
+}
+
+// EvaluateSchedule records the window of a scheduled config in status and returns true if the config should be applied.
+// Configs without a schedule are always applied. An invalid schedule is reported on the InWindow condition and returned as an error.
+func EvaluateSchedule(spec *CommonSpec, status *CommonStatus, generation int64, now time.Time) (bool, error) {
+	if spec.Schedule == nil {
+		status.Window = nil
+		meta.RemoveStatusCondition(&status.Conditions, ConditionInWindow)
+		return true, nil
+	}
+
+	window, err := spec.Schedule.Window(now)
+	if err != nil {
+		status.Window = nil
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               ConditionInWindow,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidSchedule",
+			Message:            err.Error(),
+			ObservedGeneration: generation,
+		})
+		return false, err
+	}
+
+	status.Window = &window
+
+	condition := metav1.Condition{
+		Type:               ConditionInWindow,
+		Status:             metav1.ConditionTrue,
+		Reason:             "WindowOpen",
+		Message:            fmt.Sprintf("window closes at %s", window.NextTransitionTime.UTC().Format(time.RFC3339)),
+		ObservedGeneration: generation,
+	}
+
+	if window.State == WindowClosed {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "WindowClosed"
+		condition.Message = fmt.Sprintf("window opens at %s", window.NextTransitionTime.UTC().Format(time.RFC3339))
+	}
+
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	return window.State == WindowOpen, nil
+}
+
+// WindowRequeueAfter returns how long until the window next changes, or 0 if the config has no window
+func (s *CommonStatus) WindowRequeueAfter(now time.Time) time.Duration {
+	if s.Window == nil {
+		return 0
+	}
+
+	// Requeue just after the boundary so the window has changed when the config is reconciled
+	return s.Window.NextTransitionTime.Sub(now) + time.Second
+}
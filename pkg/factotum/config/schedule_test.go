@@ -0,0 +1,122 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+func TestScheduleWindow(t *testing.T) {
+	// Friday 18:00 until Monday 06:00
+	weekend := &Schedule{Start: "0 18 * * 5", End: "0 6 * * 1"}
+
+	tests := []struct {
+		name           string
+		schedule       *Schedule
+		now            time.Time
+		expectedState  WindowState
+		expectedNext   time.Time
+		expectingError bool
+	}{
+		{
+			name:          "Before the window",
+			schedule:      weekend,
+			now:           time.Date(2025, 6, 4, 12, 0, 0, 0, time.UTC), // Wednesday
+			expectedState: WindowClosed,
+			expectedNext:  time.Date(2025, 6, 6, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "Inside the window",
+			schedule:      weekend,
+			now:           time.Date(2025, 6, 7, 12, 0, 0, 0, time.UTC), // Saturday
+			expectedState: WindowOpen,
+			expectedNext:  time.Date(2025, 6, 9, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "Time zone",
+			schedule:      &Schedule{Start: "0 18 * * 5", End: "0 6 * * 1", TimeZone: "America/New_York"},
+			now:           time.Date(2025, 6, 6, 20, 0, 0, 0, time.UTC), // Friday 16:00 in New York
+			expectedState: WindowClosed,
+			expectedNext:  time.Date(2025, 6, 6, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:           "Invalid cron",
+			schedule:       &Schedule{Start: "not cron", End: "0 6 * * 1"},
+			now:            time.Now(),
+			expectingError: true,
+		},
+		{
+			name:           "Invalid time zone",
+			schedule:       &Schedule{Start: "0 18 * * 5", End: "0 6 * * 1", TimeZone: "Mars/Olympus"},
+			now:            time.Now(),
+			expectingError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := tt.schedule.Window(tt.now)
+			if tt.expectingError {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if window.State != tt.expectedState {
+				t.Errorf("expected state %s, got %s", tt.expectedState, window.State)
+			}
+
+			if !window.NextTransitionTime.Time.Equal(tt.expectedNext) {
+				t.Errorf("expected next transition %v, got %v", tt.expectedNext, window.NextTransitionTime.Time)
+			}
+		})
+	}
+}
+
+func TestEvaluateSchedule(t *testing.T) {
+	saturday := time.Date(2025, 6, 7, 12, 0, 0, 0, time.UTC)
+	spec := CommonSpec{Schedule: &Schedule{Start: "0 18 * * 5", End: "0 6 * * 1"}}
+	status := CommonStatus{}
+
+	active, err := EvaluateSchedule(&spec, &status, 1, saturday)
+	if err != nil || !active {
+		t.Fatalf("expected the config to be active, got %v %v", active, err)
+	}
+
+	if !meta.IsStatusConditionTrue(status.Conditions, ConditionInWindow) {
+		t.Errorf("expected the InWindow condition to be true")
+	}
+
+	if after := status.WindowRequeueAfter(saturday); after != 42*time.Hour+time.Second {
+		t.Errorf("expected to requeue when the window closes, got %v", after)
+	}
+
+	spec.Schedule.End = "bad"
+	if active, err = EvaluateSchedule(&spec, &status, 2, saturday); err == nil || active {
+		t.Errorf("expected an invalid schedule to return an error")
+	}
+
+	if condition := meta.FindStatusCondition(status.Conditions, ConditionInWindow); condition == nil || condition.Reason != "InvalidSchedule" {
+		t.Errorf("expected the InWindow condition to report the invalid schedule")
+	}
+
+	// Removing the schedule removes the window
+	spec.Schedule = nil
+	if active, err = EvaluateSchedule(&spec, &status, 3, saturday); err != nil || !active {
+		t.Errorf("expected a config without a schedule to be active")
+	}
+
+	if status.Window != nil || meta.FindStatusCondition(status.Conditions, ConditionInWindow) != nil {
+		t.Errorf("expected the window status to be removed")
+	}
+
+	if status.WindowRequeueAfter(saturday) != 0 {
+		t.Errorf("expected no requeue without a window")
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// SelectorOperator is the relationship between a label and the values of a SelectorRequirement
+// +kubebuilder:validation:Enum=In;NotIn;Exists;DoesNotExist;Regex
+type SelectorOperator string
+
+const (
+	// SelectorOpIn requires the label value to be one of the values
+	SelectorOpIn SelectorOperator = "In"
+	// SelectorOpNotIn requires the label to be missing or its value to not be one of the values
+	SelectorOpNotIn SelectorOperator = "NotIn"
+	// SelectorOpExists requires the label to be present
+	SelectorOpExists SelectorOperator = "Exists"
+	// SelectorOpDoesNotExist requires the label to be missing
+	SelectorOpDoesNotExist SelectorOperator = "DoesNotExist"
+	// SelectorOpRegex requires the label value to match one of the values as a regex
+	SelectorOpRegex SelectorOperator = "Regex"
+)
+
+// SelectorRequirement is a Kubernetes style label selector requirement with an additional Regex operator
+// +k8s:deepcopy-gen=true
+// +kubebuilder:validation:XValidation:rule="self.operator in ['Exists', 'DoesNotExist'] ? !has(self.values) || size(self.values) == 0 : has(self.values) && size(self.values) > 0",message="values must be empty for Exists and DoesNotExist and set for In, NotIn and Regex"
+type SelectorRequirement struct {
+	// Key is the label key the selector applies to
+	Key string `json:"key"`
+	// Operator is one of In, NotIn, Exists, DoesNotExist or Regex
+	Operator SelectorOperator `json:"operator"`
+	// Values for the In, NotIn and Regex operators
+	// +optional
+	Values []string `json:"values,omitempty"`
+}
+
+// Matches returns true if labels satisfy the requirement
+// An invalid requirement or regex never matches
+func (r SelectorRequirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+
+	switch r.Operator {
+	case SelectorOpIn:
+		return exists && slices.Contains(r.Values, value)
+	case SelectorOpNotIn:
+		return !exists || !slices.Contains(r.Values, value)
+	case SelectorOpExists:
+		return exists
+	case SelectorOpDoesNotExist:
+		return !exists
+	case SelectorOpRegex:
+		if !exists {
+			return false
+		}
+		for _, expr := range r.Values {
+			if match, err := regexp.MatchString(expr, value); err == nil && match {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// MatchExpressions returns true if labels satisfy every requirement
+// An empty list of requirements matches everything
+func MatchExpressions(requirements []SelectorRequirement, labels map[string]string) bool {
+	for _, r := range requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchRegexMap returns true if every key in selector is present in labels and the value matches the selector regex
+// A nil selector matches everything
+func MatchRegexMap(selector map[string]string, labels map[string]string) bool {
+	for key, expr := range selector {
+		value, exists := labels[key]
+		if !exists {
+			return false
+		}
+
+		// If the regex fails to compile we treat it as no match
+		if match, err := regexp.MatchString(expr, value); err != nil || !match {
+			return false
+		}
+	}
+	return true
+}
+
+// CaptureRegexMap adds the named capture groups of the selector regexes matched against labels to captures
+func CaptureRegexMap(selector map[string]string, labels map[string]string, captures map[string]string) {
+	for key, expr := range selector {
+		if value, exists := labels[key]; exists {
+			CaptureNamed(expr, value, captures)
+		}
+	}
+}
+
+// CaptureExpressions adds the named capture groups of the Regex requirements matched against labels to captures
+func CaptureExpressions(requirements []SelectorRequirement, labels map[string]string, captures map[string]string) {
+	for _, r := range requirements {
+		value, exists := labels[r.Key]
+		if r.Operator != SelectorOpRegex || !exists {
+			continue
+		}
+		for _, expr := range r.Values {
+			if CaptureNamed(expr, value, captures) {
+				break
+			}
+		}
+	}
+}
+
+// CaptureNamed adds the named capture groups of expr matched against value to captures
+// It returns false if the regex does not compile or does not match
+func CaptureNamed(expr, value string, captures map[string]string) bool {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
+	}
+
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return false
+	}
+
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			captures[name] = match[i]
+		}
+	}
+
+	return true
+}
+
+// ValidateSelector returns an error for each regex in selector and in the Regex requirements that does not compile
+// Invalid regexes never match, so a selector with one silently selects fewer objects than intended
+func ValidateSelector(selector map[string]string, requirements []SelectorRequirement) error {
+	var errs []error
+
+	for _, key := range slices.Sorted(maps.Keys(selector)) {
+		errs = append(errs, ValidateRegex(key, selector[key]))
+	}
+
+	for _, r := range requirements {
+		if r.Operator != SelectorOpRegex {
+			continue
+		}
+		for _, expr := range r.Values {
+			errs = append(errs, ValidateRegex(r.Key, expr))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateRegex returns an error if expr, the regex for field, does not compile
+func ValidateRegex(field, expr string) error {
+	if _, err := regexp.Compile(expr); err != nil {
+		return fmt.Errorf("invalid regex for %s: %w", field, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import "testing"
+
+func TestSelectorRequirementMatches(t *testing.T) {
+	labels := map[string]string{"zone": "a", "gpu": "nvidia-a100"}
+
+	tests := []struct {
+		name        string
+		requirement SelectorRequirement
+		want        bool
+	}{
+		{
+			name:        "In matches",
+			requirement: SelectorRequirement{Key: "zone", Operator: SelectorOpIn, Values: []string{"a", "b"}},
+			want:        true,
+		},
+		{
+			name:        "In missing label",
+			requirement: SelectorRequirement{Key: "rack", Operator: SelectorOpIn, Values: []string{"a"}},
+			want:        false,
+		},
+		{
+			name:        "NotIn excluded value",
+			requirement: SelectorRequirement{Key: "zone", Operator: SelectorOpNotIn, Values: []string{"a", "b"}},
+			want:        false,
+		},
+		{
+			name:        "NotIn missing label",
+			requirement: SelectorRequirement{Key: "rack", Operator: SelectorOpNotIn, Values: []string{"a"}},
+			want:        true,
+		},
+		{
+			name:        "Exists",
+			requirement: SelectorRequirement{Key: "gpu", Operator: SelectorOpExists},
+			want:        true,
+		},
+		{
+			name:        "DoesNotExist",
+			requirement: SelectorRequirement{Key: "legacy", Operator: SelectorOpDoesNotExist},
+			want:        true,
+		},
+		{
+			name:        "DoesNotExist with label present",
+			requirement: SelectorRequirement{Key: "gpu", Operator: SelectorOpDoesNotExist},
+			want:        false,
+		},
+		{
+			name:        "Regex matches any value",
+			requirement: SelectorRequirement{Key: "gpu", Operator: SelectorOpRegex, Values: []string{"^amd", "^nvidia-"}},
+			want:        true,
+		},
+		{
+			name:        "Invalid regex",
+			requirement: SelectorRequirement{Key: "gpu", Operator: SelectorOpRegex, Values: []string{"("}},
+			want:        false,
+		},
+		{
+			name:        "Unknown operator",
+			requirement: SelectorRequirement{Key: "gpu", Operator: "Gt", Values: []string{"1"}},
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.requirement.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	labels := map[string]string{"zone": "c", "gpu": "true"}
+
+	requirements := []SelectorRequirement{
+		{Key: "zone", Operator: SelectorOpNotIn, Values: []string{"a", "b"}},
+		{Key: "gpu", Operator: SelectorOpExists},
+		{Key: "legacy", Operator: SelectorOpDoesNotExist},
+	}
+
+	if !MatchExpressions(requirements, labels) {
+		t.Errorf("expected all requirements to match")
+	}
+
+	labels["legacy"] = "true"
+	if MatchExpressions(requirements, labels) {
+		t.Errorf("expected requirements not to match")
+	}
+
+	if !MatchExpressions(nil, labels) {
+		t.Errorf("expected empty requirements to match")
+	}
+}
+
+func TestMatchRegexMap(t *testing.T) {
+	labels := map[string]string{"kubernetes.io/hostname": "node1"}
+
+	if !MatchRegexMap(map[string]string{"kubernetes.io/hostname": "node[1-3]"}, labels) {
+		t.Errorf("expected regex selector to match")
+	}
+
+	if MatchRegexMap(map[string]string{"kubernetes.io/hostname": "node[4-6]"}, labels) {
+		t.Errorf("expected regex selector not to match")
+	}
+
+	if !MatchRegexMap(nil, labels) {
+		t.Errorf("expected nil selector to match")
+	}
+}
+
+func TestValidateSelector(t *testing.T) {
+	if err := ValidateSelector(map[string]string{"zone": "^us-.*"}, []SelectorRequirement{{Key: "gpu", Operator: SelectorOpRegex, Values: []string{"nvidia-.*"}}}); err != nil {
+		t.Errorf("expected a valid selector, got %v", err)
+	}
+
+	// Values of non Regex requirements are not regexes
+	if err := ValidateSelector(nil, []SelectorRequirement{{Key: "zone", Operator: SelectorOpIn, Values: []string{"("}}}); err != nil {
+		t.Errorf("expected In values to not be validated, got %v", err)
+	}
+
+	if err := ValidateSelector(map[string]string{"zone": "("}, nil); err == nil {
+		t.Errorf("expected an error for an invalid selector regex")
+	}
+
+	if err := ValidateSelector(nil, []SelectorRequirement{{Key: "gpu", Operator: SelectorOpRegex, Values: []string{"[a-"}}}); err == nil {
+		t.Errorf("expected an error for an invalid requirement regex")
+	}
+}
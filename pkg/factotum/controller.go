@@ -1,12 +1,14 @@
 package factotum
 
 import (
+	"context"
+
 	"k8s.io/apimachinery/pkg/watch"
 )
 
 type FactotumController interface {
-	Watch(ch <-chan watch.Event) error
-	Processor() error
+	Watch(ctx context.Context, ch <-chan watch.Event) error
+	Processor(ctx context.Context) error
 	Cleanup() error
 	AddFinalizer() error
 	UpdateCache()
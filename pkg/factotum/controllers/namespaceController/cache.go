@@ -1,9 +1,13 @@
 package namespacecontroller
 
 import (
+	"maps"
+	"slices"
 	"sync"
 
 	v1 "k8s.io/api/core/v1"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 )
 
 type Cache struct {
@@ -23,11 +27,20 @@ func (Cache *Cache) Get(name string) (*v1.Namespace, bool) {
 	return obj, true
 }
 
+// List returns the cached namespaces, the namespaces are replaced rather than changed so they can be read without the lock
+func (Cache *Cache) List() []*v1.Namespace {
+	Cache.Mu.Lock()
+	defer Cache.Mu.Unlock()
+
+	return slices.Collect(maps.Values(Cache.ObjMap))
+}
+
 func (Cache *Cache) Set(name string, obj *v1.Namespace) {
 	Cache.Mu.Lock()
 	defer Cache.Mu.Unlock()
 
 	Cache.ObjMap[name] = obj.DeepCopy()
+	metrics.SetCacheSize(metrics.Namespace, len(Cache.ObjMap))
 
 	debugLog.Info("NS Cache Set NS", "ns", name)
 
@@ -38,6 +51,7 @@ func (Cache *Cache) Delete(name string) {
 	defer Cache.Mu.Unlock()
 
 	delete(Cache.ObjMap, name)
+	metrics.SetCacheSize(metrics.Namespace, len(Cache.ObjMap))
 	debugLog.Info("Ns Cache Delete NS", "ns", name)
 
 }
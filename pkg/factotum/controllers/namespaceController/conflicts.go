@@ -0,0 +1,111 @@
+package namespacecontroller
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ResolveConflicts returns a copy of NamespaceConfig without the keys it loses to higher priority NamespaceConfigs that also match obj.
+// Lost labels and annotations are dropped so the winning config can own them.
+// An object with the same kind and name as an object set by the winning config is lost as a whole, it is listed
+// in the conflicts by kind and name, for example ResourceQuota/compute, and left out by dropLostObjects.
+func (c *NamespaceController) ResolveConflicts(obj *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) (*v1alpha1.NamespaceConfig, []config.Conflict) {
+	var conflicts []config.Conflict
+
+	resolved := NamespaceConfig.DeepCopy()
+
+	// Values are compared as they are rendered for the namespace, templates that render to the same value do not conflict
+	labels, annotations, _ := fcHandlers.RenderMetaData(obj, resolved, resolved.Spec.Labels, resolved.Spec.Annotations)
+	labels, annotations = maps.Clone(labels), maps.Clone(annotations)
+	objects := c.objectsByName(obj, NamespaceConfig)
+
+	for _, other := range c.GetMatchingNamespaceConfigs(obj) {
+		if other.Name == NamespaceConfig.Name || !config.Outranks(other, NamespaceConfig) {
+			continue
+		}
+
+		conflict := config.Conflict{Config: other.Name}
+
+		otherLabels, otherAnnotations, _ := fcHandlers.RenderMetaData(obj, other, other.Spec.Labels, other.Spec.Annotations)
+
+		lostLabels := config.DisputedKeys(labels, otherLabels)
+		for _, key := range lostLabels {
+			delete(resolved.Spec.Labels, key)
+			delete(labels, key)
+		}
+		conflict.Add(config.KindLabel, lostLabels...)
+
+		lostAnnotations := config.DisputedKeys(annotations, otherAnnotations)
+		for _, key := range lostAnnotations {
+			delete(resolved.Spec.Annotations, key)
+			delete(annotations, key)
+		}
+		conflict.Add(config.KindAnnotation, lostAnnotations...)
+
+		otherObjects := c.objectsByName(obj, other)
+		for _, name := range slices.Sorted(maps.Keys(objects)) {
+			if _, exists := otherObjects[name]; exists {
+				conflict.Add(objects[name].GetKind(), objects[name].GetName())
+				delete(objects, name)
+			}
+		}
+
+		if len(conflict.Keys) > 0 {
+			debugLog.Info("Config lost keys to higher priority config", "config", NamespaceConfig.Name, "ns", obj.Name, "winner", other.Name, "keys", conflict.Keys)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return resolved, conflicts
+}
+
+// GetConflicts returns the keys NamespaceConfig loses to higher priority NamespaceConfigs across all namespaces it selects
+func (c *NamespaceController) GetConflicts(NamespaceConfig *v1alpha1.NamespaceConfig) []config.Conflict {
+	var conflicts []config.Conflict
+
+	for _, obj := range c.GetMatchingNamespaces(NamespaceConfig) {
+		_, objConflicts := c.ResolveConflicts(obj, NamespaceConfig)
+		conflicts = append(conflicts, objConflicts...)
+	}
+
+	return config.MergeConflicts(conflicts)
+}
+
+// objectsByName returns the objects NamespaceConfig sets in namespace by kind and name, for example ResourceQuota/compute
+// Objects that fail to render are left out
+func (c *NamespaceController) objectsByName(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) map[string]*unstructured.Unstructured {
+	objects, _ := c.renderObjects(namespace, NamespaceConfig)
+
+	byName := make(map[string]*unstructured.Unstructured, len(objects))
+	for _, obj := range objects {
+		byName[objectName(obj)] = obj
+	}
+
+	return byName
+}
+
+// dropLostObjects returns desired without the objects lost to higher priority configs in conflicts
+func dropLostObjects(desired []*unstructured.Unstructured, conflicts []config.Conflict) []*unstructured.Unstructured {
+	lost := make(map[string]bool)
+	for _, conflict := range conflicts {
+		for _, key := range conflict.Keys {
+			lost[key] = true
+		}
+	}
+
+	return slices.DeleteFunc(desired, func(obj *unstructured.Unstructured) bool {
+		return lost[objectName(obj)]
+	})
+}
+
+// objectName identifies an object in a namespace by its kind and name, the same way conflicts list it
+func objectName(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + obj.GetName()
+}
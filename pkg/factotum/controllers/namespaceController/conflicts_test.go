@@ -0,0 +1,61 @@
+package namespacecontroller
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	high := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "high"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			CommonSpec: config.CommonSpec{
+				Priority:       10,
+				TemplateValues: true,
+				Labels:         map[string]string{"team": "{{ .Labels.owner }}", "tier": "gold"},
+			},
+			ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{{Name: "compute"}},
+		},
+	}
+	low := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "low"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			CommonSpec:     config.CommonSpec{Labels: map[string]string{"team": "payments", "tier": "silver"}},
+			ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{{Name: "compute"}, {Name: "storage"}},
+		},
+	}
+
+	c := newObjectController(t)
+	c.NamespaceConfigs = map[string]*v1alpha1.NamespaceConfig{"high": high, "low": low}
+
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"owner": "payments"}}}
+
+	resolved, conflicts := c.ResolveConflicts(namespace, low)
+
+	// The team label renders to the same value in both configs, so only the tier label and the quota are lost
+	if len(conflicts) != 1 || conflicts[0].Config != "high" || !reflect.DeepEqual(conflicts[0].Keys, []string{"label/tier", "ResourceQuota/compute"}) {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+	if !reflect.DeepEqual(resolved.Spec.Labels, map[string]string{"team": "payments"}) {
+		t.Errorf("expected only the lost label to be dropped, got %v", resolved.Spec.Labels)
+	}
+
+	desired, err := c.renderObjects(namespace, low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desired = dropLostObjects(desired, conflicts); len(desired) != 1 || desired[0].GetName() != "storage" {
+		t.Errorf("expected only the storage quota to be kept, got %d objects", len(desired))
+	}
+
+	// The higher priority config keeps all its keys and objects
+	if _, conflicts := c.ResolveConflicts(namespace, high); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts for the winning config, got %+v", conflicts)
+	}
+}
@@ -1,18 +1,44 @@
 package namespacecontroller
 
 import (
+	"context"
+
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	v1 "k8s.io/api/core/v1"
 )
 
 type Msg struct {
 	Header    string
 	Namespace *v1.Namespace
-	Config    *v1alpha1.NamespaceConfig
+	// Previous is the cached copy of Namespace before the watcher event, it is used to find configs that no longer match
+	Previous *v1.Namespace
+	Config   *v1alpha1.NamespaceConfig
+	// Results collects the outcome for each matching namespace, it may be nil
+	Results *config.Results
+	// Objects collects the objects created in each matching namespace, it may be nil
+	Objects *ObjectResults
+	// Retry is set when the namespace is sent again after Config failed to apply to it
+	Retry bool
+	// Ctx is the context of the sender, set by Notify. Work for the message stops when it is done
+	Ctx context.Context
+	// Done is closed once every namespace of the message has been processed, it may be nil
+	Done chan struct{}
 }
 
-func (c *NamespaceController) Notify(msg Msg) {
-	log.Info("Notifying NamespaceController", "source", msg.Header)
-	c.Wg.Add(1)
-	c.MsgChan <- msg
+// Notify sends msg to the Proccessor, msg.Done is closed once it has been processed
+// It returns the context error if ctx is done before the Proccessor receives msg
+func (c *NamespaceController) Notify(ctx context.Context, msg Msg) error {
+	debugLog.Info("Notifying NamespaceController", "source", msg.Header)
+	msg.Ctx = ctx
+	metrics.QueueDepth.WithLabelValues(metrics.Namespace).Inc()
+
+	select {
+	case c.MsgChan <- msg:
+		return nil
+	case <-ctx.Done():
+		metrics.QueueDepth.WithLabelValues(metrics.Namespace).Dec()
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,307 @@
+package namespacecontroller
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+)
+
+// ObjectHandlers render the objects a NamespaceConfig creates in each namespace it selects, such as a ResourceQuota.
+// An error is returned for any object that could not be rendered, the rest are still applied.
+type ObjectHandler interface {
+	Objects(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]*unstructured.Unstructured, error)
+	GetName() string
+}
+
+// ObjectResults collects the objects created in each namespace processed for a NamespaceConfig
+type ObjectResults struct {
+	mu         sync.Mutex
+	namespaces map[string][]v1alpha1.ManagedObjectStatus
+}
+
+func NewObjectResults() *ObjectResults {
+	return &ObjectResults{
+		namespaces: make(map[string][]v1alpha1.ManagedObjectStatus),
+	}
+}
+
+// Record stores the objects created in a namespace, replacing any recorded before
+// A nil ObjectResults is ignored so callers that do not need results can skip creating one
+func (r *ObjectResults) Record(namespace string, objects []v1alpha1.ManagedObjectStatus) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.namespaces[namespace] = objects
+	r.mu.Unlock()
+}
+
+// Objects returns the recorded objects sorted by namespace, kind and name
+func (r *ObjectResults) Objects() []v1alpha1.ManagedObjectStatus {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var objects []v1alpha1.ManagedObjectStatus
+	for _, namespace := range r.namespaces {
+		objects = append(objects, namespace...)
+	}
+
+	slices.SortFunc(objects, func(a, b v1alpha1.ManagedObjectStatus) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	return objects
+}
+
+// objectKey identifies an object created in a namespace
+type objectKey struct {
+	namespace  string
+	apiVersion string
+	kind       string
+	name       string
+}
+
+// deletedObjects holds the objects created by a config that someone else deleted, until the config creates them again
+type deletedObjects struct {
+	mu      sync.Mutex
+	objects map[objectKey]bool
+}
+
+func newDeletedObjects() *deletedObjects {
+	return &deletedObjects{
+		objects: make(map[objectKey]bool),
+	}
+}
+
+// add records that the object was deleted
+func (d *deletedObjects) add(key objectKey) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.objects[key] = true
+	d.mu.Unlock()
+}
+
+// take returns true if the object was deleted and forgets it, a nil deletedObjects never has any
+func (d *deletedObjects) take(key objectKey) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deleted := d.objects[key]
+	delete(d.objects, key)
+	return deleted
+}
+
+// managedObjects returns the objects NamespaceConfig has created in namespace
+// The status is replaced by the reconciler, so it is read under the lock
+func (c *NamespaceController) managedObjects(NamespaceConfig *v1alpha1.NamespaceConfig, namespace string) []v1alpha1.ManagedObjectStatus {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return NamespaceConfig.ManagedObjectsIn(namespace)
+}
+
+// renderObjects returns the objects NamespaceConfig sets in namespace, stamped with the namespace and the config that owns them
+func (c *NamespaceController) renderObjects(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var errs []error
+
+	for _, h := range c.ObjectHandlers {
+		traceLog.Info("Calling object handler", "handler", h.GetName(), "namespace", namespace.Name, "config", NamespaceConfig.Name)
+		rendered, err := h.Objects(namespace, NamespaceConfig)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		objects = append(objects, rendered...)
+	}
+
+	for _, obj := range objects {
+		obj.SetNamespace(namespace.Name)
+
+		labels := maps.Clone(obj.GetLabels())
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[config.ManagedByLabel] = config.ManagedBy
+		obj.SetLabels(labels)
+
+		annotations := maps.Clone(obj.GetAnnotations())
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[config.ManagedConfigAnnotation] = NamespaceConfig.Name
+		obj.SetAnnotations(annotations)
+	}
+
+	return objects, errors.Join(errs...)
+}
+
+// syncObjects applies the objects NamespaceConfig sets in namespace and deletes the ones it created before but no longer sets.
+// Nothing is deleted when an object failed to render, it may be one of the objects that would be deleted.
+// With no desired objects every object created in the namespace is deleted.
+// The objects created in the namespace are recorded in objects, which may be nil.
+func (c *NamespaceController) syncObjects(ctx context.Context, namespace string, desired []*unstructured.Unstructured, renderErr error, NamespaceConfig *v1alpha1.NamespaceConfig, objects *ObjectResults) error {
+
+	errs := []error{renderErr}
+	fieldManager := k8s.FieldManager(NamespaceConfig.Name)
+	policy := NamespaceConfig.Spec.GetAdoptionPolicy()
+	previous := c.managedObjects(NamespaceConfig, namespace)
+
+	var statuses []v1alpha1.ManagedObjectStatus
+	applied := make(map[objectKey]bool)
+
+	for _, obj := range desired {
+		status := v1alpha1.ManagedObjectStatus{
+			Namespace:  namespace,
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Name:       obj.GetName(),
+			Result:     config.ResultApplied,
+		}
+
+		start := time.Now()
+		err := k8s.ApplyObject(ctx, c.Dynamic, c.Mapper, fieldManager, NamespaceConfig.Name, obj, policy == config.AdoptionAdopt)
+		metrics.ObservePatch(metrics.Namespace, NamespaceConfig.Name, start, err)
+
+		// An object someone else created is left alone, with Skip it is not reported either
+		if errors.Is(err, k8s.ErrUnmanagedObject) && policy == config.AdoptionSkip {
+			debugLog.Info("Object exists and is not managed by the config, skipping", "namespace", namespace, "kind", status.Kind, "name", status.Name)
+			continue
+		}
+
+		if err != nil {
+			log.Error(err, "Error applying object", "namespace", namespace, "kind", status.Kind, "name", status.Name)
+			status.Result = config.ResultFailed
+			status.LastError = err.Error()
+			errs = append(errs, fmt.Errorf("%s %s: %w", status.Kind, status.Name, err))
+		}
+
+		key := objectKey{namespace, status.APIVersion, status.Kind, status.Name}
+		if err == nil && c.deleted.take(key) {
+			c.recordRecreated(status, NamespaceConfig)
+		}
+
+		statuses = append(statuses, status)
+		applied[key] = true
+	}
+
+	for _, status := range previous {
+		if applied[objectKey{namespace, status.APIVersion, status.Kind, status.Name}] {
+			continue
+		}
+
+		// Objects that may still be set are kept until every object renders again
+		if renderErr != nil {
+			statuses = append(statuses, status)
+			continue
+		}
+
+		err := k8s.DeleteObject(ctx, c.Dynamic, c.Mapper, schema.FromAPIVersionAndKind(status.APIVersion, status.Kind), namespace, status.Name, NamespaceConfig.Name)
+		if err != nil {
+			log.Error(err, "Error deleting object", "namespace", namespace, "kind", status.Kind, "name", status.Name)
+			// The object is kept in the status so the delete is tried again
+			status.Result = config.ResultFailed
+			status.LastError = err.Error()
+			statuses = append(statuses, status)
+			errs = append(errs, fmt.Errorf("deleting %s %s: %w", status.Kind, status.Name, err))
+			continue
+		}
+
+		log.Info("Deleted object", "namespace", namespace, "kind", status.Kind, "name", status.Name)
+	}
+
+	objects.Record(namespace, statuses)
+
+	return errors.Join(errs...)
+}
+
+// auditObjects describes each object in desired that is missing, was not created by NamespaceConfig or has fields
+// that do not match the config, for example ResourceQuota compute spec differs. The objects are never changed.
+func (c *NamespaceController) auditObjects(ctx context.Context, desired []*unstructured.Unstructured, NamespaceConfig *v1alpha1.NamespaceConfig) ([]string, error) {
+	var differences []string
+	var errs []error
+
+	for _, obj := range desired {
+		current, err := k8s.GetObject(ctx, c.Dynamic, c.Mapper, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		switch {
+		case apierrors.IsNotFound(err):
+			differences = append(differences, fmt.Sprintf("%s %s is missing", obj.GetKind(), obj.GetName()))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err))
+		case !config.ManagedByConfig(current.GetAnnotations(), NamespaceConfig.Name):
+			differences = append(differences, fmt.Sprintf("%s %s exists and is not managed by the config", obj.GetKind(), obj.GetName()))
+		default:
+			for _, field := range k8s.ObjectDifferences(current, obj) {
+				differences = append(differences, fmt.Sprintf("%s %s %s differs", obj.GetKind(), obj.GetName(), field))
+			}
+		}
+	}
+
+	return differences, errors.Join(errs...)
+}
+
+// recordRecreated reports an object that someone else deleted and NamespaceConfig created again as drift
+func (c *NamespaceController) recordRecreated(status v1alpha1.ManagedObjectStatus, NamespaceConfig *v1alpha1.NamespaceConfig) {
+	log.Info("Created deleted object again", "namespace", status.Namespace, "kind", status.Kind, "name", status.Name, "config", NamespaceConfig.Name)
+
+	drift := config.Drift{
+		Record: config.DriftRecord{
+			Object:    status.Namespace,
+			Kind:      status.Kind,
+			Key:       status.Name,
+			Recreated: true,
+			Time:      metav1.Now(),
+		},
+	}
+	if namespace, exists := c.Cache.Get(status.Namespace); exists {
+		drift.Object = k8s.ObjectReference(namespace)
+	}
+
+	metrics.RecordDrift(metrics.Namespace, NamespaceConfig.Name, 1)
+	c.Drift.Record(NamespaceConfig.Name, []config.Drift{drift})
+}
+
+// pruneNamespace deletes every object NamespaceConfig created in a namespace it no longer selects
+// Audit configs never change their namespaces, so the objects are kept
+func (c *NamespaceController) pruneNamespace(ctx context.Context, namespace string, NamespaceConfig *v1alpha1.NamespaceConfig, objects *ObjectResults) {
+	if NamespaceConfig.Spec.Audits() {
+		objects.Record(namespace, c.managedObjects(NamespaceConfig, namespace))
+		return
+	}
+
+	debugLog.Info("Namespace is no longer selected, deleting objects", "namespace", namespace, "config", NamespaceConfig.Name)
+	if err := c.syncObjects(ctx, namespace, nil, nil, NamespaceConfig, objects); err != nil {
+		log.Error(err, "Error deleting objects", "namespace", namespace)
+	}
+}
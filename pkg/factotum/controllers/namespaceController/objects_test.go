@@ -0,0 +1,299 @@
+package namespacecontroller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+func newObjectController(t *testing.T, objects ...runtime.Object) *NamespaceController {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := v1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(v1.SchemeGroupVersion.WithKind("ResourceQuota"), meta.RESTScopeNamespace)
+
+	return &NamespaceController{
+		Mu:             &sync.Mutex{},
+		Dynamic:        dynamicfake.NewSimpleDynamicClient(scheme, objects...),
+		Mapper:         mapper,
+		ObjectHandlers: []ObjectHandler{NewResourceQuotaHandler()},
+	}
+}
+
+func managedQuota(name string) *v1.ResourceQuota {
+	return &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "team-a",
+			Annotations: map[string]string{config.ManagedConfigAnnotation: "team-quotas"},
+		},
+	}
+}
+
+func TestRenderObjects(t *testing.T) {
+	c := newObjectController(t)
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	nsConfig := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-quotas"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{{Name: "compute"}},
+		},
+	}
+
+	objects, err := c.renderObjects(namespace, nsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("got %d objects, want 1", len(objects))
+	}
+
+	obj := objects[0]
+	if obj.GetNamespace() != "team-a" || obj.GetName() != "compute" || obj.GetKind() != "ResourceQuota" {
+		t.Errorf("got %s %s/%s, want ResourceQuota team-a/compute", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	if obj.GetLabels()[config.ManagedByLabel] != config.ManagedBy {
+		t.Errorf("got labels %v, want the managed by label", obj.GetLabels())
+	}
+	if !config.ManagedByConfig(obj.GetAnnotations(), "team-quotas") {
+		t.Errorf("got annotations %v, want the config annotation", obj.GetAnnotations())
+	}
+}
+
+func TestSyncObjectsPrunes(t *testing.T) {
+	nsConfig := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-quotas"},
+		Status: v1alpha1.NamespaceConfigStatus{
+			ManagedObjects: []v1alpha1.ManagedObjectStatus{
+				{Namespace: "team-a", APIVersion: "v1", Kind: "ResourceQuota", Name: "compute", Result: config.ResultApplied},
+				{Namespace: "team-b", APIVersion: "v1", Kind: "ResourceQuota", Name: "compute", Result: config.ResultApplied},
+			},
+		},
+	}
+	quotas := v1.SchemeGroupVersion.WithResource("resourcequotas")
+
+	t.Run("Render error", func(t *testing.T) {
+		c := newObjectController(t, managedQuota("compute"))
+		objects := NewObjectResults()
+
+		// An object that failed to render may be the one that would be deleted
+		if err := c.syncObjects(context.Background(), "team-a", nil, errors.New("bad template"), nsConfig, objects); err == nil {
+			t.Error("expected the render error")
+		}
+		if _, err := c.Dynamic.Resource(quotas).Namespace("team-a").Get(context.Background(), "compute", metav1.GetOptions{}); err != nil {
+			t.Errorf("quota was deleted: %v", err)
+		}
+		if got := objects.Objects(); len(got) != 1 {
+			t.Errorf("got %d managed objects, want the quota kept", len(got))
+		}
+	})
+
+	t.Run("No longer set", func(t *testing.T) {
+		c := newObjectController(t, managedQuota("compute"))
+		objects := NewObjectResults()
+
+		if err := c.syncObjects(context.Background(), "team-a", nil, nil, nsConfig, objects); err != nil {
+			t.Fatal(err)
+		}
+		_, err := c.Dynamic.Resource(quotas).Namespace("team-a").Get(context.Background(), "compute", metav1.GetOptions{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("quota was not deleted: %v", err)
+		}
+		if got := objects.Objects(); len(got) != 0 {
+			t.Errorf("got managed objects %v, want none", got)
+		}
+	})
+}
+
+func TestSyncObjectsRecreated(t *testing.T) {
+	c := newObjectController(t)
+	c.deleted = newDeletedObjects()
+	c.Drift = config.NewDriftLog()
+	c.Cache = &Cache{ObjMap: make(map[string]*v1.Namespace), Mu: &sync.Mutex{}}
+	c.Cache.Set("team-a", &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+
+	namespace, _ := c.Cache.Get("team-a")
+	nsConfig := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-quotas"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{{Name: "compute"}},
+		},
+	}
+	desired, err := c.renderObjects(namespace, nsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake client cannot apply unstructured objects, every apply succeeds
+	c.Dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "resourcequotas", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, desired[0], nil
+	})
+
+	// Only objects someone else deleted are reported when they are applied
+	if err := c.syncObjects(context.Background(), "team-a", desired, nil, nsConfig, nil); err != nil {
+		t.Fatal(err)
+	}
+	if drifts := c.Drift.Take("team-quotas"); len(drifts) != 0 {
+		t.Fatalf("got drift %v for an object that was not deleted", drifts)
+	}
+
+	c.deleted.add(objectKey{"team-a", "v1", "ResourceQuota", "compute"})
+	if err := c.syncObjects(context.Background(), "team-a", desired, nil, nsConfig, nil); err != nil {
+		t.Fatal(err)
+	}
+	drifts := c.Drift.Take("team-quotas")
+	if len(drifts) != 1 {
+		t.Fatalf("got %d drifts, want 1", len(drifts))
+	}
+	if record := drifts[0].Record; !record.Recreated || record.Object != "team-a" || record.Kind != "ResourceQuota" || record.Key != "compute" {
+		t.Errorf("got drift %+v, want ResourceQuota compute in team-a recreated", record)
+	}
+}
+
+func TestSyncObjectsUnmanaged(t *testing.T) {
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+
+	tests := []struct {
+		policy  config.AdoptionPolicy
+		wantErr bool
+		applied bool
+		objects int
+	}{
+		{policy: config.AdoptionFail, wantErr: true, applied: false, objects: 1},
+		{policy: config.AdoptionSkip, wantErr: false, applied: false, objects: 0},
+		{policy: config.AdoptionAdopt, wantErr: false, applied: true, objects: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			// A quota with the same name that someone else created
+			c := newObjectController(t, &v1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "team-a"}})
+			nsConfig := &v1alpha1.NamespaceConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-quotas"},
+				Spec: v1alpha1.NamespaceConfigSpec{
+					CommonSpec:     config.CommonSpec{AdoptionPolicy: tt.policy},
+					ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{{Name: "compute"}},
+				},
+			}
+			desired, err := c.renderObjects(namespace, nsConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The fake client cannot apply unstructured objects, the apply is recorded instead
+			var patches []k8stesting.Action
+			c.Dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "resourcequotas", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patches = append(patches, action)
+				return true, desired[0], nil
+			})
+
+			objects := NewObjectResults()
+			err = c.syncObjects(context.Background(), "team-a", desired, nil, nsConfig, objects)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("syncObjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if applied := len(patches) == 1; applied != tt.applied {
+				t.Errorf("got %d applies, want the quota taken over %v", len(patches), tt.applied)
+			}
+			if got := objects.Objects(); len(got) != tt.objects {
+				t.Errorf("got managed objects %+v, want %d", got, tt.objects)
+			}
+		})
+	}
+}
+
+func TestAuditObjects(t *testing.T) {
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	nsConfig := &v1alpha1.NamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-quotas"},
+		Spec: v1alpha1.NamespaceConfigSpec{
+			ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{
+				{Name: "compute", Spec: v1.ResourceQuotaSpec{Hard: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("10")}}},
+			},
+		},
+	}
+
+	desired, err := newObjectController(t).renderObjects(namespace, nsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The api server adds fields the config does not set, they are not differences
+	matching := desired[0].DeepCopy()
+	matching.SetUID("1234")
+	if err := unstructured.SetNestedStringSlice(matching.Object, []string{"Terminating"}, "spec", "scopes"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := desired[0].DeepCopy()
+	if err := unstructured.SetNestedField(changed.Object, "20", "spec", "hard", "limits.cpu"); err != nil {
+		t.Fatal(err)
+	}
+
+	unmanaged := desired[0].DeepCopy()
+	unmanaged.SetAnnotations(nil)
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		expected []string
+	}{
+		{name: "Matching", objects: []runtime.Object{matching}},
+		{name: "Missing", expected: []string{"ResourceQuota compute is missing"}},
+		{name: "Changed", objects: []runtime.Object{changed}, expected: []string{"ResourceQuota compute spec differs"}},
+		{name: "Unmanaged", objects: []runtime.Object{unmanaged}, expected: []string{"ResourceQuota compute exists and is not managed by the config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newObjectController(t, tt.objects...)
+
+			differences, err := c.auditObjects(context.Background(), desired, nsConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(differences, tt.expected) {
+				t.Errorf("got differences %q, want %q", differences, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetUnmatchedNamespaces(t *testing.T) {
+	c := newObjectController(t)
+	nsConfig := &v1alpha1.NamespaceConfig{
+		Status: v1alpha1.NamespaceConfigStatus{
+			ManagedObjects: []v1alpha1.ManagedObjectStatus{
+				{Namespace: "team-a", Kind: "ResourceQuota", Name: "compute"},
+				{Namespace: "team-a", Kind: "ResourceQuota", Name: "storage"},
+				{Namespace: "team-b", Kind: "ResourceQuota", Name: "compute"},
+			},
+		},
+	}
+	matching := []*v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}}
+
+	got := c.GetUnmatchedNamespaces(nsConfig, matching)
+	if len(got) != 1 || got[0] != "team-b" {
+		t.Errorf("got %v, want [team-b]", got)
+	}
+}
@@ -1,29 +1,139 @@
 package namespacecontroller
 
 import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	"github.com/rjbrown57/factotum/pkg/k8s"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (c *NamespaceController) Update(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) error {
+// render runs the handlers against a copy of namespace and returns the copy, the config with any keys lost
+// to higher priority configs dropped, the conflicts and the handler errors
+func (c *NamespaceController) render(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) (*v1.Namespace, *v1alpha1.NamespaceConfig, []config.Conflict, []error) {
 
-	var err error = nil
+	var handlerErrs []error
 
 	newNs := namespace.DeepCopy()
 
+	// Drop any keys this config loses to a higher priority config selecting the same namespace
+	resolved, conflicts := c.ResolveConflicts(namespace, NamespaceConfig)
+
 	for _, h := range c.Handlers {
 		// Call the handler functions
 		traceLog.Info("Calling handler", "handler", h.GetName(), "node", namespace.Name, "config", NamespaceConfig.Name)
-		_ = h.Update(newNs, NamespaceConfig)
+		// A handler error does not stop the rest of the config from being applied
+		if _, handlerErr := h.Update(newNs, resolved); handlerErr != nil {
+			handlerErrs = append(handlerErrs, handlerErr)
+		}
 	}
 
-	_, err = k8s.StrategicMerge(c.K8sClient, namespace, newNs)
+	return newNs, resolved, conflicts, handlerErrs
+}
+
+// Audit returns how namespace and the objects in it differ from NamespaceConfig without changing them
+func (c *NamespaceController) Audit(ctx context.Context, namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]string, error) {
+
+	newNs, resolved, conflicts, handlerErrs := c.render(namespace, NamespaceConfig)
+
+	differences := config.Differences(config.KindLabel, namespace.Labels, k8s.FilterMap(newNs.Labels, resolved.GetLabelSet()))
+	differences = append(differences, config.Differences(config.KindAnnotation, namespace.Annotations, k8s.FilterMap(newNs.Annotations, resolved.GetAnnotationSet()))...)
+
+	desired, renderErr := c.renderObjects(namespace, NamespaceConfig)
+	objectDifferences, auditErr := c.auditObjects(ctx, dropLostObjects(desired, conflicts), NamespaceConfig)
+	differences = append(differences, objectDifferences...)
+
+	return differences, errors.Join(append(handlerErrs, renderErr, auditErr)...)
+}
+
+// Update applies NamespaceConfig to namespace and creates, updates and deletes the objects it sets in the namespace
+// The objects created in the namespace are recorded in objects, which may be nil
+func (c *NamespaceController) Update(ctx context.Context, namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig, objects *ObjectResults) error {
+
+	var err error = nil
+
+	newNs, resolved, conflicts, handlerErrs := c.render(namespace, NamespaceConfig)
+
+	// Objects are applied first, an object that fails does not stop the labels and annotations from being applied
+	desired, renderErr := c.renderObjects(namespace, NamespaceConfig)
+	desired = dropLostObjects(desired, conflicts)
+	handlerErrs = append(handlerErrs, c.syncObjects(ctx, namespace.Name, desired, renderErr, NamespaceConfig, objects))
+
+	fieldManager := k8s.FieldManager(NamespaceConfig.Name)
+	policy := resolved.Spec.GetAdoptionPolicy()
+
+	// Keys are only set and removed when this config owns them, see config.ClaimKeys
+	record, others := config.ReadOwnershipRecords(namespace.Annotations, NamespaceConfig.Name)
+	appliedLabels, appliedAnnotations, _ := k8s.AppliedKeys(namespace, fieldManager)
+
+	labels := config.ClaimKeys(config.KindLabel, namespace.Labels, k8s.FilterMap(newNs.Labels, resolved.GetLabelSet()), record, others, appliedLabels, policy)
+	annotations := config.ClaimKeys(config.KindAnnotation, namespace.Annotations, k8s.FilterMap(newNs.Annotations, resolved.GetAnnotationSet()), record, others, appliedAnnotations, policy)
+	handlerErrs = append(handlerErrs, labels.Err, annotations.Err)
+
+	// Released keys are set back to the value they replaced before this config stops applying them
+	if len(labels.Restore) > 0 || len(annotations.Restore) > 0 {
+		start := time.Now()
+		err = k8s.Restore(ctx, c.K8sClient, namespace, labels.Restore, annotations.Restore)
+		metrics.ObservePatch(metrics.Namespace, NamespaceConfig.Name, start, err)
+	}
+	if err != nil {
+		log.Error(err, "Error restoring obj", "obj", namespace.Name)
+		return c.event(namespace, NamespaceConfig, errors.Join(append(handlerErrs, err)...))
+	}
+
+	record = config.OwnershipRecord{Labels: labels.Owned, Annotations: annotations.Owned}
+	if !record.IsEmpty() {
+		annotations.Apply[config.OwnershipAnnotation(NamespaceConfig.Name)] = record.Encode()
+	}
+	resolved.Spec.MarkApplied(annotations.Apply, NamespaceConfig.Name)
+
+	// Only the fields owned by this config are applied, anything the config no longer
+	// sets is dropped by the api server since it was applied by the same field manager
+	applyNs := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        namespace.Name,
+			Labels:      labels.Apply,
+			Annotations: annotations.Apply,
+		},
+	}
+
+	start := time.Now()
+	_, err = k8s.Apply(ctx, c.K8sClient, fieldManager, applyNs, policy == config.AdoptionAdopt || config.Drifted(labels, annotations))
+	metrics.ObservePatch(metrics.Namespace, NamespaceConfig.Name, start, err)
 	if err != nil {
 		log.Error(err, "Error updating obj", "obj", namespace.Name)
 	} else {
 		log.Info("Updated obj", "obj", namespace.Name)
+		// Keys someone else changed have been set back, the reconciler records them in the config status
+		drifts := config.Drifts(k8s.ObjectReference(namespace), time.Now(), labels, annotations)
+		metrics.RecordDrift(metrics.Namespace, NamespaceConfig.Name, len(drifts))
+		c.Drift.Record(NamespaceConfig.Name, drifts)
+	}
+
+	// Handler errors, such as templates that failed to render, are reported with the apply result
+	return c.event(namespace, NamespaceConfig, errors.Join(append(handlerErrs, err)...))
+}
+
+// event reports the result of applying NamespaceConfig to namespace as an event on the namespace and returns err
+// Repeated identical events are aggregated by the recorder
+func (c *NamespaceController) event(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig, err error) error {
+	if c.Recorder == nil {
+		return err
+	}
+
+	ref := k8s.ObjectReference(namespace)
+	if err != nil {
+		c.Recorder.Eventf(ref, v1.EventTypeWarning, config.EventReasonApplyFailed, "NamespaceConfig %s failed: %s", NamespaceConfig.Name, err)
+	} else {
+		c.Recorder.Eventf(ref, v1.EventTypeNormal, config.EventReasonApplied, "Updated by NamespaceConfig %s", NamespaceConfig.Name)
 	}
 
 	return err
@@ -31,37 +141,139 @@ func (c *NamespaceController) Update(namespace *v1.Namespace, NamespaceConfig *v
 
 // Proccessor will apply the changes to the objs
 // It will be called when the NamespaceController receives a message on the receive only MsgChan channel
-func (c *NamespaceController) Proccessor() error {
+// It returns once ctx is done
+func (c *NamespaceController) Proccessor(ctx context.Context) error {
+
+	for {
+		var msg Msg
+		select {
+		case <-ctx.Done():
+			debugLog.Info("Stopping Proccessor")
+			return nil
+		case msg = <-c.MsgChan:
+		}
 
-	for msg := range c.MsgChan {
+		// tasks counts the objs still being processed for this message
+		tasks := &sync.WaitGroup{}
+		submit := func(obj string, run func()) {
+			tasks.Add(1)
+			c.Pool.Submit(obj, run, tasks.Done)
+		}
 
 		// If msg obj is nil, we apply to all objs, This indicates the msg is from the reconciler and we can pass the config
 		switch {
+		// A namespace the config failed to apply to is retried once its backoff has passed
+		case msg.Retry:
+			submit(msg.Namespace.Name, func() {
+				c.retryNamespace(msg.Ctx, msg.Namespace, msg.Config)
+			})
+
 		case msg.Namespace == nil:
-			for _, obj := range c.GetMatchingNamespaces(msg.Config) {
-				log.Info("Processing obj", "obj", obj.Name)
-				if err := c.Update(obj, msg.Config); err != nil {
-					log.Error(err, "Error processing obj", "obj", obj.Name)
-				}
+			matching := c.GetMatchingNamespaces(msg.Config)
+			for _, obj := range matching {
+				submit(obj.Name, func() {
+					c.processNamespace(msg.Ctx, obj, msg)
+				})
+			}
+
+			// Namespaces the config no longer selects have the objects it created in them deleted
+			for _, name := range c.GetUnmatchedNamespaces(msg.Config, matching) {
+				submit(name, func() {
+					c.pruneNamespace(msg.Ctx, name, msg.Config, msg.Objects)
+				})
 			}
 		// Update to a specific obj
 		// If msg obj is not nil, we apply to the specific obj, This indicates the msg is from the watcher so we need to use our cache
 		case msg.Namespace != nil:
-			obj := msg.Namespace
-			// If the Node Has Configs that match we will process the obj
-			for _, NamespaceConfig := range c.GetMatchingNamespaceConfigs(obj) {
-				log.Info("Processing obj", "obj", obj.Name)
-				if err := c.Update(obj, NamespaceConfig); err != nil {
-					log.Error(err, "Error processing obj", "obj", obj.Name)
-				}
+			// Changes made to the obj while it waits for a worker are covered by the waiting task,
+			// which reads the obj from the cache when it runs
+			tasks.Add(1)
+			queued := c.Pool.SubmitCoalesced(msg.Namespace.Name, func() {
+				c.watchNamespace(msg.Ctx, msg.Namespace.Name, msg.Previous)
+			}, tasks.Done)
+			if !queued {
+				debugLog.Info("Obj change coalesced with a waiting change", "obj", msg.Namespace.Name)
 			}
 		}
 
-		// Notify the WaitGroup that we are done processing
-		c.Wg.Done()
+		// Tell the sender we are done processing once every obj has been processed
+		go func() {
+			tasks.Wait()
+			if msg.Done != nil {
+				close(msg.Done)
+			}
+			metrics.QueueDepth.WithLabelValues(metrics.Namespace).Dec()
+		}()
 	}
+}
 
-	return nil
+// processNamespace audits or applies the config of a reconciler message to a single obj and records the result
+func (c *NamespaceController) processNamespace(ctx context.Context, obj *v1.Namespace, msg Msg) {
+	if msg.Config.Spec.Audits() {
+		differences, err := c.Audit(ctx, obj, msg.Config)
+		debugLog.Info("Audited obj", "obj", obj.Name, "differences", differences)
+		msg.Results.RecordAudit(obj.Name, differences, err)
+		// Objects created before the config was set to Audit are left alone
+		msg.Objects.Record(obj.Name, c.managedObjects(msg.Config, obj.Name))
+		return
+	}
+
+	var err error
+	if msg.Config.Spec.AppliedOnce(obj.Annotations, msg.Config.Name) {
+		debugLog.Info("Config has already been applied once, skipping", "obj", obj.Name, "config", msg.Config.Name)
+		msg.Objects.Record(obj.Name, c.managedObjects(msg.Config, obj.Name))
+	} else {
+		log.Info("Processing obj", "obj", obj.Name)
+		if err = c.apply(ctx, obj, msg.Config, msg.Objects); err != nil {
+			log.Error(err, "Error processing obj", "obj", obj.Name)
+		}
+	}
+	msg.Results.Record(obj.Name, err)
+}
+
+// watchNamespace cleans and applies the configs of an obj that was changed, previous is the obj before the change
+// The obj is read from the cache so the latest version is used
+func (c *NamespaceController) watchNamespace(ctx context.Context, name string, previous *v1.Namespace) {
+	obj, exists := c.Cache.Get(name)
+	if !exists {
+		debugLog.Info("Obj has been deleted, skipping", "obj", name)
+		return
+	}
+
+	// Configs that matched the previous version of the obj but no longer match are cleaned from the obj,
+	// their labels and annotations are removed and the objects they created in it are deleted
+	cleaned := make(map[string]bool)
+	for _, NamespaceConfig := range c.GetDeselectedNamespaceConfigs(previous, obj) {
+		if NamespaceConfig.Spec.Audits() {
+			continue
+		}
+		debugLog.Info("Obj no longer matches config, cleaning", "obj", obj.Name, "config", NamespaceConfig.Name)
+		NamespaceConfig.Cleanup()
+		if err := c.Update(ctx, obj, NamespaceConfig, nil); err != nil {
+			log.Error(err, "Error cleaning obj", "obj", obj.Name)
+		}
+		cleaned[NamespaceConfig.Name] = true
+	}
+
+	// If the Node Has Configs that match we will process the obj
+	for _, NamespaceConfig := range c.GetMatchingNamespaceConfigs(obj) {
+		// Audit configs are reported by the reconciler, ApplyOnce configs only apply to namespaces that newly match
+		if NamespaceConfig.Spec.Audits() || NamespaceConfig.Spec.AppliedOnce(obj.Annotations, NamespaceConfig.Name) {
+			debugLog.Info("Config is not enforced on obj, skipping", "obj", obj.Name, "config", NamespaceConfig.Name, "enforcement", NamespaceConfig.Spec.GetEnforcement())
+			continue
+		}
+		log.Info("Processing obj", "obj", obj.Name)
+		if err := c.apply(ctx, obj, NamespaceConfig, nil); err != nil {
+			log.Error(err, "Error processing obj", "obj", obj.Name)
+		}
+	}
+
+	// Other configs that no longer select the obj delete the objects they created in it
+	for _, NamespaceConfig := range c.GetUnmatchedNamespaceConfigs(obj) {
+		if !cleaned[NamespaceConfig.Name] {
+			c.pruneNamespace(ctx, obj.Name, NamespaceConfig, nil)
+		}
+	}
 }
 
 func (c *NamespaceController) GetMatchingNamespaceConfigs(obj *v1.Namespace) []*v1alpha1.NamespaceConfig {
@@ -76,13 +288,65 @@ func (c *NamespaceController) GetMatchingNamespaceConfigs(obj *v1.Namespace) []*
 	}
 
 	c.Mu.Unlock()
+
+	// Order by priority so configs are always applied and resolved in the same order
+	slices.SortFunc(matchingConfigs, func(a, b *v1alpha1.NamespaceConfig) int {
+		return config.ComparePriority(a, b)
+	})
+
 	return matchingConfigs
 }
 
+// GetDeselectedNamespaceConfigs returns copies of the configs that matched the previous version of obj but do not match the current one
+func (c *NamespaceController) GetDeselectedNamespaceConfigs(previous, obj *v1.Namespace) []*v1alpha1.NamespaceConfig {
+	var deselected []*v1alpha1.NamespaceConfig
+
+	if previous == nil {
+		return deselected
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	for _, NamespaceConfig := range c.NamespaceConfigs {
+		if NamespaceConfig.Match(previous) && !NamespaceConfig.Match(obj) {
+			deselected = append(deselected, NamespaceConfig.DeepCopy())
+		}
+	}
+
+	return deselected
+}
+
+// GetUnmatchedNamespaceConfigs returns the NamespaceConfigs that have created objects in obj but no longer select it
+func (c *NamespaceController) GetUnmatchedNamespaceConfigs(obj *v1.Namespace) []*v1alpha1.NamespaceConfig {
+	var unmatched []*v1alpha1.NamespaceConfig
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	for _, NamespaceConfig := range c.NamespaceConfigs {
+		if !NamespaceConfig.Match(obj) && len(NamespaceConfig.ManagedObjectsIn(obj.Name)) > 0 {
+			unmatched = append(unmatched, NamespaceConfig)
+		}
+	}
+
+	return unmatched
+}
+
+// GetUnmatchedNamespaces returns the namespaces NamespaceConfig has created objects in that are not in matching
+func (c *NamespaceController) GetUnmatchedNamespaces(NamespaceConfig *v1alpha1.NamespaceConfig, matching []*v1.Namespace) []string {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return slices.DeleteFunc(NamespaceConfig.ManagedNamespaces(), func(name string) bool {
+		return slices.ContainsFunc(matching, func(obj *v1.Namespace) bool { return obj.Name == name })
+	})
+}
+
 func (c *NamespaceController) GetMatchingNamespaces(NamespaceConfig *v1alpha1.NamespaceConfig) []*v1.Namespace {
 	var matchingNamespaces []*v1.Namespace
 
-	for _, obj := range c.Cache.ObjMap {
+	for _, obj := range c.Cache.List() {
 		if NamespaceConfig.Match(obj) {
 			matchingNamespaces = append(matchingNamespaces, obj)
 		}
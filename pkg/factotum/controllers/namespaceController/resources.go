@@ -0,0 +1,93 @@
+package namespacecontroller
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
+)
+
+// ResourceHandler creates the resources of a NamespaceConfig, manifests of any namespaced kind, in each selected namespace
+// String values in a manifest marked as a template are rendered for the namespace, a manifest that fails to render is not applied
+type ResourceHandler struct{}
+
+func (h *ResourceHandler) Objects(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var errs []error
+
+	data := fcHandlers.NewTemplateData(namespace, NamespaceConfig.Captures(namespace))
+
+	for i, resource := range NamespaceConfig.Spec.Resources {
+		obj, err := renderManifest(resource, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resources[%d]: %w", i, err))
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, errors.Join(errs...)
+}
+
+func (h *ResourceHandler) GetName() string {
+	return "ResourceHandler"
+}
+
+// renderManifest decodes the manifest of resource and, when it is a template, renders every string value in it
+func renderManifest(resource v1alpha1.ResourceTemplate, data fcHandlers.TemplateData) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(resource.Manifest.Raw); err != nil {
+		return nil, err
+	}
+
+	if resource.Template {
+		rendered, err := renderValue(obj.Object, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		obj.Object = rendered.(map[string]any)
+	}
+
+	if obj.GetAPIVersion() == "" || obj.GetName() == "" {
+		return nil, fmt.Errorf("%s %s: apiVersion, kind and metadata.name must be set", obj.GetKind(), obj.GetName())
+	}
+
+	return obj, nil
+}
+
+// renderValue returns a copy of value, a decoded manifest or part of one, with every string rendered
+func renderValue(value any, data fcHandlers.TemplateData) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return fcHandlers.Render(value, data)
+	case map[string]any:
+		// Keys are rendered in order so the reported error is stable between reconciles
+		rendered := make(map[string]any, len(value))
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			r, err := renderValue(value[key], data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case []any:
+		rendered := make([]any, 0, len(value))
+		for i, v := range value {
+			r, err := renderValue(v, data)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			rendered = append(rendered, r)
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,103 @@
+package namespacecontroller
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+)
+
+func manifest(raw string) v1alpha1.ResourceTemplate {
+	return v1alpha1.ResourceTemplate{Manifest: v1alpha1.ResourceManifest{RawExtension: runtime.RawExtension{Raw: []byte(raw)}}}
+}
+
+func templated(raw string) v1alpha1.ResourceTemplate {
+	resource := manifest(raw)
+	resource.Template = true
+	return resource
+}
+
+func TestResourceHandler(t *testing.T) {
+	handler := ResourceHandler{}
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "payments"}}}
+
+	t.Run("Rendered", func(t *testing.T) {
+		nsConfig := &v1alpha1.NamespaceConfig{
+			Spec: v1alpha1.NamespaceConfigSpec{
+				Resources: []v1alpha1.ResourceTemplate{
+					templated(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"{{ .Name }}-settings","labels":{"team":"{{ .Labels.team }}"}},"data":{"owners":"{{ .Labels.team }}","replicas":"2"}}`),
+					manifest(`{"apiVersion":"v1","kind":"ServiceAccount","metadata":{"name":"deployer"}}`),
+				},
+			},
+		}
+
+		objects, err := handler.Objects(namespace, nsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) != 2 {
+			t.Fatalf("got %d resources, want 2", len(objects))
+		}
+
+		configMap := objects[0]
+		if configMap.GetKind() != "ConfigMap" || configMap.GetName() != "team-a-settings" {
+			t.Errorf("got %s %s, want ConfigMap team-a-settings", configMap.GetKind(), configMap.GetName())
+		}
+		if configMap.GetLabels()["team"] != "payments" {
+			t.Errorf("got labels %v, want team payments", configMap.GetLabels())
+		}
+		data, _, _ := unstructured.NestedStringMap(configMap.Object, "data")
+		if data["owners"] != "payments" || data["replicas"] != "2" {
+			t.Errorf("got data %v, want owners payments and replicas 2", data)
+		}
+		if objects[1].GetKind() != "ServiceAccount" || objects[1].GetName() != "deployer" {
+			t.Errorf("got %s %s, want ServiceAccount deployer", objects[1].GetKind(), objects[1].GetName())
+		}
+	})
+
+	t.Run("Not a template", func(t *testing.T) {
+		nsConfig := &v1alpha1.NamespaceConfig{
+			Spec: v1alpha1.NamespaceConfigSpec{
+				Resources: []v1alpha1.ResourceTemplate{
+					manifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"dashboards"},"data":{"title":"{{ .Labels.owner }}"}}`),
+				},
+			},
+		}
+
+		// Values of a manifest that is not a template are applied as written
+		objects, err := handler.Objects(namespace, nsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _, _ := unstructured.NestedStringMap(objects[0].Object, "data")
+		if data["title"] != "{{ .Labels.owner }}" {
+			t.Errorf("got title %q, want the value as written", data["title"])
+		}
+	})
+
+	t.Run("Invalid manifests", func(t *testing.T) {
+		nsConfig := &v1alpha1.NamespaceConfig{
+			Spec: v1alpha1.NamespaceConfigSpec{
+				Resources: []v1alpha1.ResourceTemplate{
+					templated(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"},"data":{"owner":"{{ .Labels.owner }}"}}`),
+					manifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{}}`),
+					manifest(`{"apiVersion":"v1","metadata":{"name":"settings"}}`),
+					manifest(`{"apiVersion":"v1","kind":"ServiceAccount","metadata":{"name":"deployer"}}`),
+				},
+			},
+		}
+
+		// Only the manifests that render are returned, the rest are reported in the error
+		objects, err := handler.Objects(namespace, nsConfig)
+		if err == nil {
+			t.Error("expected errors for the manifests that failed to render")
+		}
+		if len(objects) != 1 || objects[0].GetName() != "deployer" {
+			t.Errorf("got %d resources, want only the ServiceAccount", len(objects))
+		}
+	})
+}
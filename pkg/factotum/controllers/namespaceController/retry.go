@@ -0,0 +1,58 @@
+package namespacecontroller
+
+import (
+	"context"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/retry"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// apply updates namespace with NamespaceConfig and queues the namespace to be retried when the update fails with a retriable error
+// The objects created in the namespace are recorded in objects, which may be nil
+func (c *NamespaceController) apply(ctx context.Context, namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig, objects *ObjectResults) error {
+	err := c.Update(ctx, namespace, NamespaceConfig, objects)
+	c.Retries.Result(retry.Key{Config: NamespaceConfig.Name, Object: namespace.Name}, err)
+	return err
+}
+
+// retry sends a namespace NamespaceConfig failed to apply to back to the Proccessor with the current NamespaceConfig
+// Namespaces and NamespaceConfigs that have since been deleted are dropped from the queue
+// The reconciler keys the NamespaceConfigs by their namespaced name
+func (c *NamespaceController) retry(ctx context.Context, key retry.Key) {
+	c.Mu.Lock()
+	NamespaceConfig, exists := c.NamespaceConfigs[types.NamespacedName{Name: key.Config}.String()]
+	c.Mu.Unlock()
+
+	namespace, cached := c.Cache.Get(key.Object)
+	if !exists || !cached {
+		debugLog.Info("Namespace or config no longer exists, not retrying", "namespace", key.Object, "config", key.Config)
+		c.Retries.Result(key, nil)
+		return
+	}
+
+	if err := c.Notify(ctx, Msg{
+		Header:    "Retry",
+		Namespace: namespace,
+		Config:    NamespaceConfig,
+		Retry:     true,
+	}); err != nil {
+		debugLog.Info("Controller stopped, not retrying", "namespace", key.Object, "config", key.Config)
+	}
+}
+
+// retryNamespace applies NamespaceConfig to a namespace that is being retried, unless the namespace no longer needs it
+func (c *NamespaceController) retryNamespace(ctx context.Context, namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) {
+	if !NamespaceConfig.Match(namespace) || NamespaceConfig.Spec.Audits() || NamespaceConfig.Spec.AppliedOnce(namespace.Annotations, NamespaceConfig.Name) {
+		debugLog.Info("Config no longer applies to namespace, not retrying", "namespace", namespace.Name, "config", NamespaceConfig.Name)
+		c.Retries.Result(retry.Key{Config: NamespaceConfig.Name, Object: namespace.Name}, nil)
+		return
+	}
+
+	debugLog.Info("Retrying namespace", "namespace", namespace.Name, "config", NamespaceConfig.Name)
+	if err := c.apply(ctx, namespace, NamespaceConfig, nil); err != nil {
+		log.Error(err, "Error retrying namespace", "namespace", namespace.Name)
+	}
+}
@@ -0,0 +1,83 @@
+package namespacecontroller
+
+import (
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+)
+
+// RoleBindingHandler creates the roleBindings of a NamespaceConfig in each selected namespace
+// The subject names and namespaces are rendered for the namespace, so a binding follows the labels it is templated from
+type RoleBindingHandler struct{}
+
+func (h *RoleBindingHandler) Objects(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var errs []error
+
+	data := fcHandlers.NewTemplateData(namespace, NamespaceConfig.Captures(namespace))
+
+	for _, binding := range NamespaceConfig.Spec.RoleBindings {
+		// The binding is still applied without the subjects that failed, so a subject rendered
+		// from a label that was since removed does not keep its access
+		subjects, err := renderSubjects(binding.Subjects, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("roleBinding %s: %w", binding.Name, err))
+		}
+
+		obj, err := k8s.ToUnstructured(&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: binding.Name, Namespace: namespace.Name},
+			RoleRef:    binding.RoleRef,
+			Subjects:   subjects,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("roleBinding %s: %w", binding.Name, err))
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, errors.Join(errs...)
+}
+
+func (h *RoleBindingHandler) GetName() string {
+	return "RoleBindingHandler"
+}
+
+// renderSubjects returns a copy of subjects with their names and namespaces rendered
+// Subjects that fail to render, or render to an empty name, are left out and returned in the error
+func renderSubjects(subjects []rbacv1.Subject, data fcHandlers.TemplateData) ([]rbacv1.Subject, error) {
+	var rendered []rbacv1.Subject
+	var errs []error
+
+	for _, subject := range subjects {
+		name, err := fcHandlers.Render(subject.Name, data)
+		if err == nil && name == "" {
+			err = errors.New("rendered to an empty name")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render subject %s: %w", subject.Name, err))
+			continue
+		}
+
+		namespace, err := fcHandlers.Render(subject.Namespace, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render the namespace of subject %s: %w", subject.Name, err))
+			continue
+		}
+
+		subject.Name = name
+		subject.Namespace = namespace
+		rendered = append(rendered, subject)
+	}
+
+	return rendered, errors.Join(errs...)
+}
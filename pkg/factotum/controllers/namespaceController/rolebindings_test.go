@@ -0,0 +1,74 @@
+package namespacecontroller
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+)
+
+func TestRoleBindingHandler(t *testing.T) {
+	handler := RoleBindingHandler{}
+	nsConfig := &v1alpha1.NamespaceConfig{
+		Spec: v1alpha1.NamespaceConfigSpec{
+			RoleBindings: []v1alpha1.RoleBindingTemplate{{
+				Name:    "team-admins",
+				RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "admin"},
+				Subjects: []rbacv1.Subject{
+					{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "{{ .Labels.team }}-admins"},
+					{Kind: rbacv1.ServiceAccountKind, Name: "deployer", Namespace: "{{ .Name }}"},
+				},
+			}},
+		},
+	}
+
+	binding := func(t *testing.T, namespace *v1.Namespace) (*rbacv1.RoleBinding, error) {
+		t.Helper()
+
+		objects, err := handler.Objects(namespace, nsConfig)
+		if len(objects) != 1 {
+			t.Fatalf("got %d roleBindings, want 1", len(objects))
+		}
+		if objects[0].GetKind() != "RoleBinding" || objects[0].GetName() != "team-admins" {
+			t.Errorf("got %s %s, want RoleBinding team-admins", objects[0].GetKind(), objects[0].GetName())
+		}
+
+		binding := &rbacv1.RoleBinding{}
+		if convErr := runtime.DefaultUnstructuredConverter.FromUnstructured(objects[0].Object, binding); convErr != nil {
+			t.Fatal(convErr)
+		}
+		return binding, err
+	}
+
+	t.Run("Rendered", func(t *testing.T) {
+		namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "payments"}}}
+
+		got, err := binding(t, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.RoleRef.Name != "admin" {
+			t.Errorf("got roleRef %+v, want ClusterRole admin", got.RoleRef)
+		}
+		if len(got.Subjects) != 2 || got.Subjects[0].Name != "payments-admins" || got.Subjects[1].Namespace != "team-a" {
+			t.Errorf("got subjects %+v, want group payments-admins and service account deployer in team-a", got.Subjects)
+		}
+	})
+
+	t.Run("Missing label", func(t *testing.T) {
+		namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+
+		// The group of a removed team label must not keep its access
+		got, err := binding(t, namespace)
+		if err == nil {
+			t.Error("expected an error for the subject that failed to render")
+		}
+		if len(got.Subjects) != 1 || got.Subjects[0].Name != "deployer" {
+			t.Errorf("got subjects %+v, want only the service account", got.Subjects)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package namespacecontroller
+
+import (
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+)
+
+// TemplateObject is the typed object created from a template
+type TemplateObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// TemplateHandler creates an object in each selected namespace for every template of one kind in a NamespaceConfig
+type TemplateHandler[T any] struct {
+	Name string
+	// Field is the spec field the templates are listed in, it is used in errors
+	Field string
+	// Templates returns the templates of the NamespaceConfig
+	Templates func(NamespaceConfig *v1alpha1.NamespaceConfig) []T
+	// Object returns the object created from a template, with its apiVersion, kind and name set
+	Object func(template T) TemplateObject
+}
+
+func (h *TemplateHandler[T]) Objects(namespace *v1.Namespace, NamespaceConfig *v1alpha1.NamespaceConfig) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var errs []error
+
+	for _, template := range h.Templates(NamespaceConfig) {
+		typed := h.Object(template)
+		typed.SetNamespace(namespace.Name)
+
+		obj, err := k8s.ToUnstructured(typed)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", h.Field, typed.GetName(), err))
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, errors.Join(errs...)
+}
+
+func (h *TemplateHandler[T]) GetName() string {
+	return h.Name
+}
+
+// NewResourceQuotaHandler creates the resourceQuotas of a NamespaceConfig in each selected namespace
+func NewResourceQuotaHandler() *TemplateHandler[v1alpha1.ResourceQuotaTemplate] {
+	return &TemplateHandler[v1alpha1.ResourceQuotaTemplate]{
+		Name:  "ResourceQuotaHandler",
+		Field: "resourceQuota",
+		Templates: func(NamespaceConfig *v1alpha1.NamespaceConfig) []v1alpha1.ResourceQuotaTemplate {
+			return NamespaceConfig.Spec.ResourceQuotas
+		},
+		Object: func(quota v1alpha1.ResourceQuotaTemplate) TemplateObject {
+			return &v1.ResourceQuota{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"},
+				ObjectMeta: metav1.ObjectMeta{Name: quota.Name},
+				Spec:       quota.Spec,
+			}
+		},
+	}
+}
+
+// NewLimitRangeHandler creates the limitRanges of a NamespaceConfig in each selected namespace
+func NewLimitRangeHandler() *TemplateHandler[v1alpha1.LimitRangeTemplate] {
+	return &TemplateHandler[v1alpha1.LimitRangeTemplate]{
+		Name:  "LimitRangeHandler",
+		Field: "limitRange",
+		Templates: func(NamespaceConfig *v1alpha1.NamespaceConfig) []v1alpha1.LimitRangeTemplate {
+			return NamespaceConfig.Spec.LimitRanges
+		},
+		Object: func(limitRange v1alpha1.LimitRangeTemplate) TemplateObject {
+			return &v1.LimitRange{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "LimitRange"},
+				ObjectMeta: metav1.ObjectMeta{Name: limitRange.Name},
+				Spec:       limitRange.Spec,
+			}
+		},
+	}
+}
+
+// NewNetworkPolicyHandler creates the networkPolicies of a NamespaceConfig in each selected namespace
+func NewNetworkPolicyHandler() *TemplateHandler[v1alpha1.NetworkPolicyTemplate] {
+	return &TemplateHandler[v1alpha1.NetworkPolicyTemplate]{
+		Name:  "NetworkPolicyHandler",
+		Field: "networkPolicy",
+		Templates: func(NamespaceConfig *v1alpha1.NamespaceConfig) []v1alpha1.NetworkPolicyTemplate {
+			return NamespaceConfig.Spec.NetworkPolicies
+		},
+		Object: func(policy v1alpha1.NetworkPolicyTemplate) TemplateObject {
+			return &networkingv1.NetworkPolicy{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+				ObjectMeta: metav1.ObjectMeta{Name: policy.Name},
+				Spec:       policy.Spec,
+			}
+		},
+	}
+}
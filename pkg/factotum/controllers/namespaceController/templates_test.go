@@ -0,0 +1,111 @@
+package namespacecontroller
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+)
+
+func TestTemplateHandlers(t *testing.T) {
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+
+	tests := []struct {
+		name       string
+		handler    ObjectHandler
+		spec       v1alpha1.NamespaceConfigSpec
+		apiVersion string
+		kind       string
+		names      []string
+		// field of the first object must hold value, copied from its template
+		field []string
+		value any
+	}{
+		{
+			name:    "ResourceQuotas",
+			handler: NewResourceQuotaHandler(),
+			spec: v1alpha1.NamespaceConfigSpec{
+				ResourceQuotas: []v1alpha1.ResourceQuotaTemplate{
+					{Name: "compute", Spec: v1.ResourceQuotaSpec{Hard: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("10")}}},
+					{Name: "objects", Spec: v1.ResourceQuotaSpec{Hard: v1.ResourceList{"count/configmaps": resource.MustParse("50")}}},
+				},
+			},
+			apiVersion: "v1",
+			kind:       "ResourceQuota",
+			names:      []string{"compute", "objects"},
+			field:      []string{"spec", "hard"},
+			value:      map[string]any{"limits.cpu": "10"},
+		},
+		{
+			name:    "LimitRanges",
+			handler: NewLimitRangeHandler(),
+			spec: v1alpha1.NamespaceConfigSpec{
+				LimitRanges: []v1alpha1.LimitRangeTemplate{{
+					Name: "defaults",
+					Spec: v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{
+						Type:           v1.LimitTypeContainer,
+						DefaultRequest: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					}}},
+				}},
+			},
+			apiVersion: "v1",
+			kind:       "LimitRange",
+			names:      []string{"defaults"},
+			field:      []string{"spec", "limits"},
+			value:      []any{map[string]any{"type": "Container", "defaultRequest": map[string]any{"cpu": "100m"}}},
+		},
+		{
+			name:    "NetworkPolicies",
+			handler: NewNetworkPolicyHandler(),
+			spec: v1alpha1.NamespaceConfigSpec{
+				NetworkPolicies: []v1alpha1.NetworkPolicyTemplate{{
+					Name: "default-deny-ingress",
+					Spec: networkingv1.NetworkPolicySpec{
+						PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+					},
+				}},
+			},
+			apiVersion: "networking.k8s.io/v1",
+			kind:       "NetworkPolicy",
+			names:      []string{"default-deny-ingress"},
+			field:      []string{"spec", "policyTypes"},
+			value:      []any{"Ingress"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := tt.handler.Objects(namespace, &v1alpha1.NamespaceConfig{Spec: tt.spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objects) != len(tt.names) {
+				t.Fatalf("got %d objects, want %d", len(objects), len(tt.names))
+			}
+
+			for i, obj := range objects {
+				if obj.GetAPIVersion() != tt.apiVersion || obj.GetKind() != tt.kind || obj.GetName() != tt.names[i] {
+					t.Errorf("got %s %s %s, want %s %s %s", obj.GetAPIVersion(), obj.GetKind(), obj.GetName(), tt.apiVersion, tt.kind, tt.names[i])
+				}
+				if obj.GetNamespace() != namespace.Name {
+					t.Errorf("got namespace %q, want %q", obj.GetNamespace(), namespace.Name)
+				}
+			}
+
+			if value, _, _ := unstructured.NestedFieldNoCopy(objects[0].Object, tt.field...); !reflect.DeepEqual(value, tt.value) {
+				t.Errorf("got %v %v, want %v", tt.field, value, tt.value)
+			}
+
+			// A NamespaceConfig without templates of the kind creates none
+			if objects, _ := tt.handler.Objects(namespace, &v1alpha1.NamespaceConfig{}); len(objects) != 0 {
+				t.Errorf("got %d objects, want none", len(objects))
+			}
+		})
+	}
+}
@@ -2,33 +2,66 @@ package namespacecontroller
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
 	fc "github.com/rjbrown57/factotum/pkg/factotum"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
+	"github.com/rjbrown57/factotum/pkg/factotum/retry"
+	"github.com/rjbrown57/factotum/pkg/factotum/workers"
 )
 
 const controllerName = "namespacecontroller"
 
+// resyncPeriod is how often the informer passes every namespace to the event handler again
+const resyncPeriod = 10 * time.Minute
+
 type NamespaceController struct {
-	K8sClient        *kubernetes.Clientset
-	Watcher          watch.Interface
+	K8sClient        kubernetes.Interface
+	Informer         toolscache.SharedIndexInformer // watches the namespaces and relists them whenever the watch is closed
 	MsgChan          chan Msg
-	Wg               *sync.WaitGroup
-	NamespaceConfigs map[string]*v1alpha1.NamespaceConfig // a cache for updates triggered by the watcher
+	NamespaceConfigs map[string]*v1alpha1.NamespaceConfig // shared with the reconciler, keyed by namespaced name
 	Mu               *sync.Mutex                          //NamespaceConfig Mutex
 	Cache            *Cache
 	Handlers         []fc.Handler
+	// ObjectHandlers render the objects created in each namespace, they are applied with Dynamic
+	ObjectHandlers []ObjectHandler
+	Dynamic        dynamic.Interface
+	// Mapper finds the resource of each object kind
+	Mapper meta.RESTMapper
+	// ObjectInformers watch the quotas, limit ranges, network policies and role bindings created in the namespaces,
+	// a changed or deleted object is applied again. Objects created from resources are not watched
+	ObjectInformers []toolscache.SharedIndexInformer
+	// deleted holds the objects someone else deleted until they are created again and reported as drift
+	deleted *deletedObjects
+	// Drift collects keys set back on namespaces until the reconciler records them
+	Drift *config.DriftLog
+	// Recorder reports the result of each apply as an event on the object, it may be nil
+	Recorder record.EventRecorder
+	// Retries holds the namespaces waiting to be retried after a config failed to apply to them
+	Retries *retry.Queue
+	// Pool runs the work on each of the namespaces in parallel
+	Pool *workers.Pool
+	// Workers is the number of namespaces updated at once
+	Workers int
 }
 
-func NewNamespaceController(k8sClient *kubernetes.Clientset, SharedCache map[string]*v1alpha1.NamespaceConfig) (*NamespaceController, error) {
+// NewNamespaceController returns a NamespaceController that applies the NamespaceConfigs in SharedCache.
+// The reconciler adds and removes configs in SharedCache while holding Mu.
+func NewNamespaceController(k8sClient kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, SharedCache map[string]*v1alpha1.NamespaceConfig, recorder record.EventRecorder) (*NamespaceController, error) {
 
 	log.Info("Initializing", "Controller", controllerName)
 
@@ -36,35 +69,130 @@ func NewNamespaceController(k8sClient *kubernetes.Clientset, SharedCache map[str
 	// and an empty map of NodeLabels
 	c := &NamespaceController{
 		K8sClient:        k8sClient,
-		NamespaceConfigs: make(map[string]*v1alpha1.NamespaceConfig),
+		Dynamic:          dynamicClient,
+		Mapper:           mapper,
+		NamespaceConfigs: SharedCache,
 		MsgChan:          make(chan Msg),
-		Wg:               &sync.WaitGroup{},
 		Cache: &Cache{
 			ObjMap: make(map[string]*v1.Namespace),
 			Mu:     &sync.Mutex{},
 		},
-		Mu: &sync.Mutex{},
+		Mu:       &sync.Mutex{},
+		Drift:    config.NewDriftLog(),
+		Recorder: recorder,
+		Pool:     workers.NewPool(),
+		Workers:  workers.DefaultWorkers,
+		Retries:  retry.NewQueue(metrics.Namespace),
+		deleted:  newDeletedObjects(),
 		Handlers: []fc.Handler{
 			&fcHandlers.MetaDataHandler{},
 		},
+		ObjectHandlers: []ObjectHandler{
+			NewResourceQuotaHandler(),
+			NewLimitRangeHandler(),
+			NewNetworkPolicyHandler(),
+			&RoleBindingHandler{},
+			&ResourceHandler{},
+		},
 	}
 
-	// Set up a watch on the objs in the cluster
-	watcher, err := k8sClient.CoreV1().Namespaces().Watch(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Error(err, "Error setting watch on objs")
+	// The informer keeps the namespace cache up to date, it is started with the manager
+	c.Informer = informers.NewSharedInformerFactory(k8sClient, resyncPeriod).Core().V1().Namespaces().Informer()
+
+	if err := c.Informer.SetWatchErrorHandler(func(_ *toolscache.Reflector, err error) {
+		log.Error(err, "Namespace watch failed, relisting")
+	}); err != nil {
 		return nil, err
 	}
 
-	c.Watcher = watcher
+	// Only the objects created by factotum are watched, resources can be of any kind so they are only set back
+	// when their config is applied to the namespace again
+	managed := informers.NewSharedInformerFactoryWithOptions(k8sClient, resyncPeriod, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.LabelSelector = config.ManagedByLabel + "=" + config.ManagedBy
+	}))
+	c.ObjectInformers = []toolscache.SharedIndexInformer{
+		managed.Core().V1().ResourceQuotas().Informer(),
+		managed.Core().V1().LimitRanges().Informer(),
+		managed.Networking().V1().NetworkPolicies().Informer(),
+		managed.Rbac().V1().RoleBindings().Informer(),
+	}
 
-	// Start watching for obj events
-	debugLog.Info("Starting to Watch routine")
-	go c.Watch(watcher.ResultChan())
+	for _, informer := range c.ObjectInformers {
+		if err := informer.SetWatchErrorHandler(func(_ *toolscache.Reflector, err error) {
+			log.Error(err, "Object watch failed, relisting")
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Start runs the namespace and object informers and, once their caches have synced, the Proccessor
+// Messages sent before the cache has synced wait, so configs are never applied to a partial set of namespaces
+// It implements manager.Runnable, once ctx is done it stops the informer, the Proccessor and the workers and returns
+func (c *NamespaceController) Start(ctx context.Context) error {
+
+	if _, err := c.Informer.AddEventHandler(c.eventHandler(ctx)); err != nil {
+		log.Error(err, "Error setting watch on objs")
+		return err
+	}
+
+	synced := []toolscache.InformerSynced{c.Informer.HasSynced}
+	for _, informer := range c.ObjectInformers {
+		if _, err := informer.AddEventHandler(c.objectEventHandler(ctx)); err != nil {
+			log.Error(err, "Error setting watch on managed objects")
+			return err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	debugLog.Info("Starting namespace informer")
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		c.Informer.Run(ctx.Done())
+	}()
+
+	debugLog.Info("Starting object informers")
+	for _, informer := range c.ObjectInformers {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			informer.Run(ctx.Done())
+		}()
+	}
+
+	if !toolscache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("%s: namespace cache did not sync", controllerName)
+	}
+
+	running.Add(3)
+
+	// Work on each of the namespaces is run by the pool
+	go func() {
+		defer running.Done()
+		c.Pool.Run(ctx, c.Workers)
+	}()
 
 	// Start the NodeApplier that will apply labels to objs
 	debugLog.Info("Starting ApplyLabels routine")
-	go c.Proccessor()
+	go func() {
+		defer running.Done()
+		_ = c.Proccessor(ctx)
+	}()
 
-	return c, nil
+	// Objects a config failed to apply to are sent back to the Proccessor once their backoff has passed
+	go func() {
+		defer running.Done()
+		c.Retries.Run(ctx, c.retry)
+	}()
+
+	<-ctx.Done()
+	log.Info("Stopping", "Controller", controllerName)
+
+	return nil
 }
@@ -1,58 +1,211 @@
 package namespacecontroller
 
 import (
+	"context"
 	"reflect"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 )
 
 // Watch Nodes will keep our obj list up to date
 // On change it will notify the NamespaceController to update labels
 // MsgChan is a send only channel that will be used to notify the NamespaceController
 // ch is a receive only channel that will be used to receive events from the watch
-func (c *NamespaceController) Watch(ch <-chan watch.Event) error {
+func (c *NamespaceController) Watch(ctx context.Context, ch <-chan watch.Event) error {
 
 	for event := range ch {
-		debugLog.Info("NS Cache Watcher", "event", event.Type)
-		switch event.Type {
-		case watch.Added, watch.Modified:
-
-			obj, ok := event.Object.(*v1.Namespace)
-			if !ok {
-				log.Error(nil, "Error casting event object to NS")
-				continue
-			}
+		c.handle(ctx, event)
+	}
 
-			newNode, exists := c.Cache.Get(obj.Name)
-			if !exists {
-				// If the obj doesn't exist in the cache, add it
-				c.Cache.Set(obj.Name, obj)
-				continue
-			}
+	return nil
+}
 
-			if !Compare(obj, newNode) {
-				c.Notify(Msg{
-					Header:    "Watcher",
-					Namespace: obj,
-				})
+// eventHandler passes the events of the namespace informer to handle
+// The informer relists and rewatches whenever the watch is closed, a relist is delivered as adds, updates and deletes
+// Changes are sent to the Proccessor with ctx
+func (c *NamespaceController) eventHandler(ctx context.Context) toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			c.handle(ctx, watch.Event{Type: watch.Added, Object: obj.(runtime.Object)})
+		},
+		UpdateFunc: func(_, obj any) {
+			c.handle(ctx, watch.Event{Type: watch.Modified, Object: obj.(runtime.Object)})
+		},
+		DeleteFunc: func(obj any) {
+			// A namespace deleted while the watch was down is delivered as a tombstone
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*v1.Namespace); ok {
+				c.handle(ctx, watch.Event{Type: watch.Deleted, Object: ns})
 			}
+		},
+	}
+}
+
+// handle updates the namespace cache from a single event and notifies the NamespaceController when a namespace has changed
+func (c *NamespaceController) handle(ctx context.Context, event watch.Event) {
+	debugLog.Info("NS Cache Watcher", "event", event.Type)
+	switch event.Type {
+	case watch.Added, watch.Modified:
 
-			// we always update the cache even if the obj changed a field we don't care about
+		obj, ok := event.Object.(*v1.Namespace)
+		if !ok {
+			log.Error(nil, "Error casting event object to NS")
+			return
+		}
+
+		newNode, exists := c.Cache.Get(obj.Name)
+		if !exists {
+			// If the obj doesn't exist in the cache, add it
 			c.Cache.Set(obj.Name, obj)
+			return
+		}
 
-		case watch.Deleted:
-			obj, ok := event.Object.(*v1.Namespace)
-			if !ok {
-				log.Error(nil, "Error casting event object to Node")
-				continue
+		// we always update the cache even if the obj changed a field we don't care about
+		// The cache is updated first since the worker processing the change reads the obj from it
+		c.Cache.Set(obj.Name, obj)
+
+		if !Compare(obj, newNode) {
+			if err := c.Notify(ctx, Msg{
+				Header:    "Watcher",
+				Namespace: obj,
+				Previous:  newNode,
+			}); err != nil {
+				debugLog.Info("Controller stopped, namespace change not processed", "namespace", obj.Name)
 			}
-			// Remove the obj from the obj list
-			c.Cache.Delete(obj.Name)
 		}
+
+	case watch.Deleted:
+		obj, ok := event.Object.(*v1.Namespace)
+		if !ok {
+			log.Error(nil, "Error casting event object to Node")
+			return
+		}
+		// Remove the obj from the obj list
+		c.Cache.Delete(obj.Name)
 	}
+}
 
-	return nil
+// objectEventHandler passes the objects created by factotum that were changed or deleted to restoreObject
+// Added objects are ignored, they are either created by a config or listed when the informer starts
+func (c *NamespaceController) objectEventHandler(ctx context.Context) toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, obj any) {
+			if objectChanged(old, obj) {
+				c.restoreObject(ctx, obj, false)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			// An object deleted while the watch was down is delivered as a tombstone
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			c.restoreObject(ctx, obj, true)
+		},
+	}
+}
+
+// restoreObject notifies the NamespaceController to apply the configs of the namespace a managed object is in
+// when the config that created the object still sets it. A deleted object is reported as drift once it is created again.
+func (c *NamespaceController) restoreObject(ctx context.Context, obj any, deleted bool) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		log.Error(err, "Error reading managed object")
+		return
+	}
+
+	configName := object.GetAnnotations()[config.ManagedConfigAnnotation]
+	if configName == "" {
+		return
+	}
+
+	// The objects of a namespace being deleted are deleted with it
+	namespace, exists := c.Cache.Get(object.GetNamespace())
+	if !exists || namespace.DeletionTimestamp != nil {
+		return
+	}
+
+	// Objects the config has since stopped setting, such as ones it deleted itself, are left alone
+	key, sets := c.setsObject(namespace, configName, obj, object.GetName())
+	if !sets {
+		debugLog.Info("Managed object is no longer set by its config", "namespace", namespace.Name, "name", object.GetName(), "config", configName)
+		return
+	}
+
+	if deleted {
+		c.deleted.add(key)
+	}
+
+	debugLog.Info("Managed object changed, applying configs", "namespace", namespace.Name, "kind", key.kind, "name", key.name, "deleted", deleted, "config", configName)
+	if err := c.Notify(ctx, Msg{
+		Header:    "Object Watcher",
+		Namespace: namespace,
+	}); err != nil {
+		debugLog.Info("Controller stopped, object change not processed", "namespace", namespace.Name, "name", object.GetName())
+	}
+}
+
+// setsObject returns the key of obj and true if the named config applies to namespace and still sets obj in it
+func (c *NamespaceController) setsObject(namespace *v1.Namespace, configName string, obj any, name string) (objectKey, bool) {
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		return objectKey{}, false
+	}
+
+	// Objects from the informers have no type meta, their kind is found in the client scheme
+	gvks, _, err := scheme.Scheme.ObjectKinds(runtimeObj)
+	if err != nil || len(gvks) == 0 {
+		log.Error(err, "Error finding the kind of managed object", "namespace", namespace.Name, "name", name)
+		return objectKey{}, false
+	}
+	apiVersion, kind := gvks[0].ToAPIVersionAndKind()
+	key := objectKey{namespace.Name, apiVersion, kind, name}
+
+	c.Mu.Lock()
+	NamespaceConfig, exists := c.NamespaceConfigs[types.NamespacedName{Name: configName}.String()]
+	c.Mu.Unlock()
+
+	// Audit and ApplyOnce configs do not change namespaces when they change, see watchNamespace
+	if !exists || !NamespaceConfig.Match(namespace) || NamespaceConfig.Spec.Audits() || NamespaceConfig.Spec.AppliedOnce(namespace.Annotations, NamespaceConfig.Name) {
+		return key, false
+	}
+
+	desired, _ := c.renderObjects(namespace, NamespaceConfig)
+	for _, obj := range desired {
+		if obj.GetAPIVersion() == apiVersion && obj.GetKind() == kind && obj.GetName() == name {
+			return key, true
+		}
+	}
+
+	return key, false
+}
+
+// objectChanged returns true if obj differs from old in anything but its status and the metadata set by the api server
+func objectChanged(old, obj any) bool {
+	before, beforeErr := runtime.DefaultUnstructuredConverter.ToUnstructured(old)
+	after, afterErr := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if beforeErr != nil || afterErr != nil {
+		return true
+	}
+
+	for _, content := range []map[string]any{before, after} {
+		delete(content, "status")
+		unstructured.RemoveNestedField(content, "metadata", "resourceVersion")
+		unstructured.RemoveNestedField(content, "metadata", "managedFields")
+		unstructured.RemoveNestedField(content, "metadata", "generation")
+	}
+
+	return !reflect.DeepEqual(before, after)
 }
 
 // Compare compares two objs and returns true if they are equal based on fields we care about
@@ -0,0 +1,102 @@
+package namespacecontroller
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+func managedLimitRange() *v1.LimitRange {
+	return &v1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "defaults",
+			Namespace:       "team-a",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{config.ManagedConfigAnnotation: "team-defaults"},
+		},
+		Spec: v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{
+			Type:    v1.LimitTypeContainer,
+			Default: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+		}}},
+	}
+}
+
+func TestObjectChanged(t *testing.T) {
+	old := managedLimitRange()
+
+	// A resync or a new resource version alone is not a change
+	bumped := old.DeepCopy()
+	bumped.ResourceVersion = "2"
+	if objectChanged(old, bumped) {
+		t.Error("resource version change was reported as a change")
+	}
+
+	edited := bumped.DeepCopy()
+	edited.Spec.Limits[0].Default[v1.ResourceMemory] = resource.MustParse("1Gi")
+	if !objectChanged(old, edited) {
+		t.Error("spec change was not reported as a change")
+	}
+}
+
+func TestObjectEventHandler(t *testing.T) {
+	c := &NamespaceController{
+		MsgChan: make(chan Msg),
+		Mu:      &sync.Mutex{},
+		Cache: &Cache{
+			ObjMap: make(map[string]*v1.Namespace),
+			Mu:     &sync.Mutex{},
+		},
+		NamespaceConfigs: map[string]*v1alpha1.NamespaceConfig{
+			"/team-defaults": {
+				ObjectMeta: metav1.ObjectMeta{Name: "team-defaults"},
+				Spec: v1alpha1.NamespaceConfigSpec{
+					LimitRanges: []v1alpha1.LimitRangeTemplate{{Name: "defaults"}},
+				},
+			},
+		},
+		ObjectHandlers: []ObjectHandler{NewLimitRangeHandler()},
+		deleted:        newDeletedObjects(),
+	}
+	c.Cache.Set("team-a", &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	handler := c.objectEventHandler(context.Background())
+
+	received := make(chan Msg, 1)
+	go func() {
+		received <- <-c.MsgChan
+	}()
+
+	// A managed object deleted while the watch was down arrives as a tombstone
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "team-a/defaults", Obj: managedLimitRange()})
+	msg := <-received
+	if msg.Namespace == nil || msg.Namespace.Name != "team-a" {
+		t.Fatalf("got %+v, want a message for namespace team-a", msg)
+	}
+
+	// The delete is remembered so the object is reported once it is created again
+	if !c.deleted.take(objectKey{"team-a", "v1", "LimitRange", "defaults"}) {
+		t.Error("deleted object was not remembered")
+	}
+
+	// Objects without the config annotation, objects the config no longer sets and unchanged objects are ignored,
+	// a message would block here
+	unmanaged := managedLimitRange()
+	unmanaged.Annotations = nil
+	handler.OnDelete(unmanaged)
+
+	removed := managedLimitRange()
+	removed.Name = "removed"
+	handler.OnDelete(removed)
+	if c.deleted.take(objectKey{"team-a", "v1", "LimitRange", "removed"}) {
+		t.Error("object the config no longer sets was remembered as deleted")
+	}
+
+	handler.OnUpdate(managedLimitRange(), managedLimitRange())
+}
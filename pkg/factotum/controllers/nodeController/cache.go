@@ -1,9 +1,13 @@
 package nodecontroller
 
 import (
+	"maps"
+	"slices"
 	"sync"
 
 	v1 "k8s.io/api/core/v1"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 )
 
 type Cache struct {
@@ -23,11 +27,20 @@ func (Cache *Cache) GetNode(name string) (*v1.Node, bool) {
 	return node, true
 }
 
+// ListNodes returns the cached nodes, the nodes are replaced rather than changed so they can be read without the lock
+func (Cache *Cache) ListNodes() []*v1.Node {
+	Cache.Mu.Lock()
+	defer Cache.Mu.Unlock()
+
+	return slices.Collect(maps.Values(Cache.ObjMap))
+}
+
 func (Cache *Cache) SetNode(name string, node *v1.Node) {
 	Cache.Mu.Lock()
 	defer Cache.Mu.Unlock()
 
 	Cache.ObjMap[name] = node.DeepCopy()
+	metrics.SetCacheSize(metrics.Node, len(Cache.ObjMap))
 
 	debugLog.Info("Node Cache Set Node", "nodes", name)
 }
@@ -37,6 +50,7 @@ func (Cache *Cache) DeleteNode(name string) {
 	defer Cache.Mu.Unlock()
 
 	delete(Cache.ObjMap, name)
+	metrics.SetCacheSize(metrics.Node, len(Cache.ObjMap))
 
 	debugLog.Info("Node Cache Delete Node", "nodes", name)
 }
@@ -0,0 +1,77 @@
+package nodecontroller
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ResolveConflicts returns a copy of NodeConfig without the keys it loses to higher priority NodeConfigs that also match node.
+// Lost labels and annotations are dropped so the winning config can own them.
+// Lost taints, those with the same key and effect but a different value, are replaced with the winning taint
+// since the taint list is always applied as a whole.
+func (nc *NodeController) ResolveConflicts(node *v1.Node, NodeConfig *v1alpha1.NodeConfig) (*v1alpha1.NodeConfig, []config.Conflict) {
+	var conflicts []config.Conflict
+
+	resolved := NodeConfig.DeepCopy()
+
+	// Values are compared as they are rendered for the node, templates that render to the same value do not conflict
+	labels, annotations, _ := fcHandlers.RenderMetaData(node, resolved, resolved.Spec.Labels, resolved.Spec.Annotations)
+	labels, annotations = maps.Clone(labels), maps.Clone(annotations)
+
+	for _, other := range nc.GetMatchingNodeConfigs(node) {
+		if other.Name == NodeConfig.Name || !config.Outranks(other, NodeConfig) {
+			continue
+		}
+
+		conflict := config.Conflict{Config: other.Name}
+
+		otherLabels, otherAnnotations, _ := fcHandlers.RenderMetaData(node, other, other.Spec.Labels, other.Spec.Annotations)
+
+		lostLabels := config.DisputedKeys(labels, otherLabels)
+		for _, key := range lostLabels {
+			delete(resolved.Spec.Labels, key)
+			delete(labels, key)
+		}
+		conflict.Add(config.KindLabel, lostLabels...)
+
+		lostAnnotations := config.DisputedKeys(annotations, otherAnnotations)
+		for _, key := range lostAnnotations {
+			delete(resolved.Spec.Annotations, key)
+			delete(annotations, key)
+		}
+		conflict.Add(config.KindAnnotation, lostAnnotations...)
+
+		for i, taint := range resolved.Spec.Taints {
+			otherTaint, exists := other.FindTaint(taint)
+			if exists && otherTaint.Value != taint.Value {
+				resolved.Spec.Taints[i] = otherTaint
+				conflict.Add(config.KindTaint, fmt.Sprintf("%s:%s", taint.Key, taint.Effect))
+			}
+		}
+
+		if len(conflict.Keys) > 0 {
+			debugLog.Info("Config lost keys to higher priority config", "config", NodeConfig.Name, "node", node.Name, "winner", other.Name, "keys", conflict.Keys)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return resolved, conflicts
+}
+
+// GetConflicts returns the keys NodeConfig loses to higher priority NodeConfigs across all nodes it selects
+func (nc *NodeController) GetConflicts(NodeConfig *v1alpha1.NodeConfig) []config.Conflict {
+	var conflicts []config.Conflict
+
+	for _, node := range nc.GetMatchingNodes(NodeConfig) {
+		_, nodeConflicts := nc.ResolveConflicts(node, NodeConfig)
+		conflicts = append(conflicts, nodeConflicts...)
+	}
+
+	return config.MergeConflicts(conflicts)
+}
@@ -0,0 +1,131 @@
+package nodecontroller
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func makePriorityNodeConfig(name string, priority int32, labels map[string]string, taints []v1.Taint) *v1alpha1.NodeConfig {
+	return &v1alpha1.NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.NodeConfigSpec{
+			CommonSpec: config.CommonSpec{
+				Labels:   labels,
+				Priority: priority,
+			},
+			Taints: taints,
+		},
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	high := makePriorityNodeConfig("high", 10,
+		map[string]string{"team": "a"},
+		[]v1.Taint{{Key: "dedicated", Value: "a", Effect: v1.TaintEffectNoSchedule}})
+	low := makePriorityNodeConfig("low", 0,
+		map[string]string{"team": "b", "zone": "1"},
+		[]v1.Taint{{Key: "dedicated", Value: "b", Effect: v1.TaintEffectNoSchedule}})
+
+	nc := &NodeController{
+		NodeConfigs: map[string]*v1alpha1.NodeConfig{"high": high, "low": low},
+		NcMu:        &sync.Mutex{},
+		NodeCache: &Cache{
+			ObjMap: map[string]*v1.Node{"node1": makeNode("node1", nil)},
+			Mu:     &sync.Mutex{},
+		},
+	}
+
+	node := makeNode("node1", nil)
+
+	resolved, conflicts := nc.ResolveConflicts(node, low)
+
+	if _, exists := resolved.Spec.Labels["team"]; exists {
+		t.Errorf("expected lost label to be dropped, got %v", resolved.Spec.Labels)
+	}
+
+	if resolved.Spec.Labels["zone"] != "1" {
+		t.Errorf("expected undisputed label to be kept, got %v", resolved.Spec.Labels)
+	}
+
+	if resolved.Spec.Taints[0].Value != "a" {
+		t.Errorf("expected lost taint to be replaced with the winning taint, got %v", resolved.Spec.Taints)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Config != "high" || len(conflicts[0].Keys) != 2 {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+
+	if !slices.Contains(conflicts[0].Keys, "taint/dedicated:NoSchedule") {
+		t.Errorf("expected taint conflict to include the effect, got %v", conflicts[0].Keys)
+	}
+
+	// The original config must not be modified
+	if low.Spec.Labels["team"] != "b" {
+		t.Errorf("expected original config to be unchanged")
+	}
+
+	// The higher priority config keeps all its keys
+	if _, conflicts := nc.ResolveConflicts(node, high); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts for the winning config, got %+v", conflicts)
+	}
+
+	if conflicts := nc.GetConflicts(low); len(conflicts) != 1 {
+		t.Errorf("expected conflicts to be merged across nodes, got %+v", conflicts)
+	}
+
+	// The same key with another effect is a different taint and does not conflict
+	other := makePriorityNodeConfig("other", 0, nil,
+		[]v1.Taint{{Key: "dedicated", Value: "b", Effect: v1.TaintEffectNoExecute}})
+	if resolved, conflicts := nc.ResolveConflicts(node, other); len(conflicts) != 0 || resolved.Spec.Taints[0].Value != "b" {
+		t.Errorf("expected no conflict for a taint with another effect, got %+v", conflicts)
+	}
+}
+
+func TestResolveConflictsRendered(t *testing.T) {
+	// The templated value renders to the value the lower priority config sets, so they agree
+	templated := makePriorityNodeConfig("templated", 10, map[string]string{"team": "{{ .Labels.pool }}"}, nil)
+	templated.Spec.TemplateValues = true
+	literal := makePriorityNodeConfig("literal", 0, map[string]string{"team": "gpu"}, nil)
+
+	nc := &NodeController{
+		NodeConfigs: map[string]*v1alpha1.NodeConfig{"templated": templated, "literal": literal},
+		NcMu:        &sync.Mutex{},
+	}
+
+	if resolved, conflicts := nc.ResolveConflicts(makeNode("node1", map[string]string{"pool": "gpu"}), literal); len(conflicts) != 0 || resolved.Spec.Labels["team"] != "gpu" {
+		t.Errorf("expected no conflict for a value that renders the same, got %+v", conflicts)
+	}
+
+	if _, conflicts := nc.ResolveConflicts(makeNode("node2", map[string]string{"pool": "cpu"}), literal); len(conflicts) != 1 || conflicts[0].Keys[0] != "label/team" {
+		t.Errorf("expected the team label to conflict where it renders differently, got %+v", conflicts)
+	}
+}
+
+func TestGetMatchingNodeConfigsOrder(t *testing.T) {
+	nc := &NodeController{
+		NodeConfigs: map[string]*v1alpha1.NodeConfig{
+			"b":    makePriorityNodeConfig("b", 0, nil, nil),
+			"a":    makePriorityNodeConfig("a", 0, nil, nil),
+			"high": makePriorityNodeConfig("high", 5, nil, nil),
+		},
+		NcMu: &sync.Mutex{},
+	}
+
+	expected := []string{"high", "a", "b"}
+
+	// Map order is random so check several times
+	for range 10 {
+		configs := nc.GetMatchingNodeConfigs(makeNode("node1", nil))
+		for i, c := range configs {
+			if c.Name != expected[i] {
+				t.Fatalf("expected %s at index %d, got %s", expected[i], i, c.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package nodecontroller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DrainResults collects the drain progress of each node processed for a NodeConfig
+type DrainResults struct {
+	mu    sync.Mutex
+	nodes map[string]v1alpha1.NodeDrainStatus
+}
+
+func NewDrainResults() *DrainResults {
+	return &DrainResults{
+		nodes: make(map[string]v1alpha1.NodeDrainStatus),
+	}
+}
+
+// Record stores the drain status of a node
+// A nil DrainResults is ignored so callers that do not need results can skip creating one
+func (d *DrainResults) Record(status v1alpha1.NodeDrainStatus) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.nodes[status.Node] = status
+	d.mu.Unlock()
+}
+
+// Nodes returns the recorded drain statuses sorted by node name
+func (d *DrainResults) Nodes() []v1alpha1.NodeDrainStatus {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	nodes := make([]v1alpha1.NodeDrainStatus, 0, len(d.nodes))
+	for _, status := range d.nodes {
+		nodes = append(nodes, status)
+	}
+
+	slices.SortFunc(nodes, func(a, b v1alpha1.NodeDrainStatus) int {
+		return cmp.Compare(a.Node, b.Node)
+	})
+
+	return nodes
+}
+
+// Drain makes a single eviction pass over a cordoned node and returns its drain progress.
+// The reconciler requeues the NodeConfig while any node is still draining.
+func (nc *NodeController) Drain(ctx context.Context, node *v1.Node, NodeConfig *v1alpha1.NodeConfig) v1alpha1.NodeDrainStatus {
+	previous, exists := NodeConfig.FindDrainStatus(node.Name)
+
+	// A timed out drain is left alone until the NodeConfig changes
+	if exists && previous.Phase == v1alpha1.DrainPhaseTimedOut && previous.ObservedGeneration == NodeConfig.Generation {
+		return previous
+	}
+
+	debugLog.Info("Draining node", "node", node.Name, "config", NodeConfig.Name)
+	result, err := k8s.EvictPods(ctx, nc.K8sClient, node.Name, NodeConfig.Spec.Drain.GracePeriodSeconds)
+	if err != nil {
+		log.Error(err, "Error draining node", "node", node.Name)
+	}
+
+	return drainStatus(node.Name, NodeConfig, result, err, time.Now())
+}
+
+// drainStatus builds the drain status of a node from the result of an eviction pass
+func drainStatus(nodeName string, NodeConfig *v1alpha1.NodeConfig, result k8s.EvictionResult, err error, now time.Time) v1alpha1.NodeDrainStatus {
+	status := v1alpha1.NodeDrainStatus{
+		Node:               nodeName,
+		Phase:              v1alpha1.DrainPhaseDraining,
+		PodsRemaining:      int32(result.Remaining),
+		PodsBlocked:        int32(result.Blocked),
+		StartTime:          metav1.NewTime(now),
+		ObservedGeneration: NodeConfig.Generation,
+	}
+
+	// The start time is carried over unless a timed out drain is being retried
+	if previous, exists := NodeConfig.FindDrainStatus(nodeName); exists && previous.Phase != v1alpha1.DrainPhaseTimedOut {
+		status.StartTime = previous.StartTime
+	}
+
+	switch {
+	case err != nil:
+		status.Message = err.Error()
+	case result.Remaining == 0:
+		status.Phase = v1alpha1.DrainPhaseDrained
+		return status
+	case result.Blocked > 0:
+		status.Message = fmt.Sprintf("%d pods blocked by a PodDisruptionBudget", result.Blocked)
+	default:
+		status.Message = fmt.Sprintf("waiting for %d pods to terminate", result.Remaining)
+	}
+
+	if now.Sub(status.StartTime.Time) > NodeConfig.Spec.Drain.GetTimeout() {
+		status.Phase = v1alpha1.DrainPhaseTimedOut
+	}
+
+	return status
+}
@@ -0,0 +1,122 @@
+package nodecontroller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDrainStatus(t *testing.T) {
+	now := time.Now()
+	started := metav1.NewTime(now.Add(-time.Minute))
+	expired := metav1.NewTime(now.Add(-time.Hour))
+
+	drainingConfig := func(previous ...v1alpha1.NodeDrainStatus) *v1alpha1.NodeConfig {
+		return &v1alpha1.NodeConfig{
+			ObjectMeta: metav1.ObjectMeta{Generation: 2},
+			Spec:       v1alpha1.NodeConfigSpec{Drain: &v1alpha1.DrainSpec{}},
+			Status:     v1alpha1.NodeConfigStatus{Drain: previous},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		config        *v1alpha1.NodeConfig
+		result        k8s.EvictionResult
+		err           error
+		expectedPhase v1alpha1.DrainPhase
+		expectedStart metav1.Time
+	}{
+		{
+			name:          "New drain",
+			config:        drainingConfig(),
+			result:        k8s.EvictionResult{Remaining: 2},
+			expectedPhase: v1alpha1.DrainPhaseDraining,
+			expectedStart: metav1.NewTime(now),
+		},
+		{
+			name:          "Drained",
+			config:        drainingConfig(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseDraining, StartTime: started}),
+			result:        k8s.EvictionResult{},
+			expectedPhase: v1alpha1.DrainPhaseDrained,
+			expectedStart: started,
+		},
+		{
+			name:          "Blocked by PodDisruptionBudget",
+			config:        drainingConfig(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseDraining, StartTime: started}),
+			result:        k8s.EvictionResult{Remaining: 1, Blocked: 1},
+			expectedPhase: v1alpha1.DrainPhaseDraining,
+			expectedStart: started,
+		},
+		{
+			name:          "Timed out",
+			config:        drainingConfig(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseDraining, StartTime: expired}),
+			result:        k8s.EvictionResult{Remaining: 1, Blocked: 1},
+			expectedPhase: v1alpha1.DrainPhaseTimedOut,
+			expectedStart: expired,
+		},
+		{
+			name:          "Eviction error",
+			config:        drainingConfig(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseDraining, StartTime: started}),
+			err:           errors.New("failed to list pods"),
+			expectedPhase: v1alpha1.DrainPhaseDraining,
+			expectedStart: started,
+		},
+		{
+			name:          "Timed out drain is retried after a change",
+			config:        drainingConfig(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseTimedOut, StartTime: expired, ObservedGeneration: 1}),
+			result:        k8s.EvictionResult{Remaining: 1},
+			expectedPhase: v1alpha1.DrainPhaseDraining,
+			expectedStart: metav1.NewTime(now),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := drainStatus("node1", tt.config, tt.result, tt.err, now)
+
+			if status.Phase != tt.expectedPhase {
+				t.Errorf("expected phase %s, got %s", tt.expectedPhase, status.Phase)
+			}
+
+			if !status.StartTime.Equal(&tt.expectedStart) {
+				t.Errorf("expected start time %v, got %v", tt.expectedStart, status.StartTime)
+			}
+
+			if status.PodsRemaining != int32(tt.result.Remaining) {
+				t.Errorf("expected %d pods remaining, got %d", tt.result.Remaining, status.PodsRemaining)
+			}
+
+			if status.ObservedGeneration != tt.config.Generation {
+				t.Errorf("expected observed generation %d, got %d", tt.config.Generation, status.ObservedGeneration)
+			}
+		})
+	}
+}
+
+func TestDrainResults(t *testing.T) {
+	var nilResults *DrainResults
+	nilResults.Record(v1alpha1.NodeDrainStatus{Node: "node1"})
+	if nodes := nilResults.Nodes(); nodes != nil {
+		t.Errorf("expected nil nodes from nil results, got %v", nodes)
+	}
+
+	results := NewDrainResults()
+	results.Record(v1alpha1.NodeDrainStatus{Node: "node2", Phase: v1alpha1.DrainPhaseDraining})
+	results.Record(v1alpha1.NodeDrainStatus{Node: "node1", Phase: v1alpha1.DrainPhaseDraining})
+	results.Record(v1alpha1.NodeDrainStatus{Node: "node2", Phase: v1alpha1.DrainPhaseDrained})
+
+	nodes := results.Nodes()
+	if len(nodes) != 2 || nodes[0].Node != "node1" || nodes[1].Node != "node2" {
+		t.Fatalf("expected node1 and node2 sorted by name, got %v", nodes)
+	}
+
+	if nodes[1].Phase != v1alpha1.DrainPhaseDrained {
+		t.Errorf("expected the last recorded phase for node2, got %s", nodes[1].Phase)
+	}
+}
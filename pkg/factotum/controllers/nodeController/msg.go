@@ -1,18 +1,46 @@
 package nodecontroller
 
 import (
+	"context"
+
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	v1 "k8s.io/api/core/v1"
 )
 
 type NcMsg struct {
 	Header string
 	Node   *v1.Node
-	Config *v1alpha1.NodeConfig
+	// Previous is the cached copy of Node before the watcher event, it is used to find configs that no longer match
+	Previous *v1.Node
+	Config   *v1alpha1.NodeConfig
+	// Results collects the outcome for each matching node, it may be nil
+	Results *config.Results
+	// Retry is set when the node is sent again after Config failed to apply to it
+	Retry bool
+	// Drains collects the drain progress of each matching node when the config drains, it may be nil
+	Drains *DrainResults
+	// Rollout is set to the rollout progress when the config has a rollout strategy, it may be nil
+	Rollout *v1alpha1.RolloutStatus
+	// Ctx is the context of the sender, set by Notify. Work for the message stops when it is done
+	Ctx context.Context
+	// Done is closed once every node of the message has been processed, it may be nil
+	Done chan struct{}
 }
 
-func (nc *NodeController) Notify(msg NcMsg) {
+// Notify sends msg to the Proccessor, msg.Done is closed once it has been processed
+// It returns the context error if ctx is done before the Proccessor receives msg
+func (nc *NodeController) Notify(ctx context.Context, msg NcMsg) error {
 	debugLog.Info("Notifying NodeController", "source", msg.Header)
-	nc.Wg.Add(1)
-	nc.MsgChan <- msg
+	msg.Ctx = ctx
+	metrics.QueueDepth.WithLabelValues(metrics.Node).Inc()
+
+	select {
+	case nc.MsgChan <- msg:
+		return nil
+	case <-ctx.Done():
+		metrics.QueueDepth.WithLabelValues(metrics.Node).Dec()
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,67 @@
+package nodecontroller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/workers"
+)
+
+func TestNotifyCancelled(t *testing.T) {
+	nc := &NodeController{
+		MsgChan: make(chan NcMsg),
+	}
+
+	// Nothing receives from MsgChan, so the message is only sent if ctx is not done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := nc.Notify(ctx, NcMsg{Header: "Test"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Notify() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestProccessorClosesDone(t *testing.T) {
+	nc := &NodeController{
+		MsgChan: make(chan NcMsg),
+		NcMu:    &sync.Mutex{},
+		NodeCache: &Cache{
+			ObjMap: make(map[string]*v1.Node),
+			Mu:     &sync.Mutex{},
+		},
+		Pool: workers.NewPool(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nc.Pool.Run(ctx, 2)
+	go func() { _ = nc.Proccessor(ctx) }()
+
+	// Work for another message that never finishes does not hold up the reconciler message
+	release := make(chan struct{})
+	defer close(release)
+	nc.Pool.Submit("worker-1", func() { <-release }, func() {})
+
+	done := make(chan struct{})
+	msg := NcMsg{
+		Header: "Test",
+		Config: &v1alpha1.NodeConfig{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		Done:   done,
+	}
+	if err := nc.Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done was not closed once the message was processed")
+	}
+}
@@ -1,32 +1,195 @@
 package nodecontroller
 
 import (
-	"regexp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
 	"github.com/rjbrown57/factotum/pkg/k8s"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (nc *NodeController) Update(node *v1.Node, NodeConfig *v1alpha1.NodeConfig) error {
+// render runs the handlers against a copy of node and returns the copy, the config with any keys lost
+// to higher priority configs dropped and the handler errors
+func (nc *NodeController) render(node *v1.Node, NodeConfig *v1alpha1.NodeConfig) (*v1.Node, *v1alpha1.NodeConfig, []error) {
 
-	var err error = nil
+	var handlerErrs []error
 
 	newNode := node.DeepCopy()
 
+	// Drop any keys this config loses to a higher priority config selecting the same node
+	resolved, _ := nc.ResolveConflicts(node, NodeConfig)
+
 	for _, h := range nc.Handlers {
 		// Call the handler functions
 		traceLog.Info("Calling handler", "handler", h.GetName(), "node", node.Name, "config", NodeConfig.Name)
-		_ = h.Update(newNode, NodeConfig)
+		// A handler error does not stop the rest of the config from being applied
+		if _, handlerErr := h.Update(newNode, resolved); handlerErr != nil {
+			handlerErrs = append(handlerErrs, handlerErr)
+		}
+	}
+
+	return newNode, resolved, handlerErrs
+}
+
+// desiredTaints returns the taints of the rendered node that are set by the config
+func desiredTaints(newNode *v1.Node, resolved *v1alpha1.NodeConfig) []v1.Taint {
+	var taints []v1.Taint
+	for _, taint := range newNode.Spec.Taints {
+		if _, exists := resolved.FindTaint(taint); exists {
+			taints = append(taints, taint)
+		}
+	}
+	return taints
+}
+
+// Audit returns how node differs from NodeConfig without changing the node
+func (nc *NodeController) Audit(node *v1.Node, NodeConfig *v1alpha1.NodeConfig) ([]string, error) {
+
+	newNode, resolved, handlerErrs := nc.render(node, NodeConfig)
+
+	differences := config.Differences(config.KindLabel, node.Labels, k8s.FilterMap(newNode.Labels, resolved.GetLabelSet()))
+	differences = append(differences, config.Differences(config.KindAnnotation, node.Annotations, k8s.FilterMap(newNode.Annotations, resolved.GetAnnotationSet()))...)
+	differences = append(differences, config.Differences(config.KindTaint, TaintValues(node.Spec.Taints), TaintValues(desiredTaints(newNode, resolved)))...)
+
+	if resolved.Cordons() && !node.Spec.Unschedulable {
+		differences = append(differences, "node is schedulable, want cordoned")
+	}
+
+	return differences, errors.Join(handlerErrs...)
+}
+
+func (nc *NodeController) Update(ctx context.Context, node *v1.Node, NodeConfig *v1alpha1.NodeConfig) error {
+
+	var err error = nil
+
+	newNode, resolved, handlerErrs := nc.render(node, NodeConfig)
+
+	fieldManager := k8s.FieldManager(NodeConfig.Name)
+	policy := resolved.Spec.GetAdoptionPolicy()
+
+	// Keys are only set and removed when this config owns them, see config.ClaimKeys
+	record, others := config.ReadOwnershipRecords(node.Annotations, NodeConfig.Name)
+	appliedLabels, appliedAnnotations, appliedTaints := k8s.AppliedKeys(node, fieldManager)
+
+	desired := desiredTaints(newNode, resolved)
+
+	// The taint list is atomic, so taints applied before records were kept are the ones in the config status
+	legacyTaints := make(map[string]bool)
+	if appliedTaints {
+		for _, taint := range NodeConfig.Status.AppliedTaints {
+			legacyTaints[TaintID(taint)] = true
+		}
+	}
+
+	labels := config.ClaimKeys(config.KindLabel, node.Labels, k8s.FilterMap(newNode.Labels, resolved.GetLabelSet()), record, others, appliedLabels, policy)
+	annotations := config.ClaimKeys(config.KindAnnotation, node.Annotations, k8s.FilterMap(newNode.Annotations, resolved.GetAnnotationSet()), record, others, appliedAnnotations, policy)
+	taints := config.ClaimKeys(config.KindTaint, TaintValues(node.Spec.Taints), TaintValues(desired), record, others, legacyTaints, policy)
+	handlerErrs = append(handlerErrs, labels.Err, annotations.Err, taints.Err)
+
+	// Released keys are set back to the value they replaced before this config stops applying them
+	if len(labels.Restore) > 0 || len(annotations.Restore) > 0 {
+		start := time.Now()
+		err = k8s.Restore(ctx, nc.K8sClient, node, labels.Restore, annotations.Restore)
+		metrics.ObservePatch(metrics.Node, NodeConfig.Name, start, err)
+	}
+	if err != nil {
+		log.Error(err, "Error restoring node", "node", node.Name)
+		return nc.event(node, NodeConfig, errors.Join(append(handlerErrs, err)...))
+	}
+
+	record = config.OwnershipRecord{Labels: labels.Owned, Annotations: annotations.Owned, Taints: taints.Owned}
+	if !record.IsEmpty() {
+		annotations.Apply[config.OwnershipAnnotation(NodeConfig.Name)] = record.Encode()
+	}
+	resolved.Spec.MarkApplied(annotations.Apply, NodeConfig.Name)
+
+	// Only the fields owned by this config are applied, anything the config no longer
+	// sets is dropped by the api server since it was applied by the same field manager
+	applyNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        node.Name,
+			Labels:      labels.Apply,
+			Annotations: annotations.Apply,
+		},
+	}
+
+	// Nodes are cordoned for as long as the config cordons or drains them
+	applyNode.Spec.Unschedulable = resolved.Cordons()
+
+	takeOver := policy == config.AdoptionAdopt || config.Drifted(labels, annotations, taints)
+
+	manageTaints := resolved.ManagesTaints() || len(taints.Owned) > 0 || len(taints.Restore) > 0 || len(taints.Remove) > 0
+	if manageTaints || applyNode.Spec.Unschedulable {
+		changed, claimErr := nc.claimSpec(ctx, applyNode, desired, taints, manageTaints)
+		if claimErr != nil {
+			log.Error(claimErr, "Error reading node", "node", node.Name)
+			return nc.event(node, NodeConfig, errors.Join(append(handlerErrs, claimErr)...))
+		}
+		takeOver = takeOver || changed
 	}
 
-	_, err = k8s.StrategicMerge(nc.K8sClient, node, newNode)
+	start := time.Now()
+	_, err = k8s.Apply(ctx, nc.K8sClient, fieldManager, applyNode, takeOver)
+	metrics.ObservePatch(metrics.Node, NodeConfig.Name, start, err)
 	if err != nil {
 		log.Error(err, "Error updating node", "node", node.Name)
 	} else {
 		// Update the applied selector in the config status
 		log.Info("Updated node", "node", node.Name)
+		// Keys someone else changed have been set back, the reconciler records them in the config status
+		drifts := config.Drifts(k8s.ObjectReference(node), time.Now(), labels, annotations, taints)
+		metrics.RecordDrift(metrics.Node, NodeConfig.Name, len(drifts))
+		nc.Drift.Record(NodeConfig.Name, drifts)
+	}
+
+	// Handler errors, such as templates that failed to render, are reported with the apply result
+	return nc.event(node, NodeConfig, errors.Join(append(handlerErrs, err)...))
+}
+
+// claimSpec sets the taints of applyNode from the node as it is on the api server rather than the cache, so taints
+// added or removed since by the kubelet or the node lifecycle controller are left as they are. The node's resource
+// version is applied with them, so the apply fails and is retried if the taint list changes before it is written.
+// It returns true if the apply changes a taint or the cordon owned by the config, the only conflicts on the node spec
+// the config takes over from other field managers
+func (nc *NodeController) claimSpec(ctx context.Context, applyNode *v1.Node, desired []v1.Taint, claim config.Claim, manageTaints bool) (bool, error) {
+	current, err := k8s.GetNode(ctx, nc.K8sClient, applyNode.Name)
+	if err != nil {
+		return false, err
+	}
+
+	applyNode.ResourceVersion = current.ResourceVersion
+	changed := applyNode.Spec.Unschedulable && !current.Spec.Unschedulable
+
+	if manageTaints {
+		applyNode.Spec.Taints = ClaimTaints(current.Spec.Taints, desired, claim)
+		changed = changed || !slices.EqualFunc(applyNode.Spec.Taints, current.Spec.Taints, func(a, b v1.Taint) bool {
+			return a.MatchTaint(&b) && a.Value == b.Value
+		})
+	}
+
+	return changed, nil
+}
+
+// event reports the result of applying NodeConfig to node as an event on the node and returns err
+// Repeated identical events are aggregated by the recorder
+func (nc *NodeController) event(node *v1.Node, NodeConfig *v1alpha1.NodeConfig, err error) error {
+	if nc.Recorder == nil {
+		return err
+	}
+
+	ref := k8s.ObjectReference(node)
+	if err != nil {
+		nc.Recorder.Eventf(ref, v1.EventTypeWarning, config.EventReasonApplyFailed, "NodeConfig %s failed: %s", NodeConfig.Name, err)
+	} else {
+		nc.Recorder.Eventf(ref, v1.EventTypeNormal, config.EventReasonApplied, "Updated by NodeConfig %s", NodeConfig.Name)
 	}
 
 	return err
@@ -34,16 +197,40 @@ func (nc *NodeController) Update(node *v1.Node, NodeConfig *v1alpha1.NodeConfig)
 
 // Proccessor will apply the changes to the nodes
 // It will be called when the NodeController receives a message on the receive only MsgChan channel
-func (nc *NodeController) Proccessor() error {
+// The work on each node is run by the worker pool, nodes are updated in parallel but a single node is never
+// updated by two workers at once. The WaitGroup is done for a message once all of its nodes have been processed.
+// It returns once ctx is done
+func (nc *NodeController) Proccessor(ctx context.Context) error {
+
+	for {
+		var msg NcMsg
+		select {
+		case <-ctx.Done():
+			debugLog.Info("Stopping Proccessor")
+			return nil
+		case msg = <-nc.MsgChan:
+		}
 
-	for msg := range nc.MsgChan {
+		// tasks counts the nodes still being processed for this message
+		tasks := &sync.WaitGroup{}
+		submit := func(node string, run func()) {
+			tasks.Add(1)
+			nc.Pool.Submit(node, run, tasks.Done)
+		}
 
 		// If msg node is nil, this indicates a Config Event
 		// Process all matching nodes
 		switch {
+		// A node the config failed to apply to is retried once its backoff has passed
+		case msg.Retry:
+			submit(msg.Node.Name, func() {
+				nc.retryNode(msg.Ctx, msg.Node, msg.Config)
+			})
+
 		case msg.Node == nil:
 
-			if msg.Config.DetectChange() {
+			// Audit configs have not changed any nodes, so there is nothing to clean
+			if msg.Config.DetectChange() && !msg.Config.Spec.Audits() {
 				log.Info("Selector has changed, processing all nodes", "config", msg.Config.Spec.Selector)
 				// Make a deep copy of the config to avoid modifying the original
 				c := msg.Config.DeepCopy()
@@ -51,38 +238,129 @@ func (nc *NodeController) Proccessor() error {
 				c.Cleanup()
 
 				for _, node := range nc.GetNodeDiffSet(c.Status.AppliedSelector, c.Spec.Selector) {
-					debugLog.Info("Processing node", "node", node.Name)
-					if err := nc.Update(node, c); err != nil {
-						log.Error(err, "Error processing node", "node", node.Name)
-					}
+					submit(node.Name, func() {
+						debugLog.Info("Processing node", "node", node.Name)
+						if err := nc.Update(msg.Ctx, node, c); err != nil {
+							log.Error(err, "Error processing node", "node", node.Name)
+						}
+					})
 				}
 			}
 
-			for _, node := range nc.GetMatchingNodes(msg.Config) {
-				debugLog.Info("Processing node", "node", node.Name)
-				if err := nc.Update(node, msg.Config); err != nil {
-					log.Error(err, "Error processing node", "node", node.Name)
+			nodes := nc.GetMatchingNodes(msg.Config)
+
+			// A rollout limits the nodes updated by this pass to the current batch
+			if msg.Config.Spec.Rollout != nil {
+				var pending []*v1.Node
+				var rollout v1alpha1.RolloutStatus
+				nodes, pending, rollout = PlanRollout(msg.Config, nodes, time.Now())
+				debugLog.Info("Rolling out config", "config", msg.Config.Name, "updated", rollout.UpdatedCount, "pending", rollout.PendingCount)
+
+				for _, node := range pending {
+					msg.Results.RecordPending(node.Name)
 				}
+
+				if msg.Rollout != nil {
+					*msg.Rollout = rollout
+				}
+			}
+
+			for _, node := range nodes {
+				submit(node.Name, func() {
+					nc.processNode(msg.Ctx, node, msg)
+				})
 			}
 
 		// Update to a specific node
 		// If msg node is not nil, we apply to the specific node, This indicates the msg is from the watcher so we need to use our cache
 		case msg.Node != nil:
-			node := msg.Node
-			// If the Node Has Configs that match we will process the node
-			for _, NodeConfig := range nc.GetMatchingNodeConfigs(node) {
-				debugLog.Info("Processing node", "node", node.Name)
-				if err := nc.Update(node, NodeConfig); err != nil {
-					log.Error(err, "Error processing node", "node", node.Name)
-				}
+			// Changes made to the node while it waits for a worker are covered by the waiting task,
+			// which reads the node from the cache when it runs
+			tasks.Add(1)
+			queued := nc.Pool.SubmitCoalesced(msg.Node.Name, func() {
+				nc.watchNode(msg.Ctx, msg.Node.Name, msg.Previous)
+			}, tasks.Done)
+			if !queued {
+				debugLog.Info("Node change coalesced with a waiting change", "node", msg.Node.Name)
 			}
 		}
 
-		// Notify the WaitGroup that we are done processing
-		nc.Wg.Done()
+		// Tell the sender we are done processing once every node has been processed
+		go func() {
+			tasks.Wait()
+			if msg.Done != nil {
+				close(msg.Done)
+			}
+			metrics.QueueDepth.WithLabelValues(metrics.Node).Dec()
+		}()
+	}
+}
+
+// processNode audits or applies the config of a reconciler message to a single node and records the result
+func (nc *NodeController) processNode(ctx context.Context, node *v1.Node, msg NcMsg) {
+	if msg.Config.Spec.Audits() {
+		differences, err := nc.Audit(node, msg.Config)
+		debugLog.Info("Audited node", "node", node.Name, "differences", differences)
+		msg.Results.RecordAudit(node.Name, differences, err)
+		return
+	}
+
+	var err error
+	if msg.Config.Spec.AppliedOnce(node.Annotations, msg.Config.Name) {
+		debugLog.Info("Config has already been applied once, skipping", "node", node.Name, "config", msg.Config.Name)
+	} else {
+		debugLog.Info("Processing node", "node", node.Name)
+		if err = nc.apply(ctx, node, msg.Config); err != nil {
+			log.Error(err, "Error processing node", "node", node.Name)
+		}
+	}
+	msg.Results.Record(node.Name, err)
+
+	// Pods are only evicted once the node has been cordoned
+	if err == nil && msg.Config.Spec.Drain != nil {
+		msg.Drains.Record(nc.Drain(ctx, node, msg.Config))
+	}
+}
+
+// watchNode cleans and applies the configs of a node that was changed, previous is the node before the change
+// The node is read from the cache so the latest version is used
+func (nc *NodeController) watchNode(ctx context.Context, name string, previous *v1.Node) {
+	node, exists := nc.NodeCache.GetNode(name)
+	if !exists {
+		debugLog.Info("Node has been deleted, skipping", "node", name)
+		return
 	}
 
-	return nil
+	// Configs that matched the previous version of the node but no longer match are cleaned from the node
+	// This happens when a label or status field used by a selector changes
+	for _, NodeConfig := range nc.GetDeselectedNodeConfigs(previous, node) {
+		if NodeConfig.Spec.Audits() {
+			continue
+		}
+		debugLog.Info("Node no longer matches config, cleaning", "node", node.Name, "config", NodeConfig.Name)
+		c := NodeConfig.DeepCopy()
+		c.Cleanup()
+		if err := nc.Update(ctx, node, c); err != nil {
+			log.Error(err, "Error cleaning node", "node", node.Name)
+		}
+	}
+
+	// If the Node Has Configs that match we will process the node
+	for _, NodeConfig := range nc.GetMatchingNodeConfigs(node) {
+		if NodeConfig.RolloutPending(node.Name) {
+			debugLog.Info("Node is waiting for its rollout batch, skipping", "node", node.Name, "config", NodeConfig.Name)
+			continue
+		}
+		// Audit configs are reported by the reconciler, ApplyOnce configs only apply to nodes that newly match
+		if NodeConfig.Spec.Audits() || NodeConfig.Spec.AppliedOnce(node.Annotations, NodeConfig.Name) {
+			debugLog.Info("Config is not enforced on node, skipping", "node", node.Name, "config", NodeConfig.Name, "enforcement", NodeConfig.Spec.GetEnforcement())
+			continue
+		}
+		debugLog.Info("Processing node", "node", node.Name)
+		if err := nc.apply(ctx, node, NodeConfig); err != nil {
+			log.Error(err, "Error processing node", "node", node.Name)
+		}
+	}
 }
 
 func (nc *NodeController) GetMatchingNodeConfigs(node *v1.Node) []*v1alpha1.NodeConfig {
@@ -97,14 +375,41 @@ func (nc *NodeController) GetMatchingNodeConfigs(node *v1.Node) []*v1alpha1.Node
 	}
 
 	nc.NcMu.Unlock()
+
+	// Order by priority so configs are always applied and resolved in the same order
+	slices.SortFunc(matchingConfigs, func(a, b *v1alpha1.NodeConfig) int {
+		return config.ComparePriority(a, b)
+	})
+
 	return matchingConfigs
 }
 
+// GetDeselectedNodeConfigs returns the configs that matched the previous version of a node but do not match the current one
+func (nc *NodeController) GetDeselectedNodeConfigs(previous, node *v1.Node) []*v1alpha1.NodeConfig {
+	var deselected []*v1alpha1.NodeConfig
+
+	if previous == nil {
+		return deselected
+	}
+
+	nc.NcMu.Lock()
+
+	for _, NodeConfig := range nc.NodeConfigs {
+		if NodeConfig.Match(previous) && !NodeConfig.Match(node) {
+			deselected = append(deselected, NodeConfig)
+		}
+	}
+
+	nc.NcMu.Unlock()
+
+	return deselected
+}
+
 // GetNodeSet returns the nodes matching the selectors
 func (nc *NodeController) GetMatchingNodes(NodeConfig *v1alpha1.NodeConfig) []*v1.Node {
 	var matchingNodes []*v1.Node
 
-	for _, node := range nc.NodeCache.ObjMap {
+	for _, node := range nc.NodeCache.ListNodes() {
 		if matchNode(node, NodeConfig.Spec.Selector) {
 			matchingNodes = append(matchingNodes, node)
 		}
@@ -117,7 +422,7 @@ func (nc *NodeController) GetMatchingNodes(NodeConfig *v1alpha1.NodeConfig) []*v
 func (nc *NodeController) GetNodeDiffSet(PreviousSelector, CurrentSelector v1alpha1.NodeSelector) []*v1.Node {
 	var matchingNodes []*v1.Node
 
-	for _, node := range nc.NodeCache.ObjMap {
+	for _, node := range nc.NodeCache.ListNodes() {
 		if matchNode(node, PreviousSelector) && !matchNode(node, CurrentSelector) {
 			matchingNodes = append(matchingNodes, node)
 		}
@@ -128,29 +433,5 @@ func (nc *NodeController) GetNodeDiffSet(PreviousSelector, CurrentSelector v1alp
 
 // matchNode checks if a node matches the given selector
 func matchNode(node *v1.Node, selector v1alpha1.NodeSelector) bool {
-	if selector.NodeSelector == nil {
-		return true
-	}
-
-	for key, value := range selector.NodeSelector {
-
-		// If the label exists in the node's labels, we will check if it matches the regex
-		if nodeValue, exists := node.Labels[key]; exists {
-
-			// if the regex is fails to compile, we log the error and return false
-			r, err := regexp.Compile(value)
-			if err != nil {
-				return false
-			}
-
-			if !r.MatchString(nodeValue) {
-				return false
-			}
-
-		} else {
-			return false
-		}
-	}
-
-	return true
+	return selector.Matches(node)
 }
@@ -1,11 +1,17 @@
 package nodecontroller
 
 import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
 	"testing"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func makeNode(name string, labels map[string]string) *v1.Node {
@@ -60,6 +66,24 @@ func TestMatchNode(t *testing.T) {
 			selector: v1alpha1.NodeSelector{NodeSelector: map[string]string{"zasdf": "nope"}},
 			want:     false,
 		},
+		{
+			name: "match expressions match",
+			selector: v1alpha1.NodeSelector{MatchExpressions: []config.SelectorRequirement{
+				{Key: "foo", Operator: config.SelectorOpIn, Values: []string{"bar"}},
+				{Key: "legacy", Operator: config.SelectorOpDoesNotExist},
+			}},
+			want: true,
+		},
+		{
+			name: "map matches but expression does not",
+			selector: v1alpha1.NodeSelector{
+				NodeSelector: map[string]string{"foo": "bar"},
+				MatchExpressions: []config.SelectorRequirement{
+					{Key: "baz", Operator: config.SelectorOpNotIn, Values: []string{"qux"}},
+				},
+			},
+			want: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -71,3 +95,125 @@ func TestMatchNode(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNodeDiffSet(t *testing.T) {
+	nc := &NodeController{
+		NodeCache: &Cache{
+			ObjMap: map[string]*v1.Node{
+				"node1": makeNode("node1", map[string]string{"zone": "a"}),
+				"node2": makeNode("node2", map[string]string{"zone": "b"}),
+				"node3": makeNode("node3", map[string]string{"zone": "c"}),
+			},
+			Mu: &sync.Mutex{},
+		},
+	}
+
+	previous := v1alpha1.NodeSelector{NodeSelector: map[string]string{"zone": "a|b"}}
+	current := v1alpha1.NodeSelector{MatchExpressions: []config.SelectorRequirement{
+		{Key: "zone", Operator: config.SelectorOpNotIn, Values: []string{"a"}},
+	}}
+
+	diff := nc.GetNodeDiffSet(previous, current)
+	if len(diff) != 1 || diff[0].Name != "node1" {
+		t.Errorf("expected only node1 to be deselected, got %v", diff)
+	}
+}
+
+func TestGetDeselectedNodeConfigs(t *testing.T) {
+	ready := makeNodeConfig(nil)
+	ready.Name = "ready"
+	ready.Spec.Selector.Fields = &v1alpha1.NodeFieldSelector{
+		Conditions: []v1alpha1.NodeConditionRequirement{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+	}
+
+	all := makeNodeConfig(nil)
+	all.Name = "all"
+
+	nc := &NodeController{
+		NodeConfigs: map[string]*v1alpha1.NodeConfig{"ready": ready, "all": all},
+		NcMu:        &sync.Mutex{},
+	}
+
+	previous := makeNode("node1", nil)
+	previous.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+
+	node := previous.DeepCopy()
+	node.Status.Conditions[0].Status = v1.ConditionFalse
+
+	deselected := nc.GetDeselectedNodeConfigs(previous, node)
+	if len(deselected) != 1 || deselected[0].Name != "ready" {
+		t.Errorf("expected only the ready config to be deselected, got %v", deselected)
+	}
+
+	if deselected := nc.GetDeselectedNodeConfigs(nil, node); len(deselected) != 0 {
+		t.Errorf("expected no deselected configs without a previous node, got %v", deselected)
+	}
+}
+
+func TestClaimSpec(t *testing.T) {
+	dedicated := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	maintenance := v1.Taint{Key: "maintenance", Value: "true", Effect: v1.TaintEffectNoExecute}
+
+	// The node as it is on the api server, the not-ready taint is set by the node lifecycle controller
+	node := makeNode("node1", nil)
+	node.ResourceVersion = "2"
+	node.Spec.Taints = []v1.Taint{
+		{Key: "node.kubernetes.io/not-ready", Effect: v1.TaintEffectNoSchedule},
+		dedicated,
+	}
+
+	tests := []struct {
+		name     string
+		desired  []v1.Taint
+		claim    config.Claim
+		cordon   bool
+		expected []v1.Taint
+		changed  bool
+	}{
+		{
+			name:     "Owned taints already set",
+			desired:  []v1.Taint{dedicated},
+			claim:    config.Claim{Apply: map[string]string{"dedicated:NoSchedule": "gpu"}},
+			expected: node.Spec.Taints,
+		},
+		{
+			name:     "Owned taint added",
+			desired:  []v1.Taint{dedicated, maintenance},
+			claim:    config.Claim{Apply: map[string]string{"dedicated:NoSchedule": "gpu", "maintenance:NoExecute": "true"}},
+			expected: append(slices.Clone(node.Spec.Taints), maintenance),
+			changed:  true,
+		},
+		{
+			name:     "Node cordoned",
+			desired:  []v1.Taint{dedicated},
+			claim:    config.Claim{Apply: map[string]string{"dedicated:NoSchedule": "gpu"}},
+			cordon:   true,
+			expected: node.Spec.Taints,
+			changed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := &NodeController{K8sClient: fake.NewClientset(node.DeepCopy())}
+
+			applyNode := makeNode("node1", nil)
+			applyNode.Spec.Unschedulable = tt.cordon
+
+			changed, err := nc.claimSpec(context.Background(), applyNode, tt.desired, tt.claim, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if changed != tt.changed {
+				t.Errorf("expected changed to be %v, got %v", tt.changed, changed)
+			}
+			if !reflect.DeepEqual(applyNode.Spec.Taints, tt.expected) {
+				t.Errorf("expected taints %v, got %v", tt.expected, applyNode.Spec.Taints)
+			}
+			if applyNode.ResourceVersion != node.ResourceVersion {
+				t.Errorf("expected resource version %s, got %s", node.ResourceVersion, applyNode.ResourceVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package nodecontroller
+
+import (
+	"context"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/retry"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// apply updates node with NodeConfig and queues the node to be retried when the update fails with a retriable error
+func (nc *NodeController) apply(ctx context.Context, node *v1.Node, NodeConfig *v1alpha1.NodeConfig) error {
+	err := nc.Update(ctx, node, NodeConfig)
+	nc.Retries.Result(retry.Key{Config: NodeConfig.Name, Object: node.Name}, err)
+	return err
+}
+
+// retry sends a node NodeConfig failed to apply to back to the Proccessor with the current NodeConfig
+// Nodes and NodeConfigs that have since been deleted are dropped from the queue
+// The reconciler keys the NodeConfigs by their namespaced name
+func (nc *NodeController) retry(ctx context.Context, key retry.Key) {
+	nc.NcMu.Lock()
+	NodeConfig, exists := nc.NodeConfigs[types.NamespacedName{Name: key.Config}.String()]
+	nc.NcMu.Unlock()
+
+	node, cached := nc.NodeCache.GetNode(key.Object)
+	if !exists || !cached {
+		debugLog.Info("Node or config no longer exists, not retrying", "node", key.Object, "config", key.Config)
+		nc.Retries.Result(key, nil)
+		return
+	}
+
+	if err := nc.Notify(ctx, NcMsg{
+		Header: "Retry",
+		Node:   node,
+		Config: NodeConfig,
+		Retry:  true,
+	}); err != nil {
+		debugLog.Info("Controller stopped, not retrying", "node", key.Object, "config", key.Config)
+	}
+}
+
+// retryNode applies NodeConfig to a node that is being retried, unless the node no longer needs it
+func (nc *NodeController) retryNode(ctx context.Context, node *v1.Node, NodeConfig *v1alpha1.NodeConfig) {
+	if !NodeConfig.Match(node) || NodeConfig.RolloutPending(node.Name) || NodeConfig.Spec.Audits() || NodeConfig.Spec.AppliedOnce(node.Annotations, NodeConfig.Name) {
+		debugLog.Info("Config no longer applies to node, not retrying", "node", node.Name, "config", NodeConfig.Name)
+		nc.Retries.Result(retry.Key{Config: NodeConfig.Name, Object: node.Name}, nil)
+		return
+	}
+
+	debugLog.Info("Retrying node", "node", node.Name, "config", NodeConfig.Name)
+	if err := nc.apply(ctx, node, NodeConfig); err != nil {
+		log.Error(err, "Error retrying node", "node", node.Name)
+	}
+}
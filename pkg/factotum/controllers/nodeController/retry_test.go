@@ -0,0 +1,47 @@
+package nodecontroller
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/retry"
+)
+
+func TestRetry(t *testing.T) {
+	nc := &NodeController{
+		MsgChan: make(chan NcMsg, 1),
+		NcMu:    &sync.Mutex{},
+		NodeCache: &Cache{
+			ObjMap: make(map[string]*v1.Node),
+			Mu:     &sync.Mutex{},
+		},
+		// The reconciler keys the NodeConfigs by their namespaced name
+		NodeConfigs: map[string]*v1alpha1.NodeConfig{
+			"/team-a": {ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		},
+		Retries: retry.NewQueue("retry-test"),
+	}
+	nc.NodeCache.SetNode("worker-1", &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}})
+
+	nc.retry(context.Background(), retry.Key{Config: "team-a", Object: "worker-1"})
+
+	select {
+	case msg := <-nc.MsgChan:
+		if !msg.Retry || msg.Node.Name != "worker-1" || msg.Config.Name != "team-a" {
+			t.Errorf("got %+v, want a retry of team-a on worker-1", msg)
+		}
+	default:
+		t.Fatal("retry was not sent to the Proccessor")
+	}
+
+	// A deleted config is dropped from the queue
+	nc.retry(context.Background(), retry.Key{Config: "deleted", Object: "worker-1"})
+	if len(nc.MsgChan) != 0 {
+		t.Error("retry of a deleted config was sent to the Proccessor")
+	}
+}
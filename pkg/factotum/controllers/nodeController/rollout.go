@@ -0,0 +1,122 @@
+package nodecontroller
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// rolloutRequeueInterval is how often a rollout waiting on node readiness or drains is checked
+const rolloutRequeueInterval = 10 * time.Second
+
+// PlanRollout splits the nodes selected by NodeConfig into the nodes to apply to now and the nodes still waiting for their batch.
+// Nodes already updated by the current rollout are always applied to so they stay enforced.
+// A new batch is started once the pause has passed and, when gated, every updated node is ready and no node is still draining.
+func PlanRollout(NodeConfig *v1alpha1.NodeConfig, nodes []*v1.Node, now time.Time) ([]*v1.Node, []*v1.Node, v1alpha1.RolloutStatus) {
+	strategy := NodeConfig.Spec.Rollout
+
+	status := v1alpha1.RolloutStatus{
+		ObservedGeneration: NodeConfig.Generation,
+	}
+
+	// Progress is only carried over while the same generation is rolling out
+	var updated []string
+	if previous := NodeConfig.Status.Rollout; previous != nil && previous.ObservedGeneration == NodeConfig.Generation {
+		updated = previous.UpdatedNodes
+		status.LastBatchTime = previous.LastBatchTime
+	}
+
+	slices.SortFunc(nodes, func(a, b *v1.Node) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	var apply, pending []*v1.Node
+	for _, node := range nodes {
+		if slices.Contains(updated, node.Name) {
+			apply = append(apply, node)
+		} else {
+			pending = append(pending, node)
+		}
+	}
+
+	if len(pending) > 0 {
+		status.Message = rolloutBlocked(NodeConfig, apply, status.LastBatchTime, now)
+
+		if status.Message == "" {
+			batch := min(strategy.GetBatchSize(len(nodes)), len(pending))
+			apply = append(apply, pending[:batch]...)
+			pending = pending[batch:]
+
+			batchTime := metav1.NewTime(now)
+			status.LastBatchTime = &batchTime
+		}
+	}
+
+	// Nodes that are no longer selected are dropped from the updated list
+	for _, node := range apply {
+		status.UpdatedNodes = append(status.UpdatedNodes, node.Name)
+	}
+
+	status.UpdatedCount = int32(len(apply))
+	status.PendingCount = int32(len(pending))
+
+	status.Phase = v1alpha1.RolloutPhaseComplete
+	if len(pending) > 0 {
+		status.Phase = v1alpha1.RolloutPhaseProgressing
+	}
+
+	return apply, pending, status
+}
+
+// rolloutBlocked returns why the next batch cannot start yet, or an empty string if it can
+func rolloutBlocked(NodeConfig *v1alpha1.NodeConfig, updated []*v1.Node, lastBatch *metav1.Time, now time.Time) string {
+	strategy := NodeConfig.Spec.Rollout
+
+	if lastBatch != nil {
+		if next := lastBatch.Add(strategy.GetPause()); now.Before(next) {
+			return fmt.Sprintf("paused until %s", next.UTC().Format(time.RFC3339))
+		}
+	}
+
+	for _, node := range updated {
+		if strategy.ReadinessGate && !nodeReady(node) {
+			return fmt.Sprintf("waiting for node %s to be ready", node.Name)
+		}
+
+		if drain, exists := NodeConfig.FindDrainStatus(node.Name); exists && drain.Phase == v1alpha1.DrainPhaseDraining {
+			return fmt.Sprintf("waiting for node %s to drain", node.Name)
+		}
+	}
+
+	return ""
+}
+
+// RolloutRequeueAfter returns how long to wait before the next batch of a rollout can be started
+func RolloutRequeueAfter(NodeConfig *v1alpha1.NodeConfig, now time.Time) time.Duration {
+	rollout := NodeConfig.Status.Rollout
+	if rollout == nil || rollout.LastBatchTime == nil || NodeConfig.Spec.Rollout == nil {
+		return rolloutRequeueInterval
+	}
+
+	if wait := rollout.LastBatchTime.Add(NodeConfig.Spec.Rollout.GetPause()).Sub(now); wait > 0 {
+		return wait
+	}
+
+	return rolloutRequeueInterval
+}
+
+// nodeReady returns true if the node reports the Ready condition as True
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package nodecontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rjbrown57/factotum/api/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestPlanRollout(t *testing.T) {
+	now := time.Now()
+	recent := metav1.NewTime(now.Add(-time.Second))
+	old := metav1.NewTime(now.Add(-time.Hour))
+	two := intstr.FromInt32(2)
+
+	newNode := func(name string, ready v1.ConditionStatus) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: ready},
+			}},
+		}
+	}
+
+	nodes := func() []*v1.Node {
+		return []*v1.Node{
+			newNode("node3", v1.ConditionTrue),
+			newNode("node1", v1.ConditionFalse),
+			newNode("node2", v1.ConditionTrue),
+		}
+	}
+
+	tests := []struct {
+		name            string
+		strategy        v1alpha1.RolloutStrategy
+		previous        *v1alpha1.RolloutStatus
+		expectedApply   []string
+		expectedPending int
+		expectedPhase   v1alpha1.RolloutPhase
+		expectedWaiting bool
+	}{
+		{
+			name:            "First batch uses the default batch size",
+			strategy:        v1alpha1.RolloutStrategy{},
+			expectedApply:   []string{"node1"},
+			expectedPending: 2,
+			expectedPhase:   v1alpha1.RolloutPhaseProgressing,
+		},
+		{
+			name:            "Batch size from maxUnavailable",
+			strategy:        v1alpha1.RolloutStrategy{MaxUnavailable: &two},
+			expectedApply:   []string{"node1", "node2"},
+			expectedPending: 1,
+			expectedPhase:   v1alpha1.RolloutPhaseProgressing,
+		},
+		{
+			name:            "Next batch after the pause",
+			strategy:        v1alpha1.RolloutStrategy{MaxUnavailable: &two, Pause: &metav1.Duration{Duration: time.Minute}},
+			previous:        &v1alpha1.RolloutStatus{ObservedGeneration: 1, UpdatedNodes: []string{"node1", "node2"}, LastBatchTime: &old},
+			expectedApply:   []string{"node1", "node2", "node3"},
+			expectedPending: 0,
+			expectedPhase:   v1alpha1.RolloutPhaseComplete,
+		},
+		{
+			name:            "Paused between batches",
+			strategy:        v1alpha1.RolloutStrategy{Pause: &metav1.Duration{Duration: time.Minute}},
+			previous:        &v1alpha1.RolloutStatus{ObservedGeneration: 1, UpdatedNodes: []string{"node1"}, LastBatchTime: &recent},
+			expectedApply:   []string{"node1"},
+			expectedPending: 2,
+			expectedPhase:   v1alpha1.RolloutPhaseProgressing,
+			expectedWaiting: true,
+		},
+		{
+			name:            "Readiness gate waits for updated nodes",
+			strategy:        v1alpha1.RolloutStrategy{ReadinessGate: true},
+			previous:        &v1alpha1.RolloutStatus{ObservedGeneration: 1, UpdatedNodes: []string{"node1"}, LastBatchTime: &old},
+			expectedApply:   []string{"node1"},
+			expectedPending: 2,
+			expectedPhase:   v1alpha1.RolloutPhaseProgressing,
+			expectedWaiting: true,
+		},
+		{
+			name:            "New generation restarts the rollout",
+			strategy:        v1alpha1.RolloutStrategy{},
+			previous:        &v1alpha1.RolloutStatus{ObservedGeneration: 0, UpdatedNodes: []string{"node1", "node2", "node3"}, LastBatchTime: &recent},
+			expectedApply:   []string{"node1"},
+			expectedPending: 2,
+			expectedPhase:   v1alpha1.RolloutPhaseProgressing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			NodeConfig := &v1alpha1.NodeConfig{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       v1alpha1.NodeConfigSpec{Rollout: &tt.strategy},
+				Status:     v1alpha1.NodeConfigStatus{Rollout: tt.previous},
+			}
+
+			apply, pending, status := PlanRollout(NodeConfig, nodes(), now)
+
+			var applied []string
+			for _, node := range apply {
+				applied = append(applied, node.Name)
+			}
+
+			if len(applied) != len(tt.expectedApply) {
+				t.Fatalf("expected %v to be applied, got %v", tt.expectedApply, applied)
+			}
+			for i := range applied {
+				if applied[i] != tt.expectedApply[i] {
+					t.Errorf("expected %v to be applied, got %v", tt.expectedApply, applied)
+				}
+			}
+
+			if len(pending) != tt.expectedPending || int(status.PendingCount) != tt.expectedPending {
+				t.Errorf("expected %d pending nodes, got %d", tt.expectedPending, len(pending))
+			}
+
+			if status.Phase != tt.expectedPhase {
+				t.Errorf("expected phase %s, got %s", tt.expectedPhase, status.Phase)
+			}
+
+			if tt.expectedWaiting != (status.Message != "") {
+				t.Errorf("expected waiting %v, got message %q", tt.expectedWaiting, status.Message)
+			}
+		})
+	}
+}
+
+func TestRolloutPending(t *testing.T) {
+	NodeConfig := &v1alpha1.NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Spec:       v1alpha1.NodeConfigSpec{Rollout: &v1alpha1.RolloutStrategy{}},
+		Status: v1alpha1.NodeConfigStatus{Rollout: &v1alpha1.RolloutStatus{
+			ObservedGeneration: 2,
+			UpdatedNodes:       []string{"node1"},
+		}},
+	}
+
+	if NodeConfig.RolloutPending("node1") {
+		t.Errorf("expected updated node to not be pending")
+	}
+
+	if !NodeConfig.RolloutPending("node2") {
+		t.Errorf("expected node outside the rollout to be pending")
+	}
+
+	NodeConfig.Generation = 3
+	if !NodeConfig.RolloutPending("node1") {
+		t.Errorf("expected every node to be pending for a new generation")
+	}
+
+	NodeConfig.Spec.Rollout = nil
+	if NodeConfig.RolloutPending("node2") {
+		t.Errorf("expected no pending nodes without a rollout strategy")
+	}
+}
+
+func TestGetBatchSize(t *testing.T) {
+	percent := intstr.FromString("25%")
+	zero := intstr.FromInt32(0)
+
+	tests := []struct {
+		name     string
+		strategy v1alpha1.RolloutStrategy
+		total    int
+		expected int
+	}{
+		{name: "Default", strategy: v1alpha1.RolloutStrategy{}, total: 10, expected: 1},
+		{name: "Percent", strategy: v1alpha1.RolloutStrategy{MaxUnavailable: &percent}, total: 10, expected: 2},
+		{name: "Percent rounds up to one", strategy: v1alpha1.RolloutStrategy{MaxUnavailable: &percent}, total: 2, expected: 1},
+		{name: "Zero", strategy: v1alpha1.RolloutStrategy{MaxUnavailable: &zero}, total: 10, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.strategy.GetBatchSize(tt.total); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
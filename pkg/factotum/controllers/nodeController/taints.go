@@ -1,26 +1,33 @@
 package nodecontroller
 
 import (
-	"reflect"
+	"fmt"
 	"slices"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
 	"github.com/rjbrown57/factotum/pkg/factotum"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type TaintHandler struct{}
 
+// TaintKey identifies a taint, a node may have several taints with the same key and different effects
+type TaintKey struct {
+	Key    string
+	Effect corev1.TaintEffect
+}
+
 func (t *TaintHandler) GetName() string {
 	return "TaintHandler"
 }
 
-func (t *TaintHandler) Update(Object v1.Object, Config factotum.Config) v1.Object {
+func (t *TaintHandler) Update(Object v1.Object, Config factotum.Config) (v1.Object, error) {
 
 	node, ok := Object.(*corev1.Node)
 	if !ok {
-		return Object
+		return Object, nil
 	}
 
 	debugLog.Info("TaintHandler Update", "node", node.Name)
@@ -29,51 +36,101 @@ func (t *TaintHandler) Update(Object v1.Object, Config factotum.Config) v1.Objec
 	// so we can access the GetTaintSet method
 	NodeConfig, ok := Config.(*v1alpha1.NodeConfig)
 	if !ok {
-		return Object
+		return Object, nil
 	}
 
 	nodeTaintMap := SliceToMap(node.Spec.Taints)
 
-	// needs to be replaced with get Taint set
 	for _, taint := range NodeConfig.GetTaintSet() {
-		switch currentTaint, exists := nodeTaintMap[taint.Key]; {
+		switch currentTaint, exists := nodeTaintMap[KeyOf(taint)]; {
 		// Taint is missing in node, add it
 		case !exists:
-			debugLog.Info("TaintHandler Adding Taint to", "node", node.Name)
+			debugLog.Info("TaintHandler Adding Taint to", "node", node.Name, "taint", taint.ToString())
 			node.Spec.Taints = append(node.Spec.Taints, taint)
-		// Taint is wrong in node, update it
-		case !reflect.DeepEqual(currentTaint, taint):
-			debugLog.Info("TaintHandler Updating Taint on", "node", node.Name, "taint", taint.Key)
-			if taint.Effect == "" {
-				if index := FindTaintIndex(taint.Key, node.Spec.Taints); index != -1 {
-					node.Spec.Taints = slices.Delete(node.Spec.Taints, index, index+1)
-				}
-			} else {
-				if index := FindTaintIndex(taint.Key, node.Spec.Taints); index != -1 {
-					node.Spec.Taints[index] = taint
-				}
+		// Taint has the wrong value in node, update it
+		case currentTaint.Value != taint.Value:
+			debugLog.Info("TaintHandler Updating Taint on", "node", node.Name, "taint", taint.ToString())
+			if index := FindTaintIndex(taint, node.Spec.Taints); index != -1 {
+				node.Spec.Taints[index] = taint
 			}
+		}
+	}
 
+	// Taints the config applied before but no longer sets are removed by key and effect
+	for _, taint := range NodeConfig.GetRemovedTaints() {
+		if index := FindTaintIndex(taint, node.Spec.Taints); index != -1 {
+			debugLog.Info("TaintHandler Removing Taint from", "node", node.Name, "taint", taint.ToString())
+			node.Spec.Taints = slices.Delete(node.Spec.Taints, index, index+1)
 		}
 	}
 
-	return Object
+	return Object, nil
+}
+
+// KeyOf returns the key and effect that identify taint
+func KeyOf(taint corev1.Taint) TaintKey {
+	return TaintKey{Key: taint.Key, Effect: taint.Effect}
 }
 
-func SliceToMap(taints []corev1.Taint) map[string]corev1.Taint {
-	taintMap := make(map[string]corev1.Taint)
+func SliceToMap(taints []corev1.Taint) map[TaintKey]corev1.Taint {
+	taintMap := make(map[TaintKey]corev1.Taint)
 	for _, taint := range taints {
-		taintMap[taint.Key] = taint
+		taintMap[KeyOf(taint)] = taint
 	}
 	return taintMap
 }
 
-func FindTaintIndex(key string, taints []corev1.Taint) int {
+// FindTaintIndex returns the index of the taint with the same key and effect as taint
+func FindTaintIndex(taint corev1.Taint, taints []corev1.Taint) int {
 	for i, nodeTaint := range taints {
-		if nodeTaint.Key == key {
+		if nodeTaint.MatchTaint(&taint) {
 			return i
 		}
 	}
 	// If the taint is not found, return -1
 	return -1
 }
+
+// TaintID formats the key and effect of taint as key:effect, the form taints are recorded in ownership records
+func TaintID(taint corev1.Taint) string {
+	return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+}
+
+// TaintValues returns the value of each taint by its TaintID
+func TaintValues(taints []corev1.Taint) map[string]string {
+	values := make(map[string]string, len(taints))
+	for _, taint := range taints {
+		values[TaintID(taint)] = taint.Value
+	}
+	return values
+}
+
+// ClaimTaints builds the taint list of a node from its current taints and the taints claimed by a config.
+// Taints the config does not claim, restore or remove are kept as they are.
+func ClaimTaints(current, desired []corev1.Taint, claim config.Claim) []corev1.Taint {
+	taints := make([]corev1.Taint, 0, len(current))
+	present := make(map[string]bool)
+
+	for _, taint := range current {
+		id := TaintID(taint)
+		present[id] = true
+
+		if value, exists := claim.Apply[id]; exists {
+			taint.Value = value
+		} else if value, exists := claim.Restore[id]; exists {
+			taint.Value = value
+		} else if slices.Contains(claim.Remove, id) {
+			continue
+		}
+
+		taints = append(taints, taint)
+	}
+
+	for _, taint := range desired {
+		if _, exists := claim.Apply[TaintID(taint)]; exists && !present[TaintID(taint)] {
+			taints = append(taints, taint)
+		}
+	}
+
+	return taints
+}
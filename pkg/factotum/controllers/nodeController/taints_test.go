@@ -1,9 +1,11 @@
 package nodecontroller
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -62,11 +64,73 @@ func TestTaintHandler_Update(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Same key with another effect",
+			nodeConfig: &v1alpha1.NodeConfig{
+				Spec: v1alpha1.NodeConfigSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+					},
+				},
+			},
+			initialObject: &v1.Node{
+				Spec: v1.NodeSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+					},
+				},
+			},
+			expectedObject: &v1.Node{
+				Spec: v1.NodeSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+					},
+				},
+			},
+		},
+		{
+			name: "Remove one effect of a key",
+			nodeConfig: &v1alpha1.NodeConfig{
+				Spec: v1alpha1.NodeConfigSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+					},
+				},
+				Status: v1alpha1.NodeConfigStatus{
+					AppliedTaints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+					},
+				},
+			},
+			initialObject: &v1.Node{
+				Spec: v1.NodeSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+						{Key: "other", Value: "value", Effect: v1.TaintEffectNoSchedule},
+					},
+				},
+			},
+			expectedObject: &v1.Node{
+				Spec: v1.NodeSpec{
+					Taints: []v1.Taint{
+						{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+						{Key: "other", Value: "value", Effect: v1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := handler.Update(tt.initialObject, tt.nodeConfig)
+			result, err := handler.Update(tt.initialObject, tt.nodeConfig)
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
 			if result == nil {
 				t.Errorf("expected non-nil result")
 				return
@@ -79,6 +143,11 @@ func TestTaintHandler_Update(t *testing.T) {
 			if len(node.Spec.Taints) != len(tt.expectedObject.Spec.Taints) {
 				t.Errorf("expected %d taints, got %d", len(tt.expectedObject.Spec.Taints), len(node.Spec.Taints))
 			}
+			for _, expected := range tt.expectedObject.Spec.Taints {
+				if index := FindTaintIndex(expected, node.Spec.Taints); index == -1 || node.Spec.Taints[index].Value != expected.Value {
+					t.Errorf("expected taint %s on node, got %v", expected.ToString(), node.Spec.Taints)
+				}
+			}
 		})
 	}
 
@@ -88,50 +157,59 @@ func TestFindTaintIndex(t *testing.T) {
 	tests := []struct {
 		name      string
 		taints    []v1.Taint
-		key       string
+		taint     v1.Taint
 		expected  int
 		expectErr bool
 	}{
 		{
 			name: "Taint exists",
 			taints: []v1.Taint{
-				{Key: "key1", Value: "value1"},
-				{Key: "key2", Value: "value2"},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key2", Value: "value2", Effect: v1.TaintEffectNoSchedule},
 			},
-			key:      "key2",
+			taint:    v1.Taint{Key: "key2", Effect: v1.TaintEffectNoSchedule},
 			expected: 1,
 		},
 		{
 			name: "Taint does not exist",
 			taints: []v1.Taint{
-				{Key: "key1", Value: "value1"},
-				{Key: "key2", Value: "value2"},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key2", Value: "value2", Effect: v1.TaintEffectNoSchedule},
 			},
-			key:       "key3",
+			taint:     v1.Taint{Key: "key3", Effect: v1.TaintEffectNoSchedule},
 			expected:  -1,
 			expectErr: true,
 		},
 		{
-			name:      "Empty taints list",
-			taints:    []v1.Taint{},
-			key:       "key1",
+			name: "Key exists with another effect",
+			taints: []v1.Taint{
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+			},
+			taint:     v1.Taint{Key: "key1", Effect: v1.TaintEffectNoExecute},
 			expected:  -1,
 			expectErr: true,
 		},
 		{
-			name: "1 taints",
+			name: "Same key with several effects",
 			taints: []v1.Taint{
-				{Key: "key1", Value: "value1"},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoExecute},
 			},
-			key:       "key1",
-			expected:  0,
-			expectErr: false,
+			taint:    v1.Taint{Key: "key1", Effect: v1.TaintEffectNoExecute},
+			expected: 1,
+		},
+		{
+			name:      "Empty taints list",
+			taints:    []v1.Taint{},
+			taint:     v1.Taint{Key: "key1", Effect: v1.TaintEffectNoSchedule},
+			expected:  -1,
+			expectErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			index := FindTaintIndex(tt.key, tt.taints)
+			index := FindTaintIndex(tt.taint, tt.taints)
 			if index != tt.expected {
 				t.Errorf("expected index %d, got %d", tt.expected, index)
 			}
@@ -141,36 +219,38 @@ func TestFindTaintIndex(t *testing.T) {
 		})
 	}
 }
+
 func TestSliceToMap(t *testing.T) {
 	tests := []struct {
 		name     string
 		taints   []v1.Taint
-		expected map[string]v1.Taint
+		expected map[TaintKey]v1.Taint
 	}{
 		{
 			name: "Non-empty taints list",
 			taints: []v1.Taint{
-				{Key: "key1", Value: "value1"},
-				{Key: "key2", Value: "value2"},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key2", Value: "value2", Effect: v1.TaintEffectNoSchedule},
 			},
-			expected: map[string]v1.Taint{
-				"key1": {Key: "key1", Value: "value1"},
-				"key2": {Key: "key2", Value: "value2"},
+			expected: map[TaintKey]v1.Taint{
+				{Key: "key1", Effect: v1.TaintEffectNoSchedule}: {Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key2", Effect: v1.TaintEffectNoSchedule}: {Key: "key2", Value: "value2", Effect: v1.TaintEffectNoSchedule},
 			},
 		},
 		{
 			name:     "Empty taints list",
 			taints:   []v1.Taint{},
-			expected: map[string]v1.Taint{},
+			expected: map[TaintKey]v1.Taint{},
 		},
 		{
-			name: "Duplicate keys in taints list",
+			name: "Same key with different effects",
 			taints: []v1.Taint{
-				{Key: "key1", Value: "value1"},
-				{Key: "key1", Value: "value2"},
+				{Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key1", Value: "value2", Effect: v1.TaintEffectNoExecute},
 			},
-			expected: map[string]v1.Taint{
-				"key1": {Key: "key1", Value: "value2"},
+			expected: map[TaintKey]v1.Taint{
+				{Key: "key1", Effect: v1.TaintEffectNoSchedule}: {Key: "key1", Value: "value1", Effect: v1.TaintEffectNoSchedule},
+				{Key: "key1", Effect: v1.TaintEffectNoExecute}:  {Key: "key1", Value: "value2", Effect: v1.TaintEffectNoExecute},
 			},
 		},
 	}
@@ -183,9 +263,38 @@ func TestSliceToMap(t *testing.T) {
 			}
 			for key, expectedTaint := range tt.expected {
 				if result[key] != expectedTaint {
-					t.Errorf("for key %s, expected taint %v, got %v", key, expectedTaint, result[key])
+					t.Errorf("for key %v, expected taint %v, got %v", key, expectedTaint, result[key])
 				}
 			}
 		})
 	}
 }
+
+func TestClaimTaints(t *testing.T) {
+	current := []v1.Taint{
+		{Key: "kubelet", Value: "owned-elsewhere", Effect: v1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "old", Effect: v1.TaintEffectNoSchedule},
+		{Key: "maintenance", Value: "true", Effect: v1.TaintEffectNoExecute},
+		{Key: "adopted", Value: "ours", Effect: v1.TaintEffectNoSchedule},
+	}
+	desired := []v1.Taint{
+		{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		{Key: "new", Value: "true", Effect: v1.TaintEffectPreferNoSchedule},
+	}
+	claim := config.Claim{
+		Apply:   map[string]string{"dedicated:NoSchedule": "gpu", "new:PreferNoSchedule": "true"},
+		Restore: map[string]string{"adopted:NoSchedule": "theirs"},
+		Remove:  []string{"maintenance:NoExecute"},
+	}
+
+	expected := []v1.Taint{
+		{Key: "kubelet", Value: "owned-elsewhere", Effect: v1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		{Key: "adopted", Value: "theirs", Effect: v1.TaintEffectNoSchedule},
+		{Key: "new", Value: "true", Effect: v1.TaintEffectPreferNoSchedule},
+	}
+
+	if result := ClaimTaints(current, desired, claim); !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected taints %v, got %v", expected, result)
+	}
+}
@@ -2,33 +2,51 @@ package nodecontroller
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/rjbrown57/factotum/api/v1alpha1"
 	fc "github.com/rjbrown57/factotum/pkg/factotum"
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
 	fcHandlers "github.com/rjbrown57/factotum/pkg/factotum/handlers"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
+	"github.com/rjbrown57/factotum/pkg/factotum/retry"
+	"github.com/rjbrown57/factotum/pkg/factotum/workers"
 )
 
 const controllerName = "nodeController"
 
+// resyncPeriod is how often the informer passes every node to the event handler again
+const resyncPeriod = 10 * time.Minute
+
 type NodeController struct {
-	K8sClient   *kubernetes.Clientset
-	Watcher     watch.Interface
+	K8sClient   kubernetes.Interface
+	Informer    toolscache.SharedIndexInformer // watches the nodes and relists them whenever the watch is closed
 	MsgChan     chan NcMsg
-	Wg          *sync.WaitGroup
 	NodeConfigs map[string]*v1alpha1.NodeConfig // a cache for updates triggered by the watcher
 	NcMu        *sync.Mutex                     //NodeConfig Mutex
 	NodeCache   *Cache
 	Handlers    []fc.Handler
+	// Drift collects keys set back on nodes until the reconciler records them
+	Drift *config.DriftLog
+	// Recorder reports the result of each apply as an event on the object, it may be nil
+	Recorder record.EventRecorder
+	// Retries holds the nodes waiting to be retried after a config failed to apply to them
+	Retries *retry.Queue
+	// Pool runs the work on each of the nodes in parallel
+	Pool *workers.Pool
+	// Workers is the number of nodes updated at once
+	Workers int
 }
 
-func NewNodeController(k8sClient *kubernetes.Clientset) (*NodeController, error) {
+func NewNodeController(k8sClient kubernetes.Interface, recorder record.EventRecorder) (*NodeController, error) {
 
 	// Initialize the NodeController with a Kubernetes client
 	// and an empty map of NodeLabels
@@ -36,12 +54,16 @@ func NewNodeController(k8sClient *kubernetes.Clientset) (*NodeController, error)
 		K8sClient:   k8sClient,
 		NodeConfigs: make(map[string]*v1alpha1.NodeConfig),
 		MsgChan:     make(chan NcMsg),
-		Wg:          &sync.WaitGroup{},
 		NodeCache: &Cache{
 			ObjMap: make(map[string]*v1.Node),
 			Mu:     &sync.Mutex{},
 		},
-		NcMu: &sync.Mutex{},
+		NcMu:     &sync.Mutex{},
+		Drift:    config.NewDriftLog(),
+		Recorder: recorder,
+		Pool:     workers.NewPool(),
+		Workers:  workers.DefaultWorkers,
+		Retries:  retry.NewQueue(metrics.Node),
 		Handlers: []fc.Handler{
 			&fcHandlers.MetaDataHandler{},
 			&TaintHandler{},
@@ -50,22 +72,65 @@ func NewNodeController(k8sClient *kubernetes.Clientset) (*NodeController, error)
 
 	log.Info("Initializing", "Controller", controllerName)
 
-	// Set up a watch on the nodes in the cluster
-	watcher, err := k8sClient.CoreV1().Nodes().Watch(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Error(err, "Error setting watch on nodes")
+	// The informer keeps the node cache up to date, it is started with the manager
+	nc.Informer = informers.NewSharedInformerFactory(k8sClient, resyncPeriod).Core().V1().Nodes().Informer()
+
+	if err := nc.Informer.SetWatchErrorHandler(func(_ *toolscache.Reflector, err error) {
+		log.Error(err, "Node watch failed, relisting")
+	}); err != nil {
 		return nil, err
 	}
 
-	nc.Watcher = watcher
+	return nc, nil
+}
+
+// Start runs the node informer and, once the node cache has synced, the Proccessor
+// Messages sent before the cache has synced wait, so configs are never applied to a partial set of nodes
+// It implements manager.Runnable, once ctx is done it stops the informer, the Proccessor and the workers and returns
+func (nc *NodeController) Start(ctx context.Context) error {
+
+	if _, err := nc.Informer.AddEventHandler(nc.eventHandler(ctx)); err != nil {
+		log.Error(err, "Error setting watch on nodes")
+		return err
+	}
+
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	debugLog.Info("Starting node informer")
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		nc.Informer.Run(ctx.Done())
+	}()
+
+	if !toolscache.WaitForCacheSync(ctx.Done(), nc.Informer.HasSynced) {
+		return fmt.Errorf("%s: node cache did not sync", controllerName)
+	}
 
-	// Start watching for node events
-	debugLog.Info("Starting to WatchNodes routine")
-	go nc.Watch(watcher.ResultChan())
+	running.Add(3)
+
+	// Work on each of the nodes is run by the pool
+	go func() {
+		defer running.Done()
+		nc.Pool.Run(ctx, nc.Workers)
+	}()
 
 	// Start the NodeApplier that will apply labels to nodes
 	debugLog.Info("Starting ApplyLabels routine")
-	go nc.Proccessor()
+	go func() {
+		defer running.Done()
+		_ = nc.Proccessor(ctx)
+	}()
 
-	return nc, nil
+	// Objects a config failed to apply to are sent back to the Proccessor once their backoff has passed
+	go func() {
+		defer running.Done()
+		nc.Retries.Run(ctx, nc.retry)
+	}()
+
+	<-ctx.Done()
+	log.Info("Stopping", "Controller", controllerName)
+
+	return nil
 }
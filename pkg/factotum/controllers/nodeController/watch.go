@@ -1,58 +1,93 @@
 package nodecontroller
 
 import (
+	"context"
 	"reflect"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
 )
 
 // Watch Nodes will keep our node list up to date
 // On change it will notify the NodeController to update labels
 // MsgChan is a send only channel that will be used to notify the NodeController
 // ch is a receive only channel that will be used to receive events from the watch
-func (nc *NodeController) Watch(ch <-chan watch.Event) error {
+func (nc *NodeController) Watch(ctx context.Context, ch <-chan watch.Event) error {
 
 	for event := range ch {
-		debugLog.Info("Node Watcher", "event", event.Type)
-		switch event.Type {
-		case watch.Added, watch.Modified:
-
-			node, ok := event.Object.(*v1.Node)
-			if !ok {
-				log.Error(nil, "Error casting event object to Node")
-				continue
-			}
+		nc.handle(ctx, event)
+	}
 
-			newNode, exists := nc.NodeCache.GetNode(node.Name)
-			if !exists {
-				// If the node doesn't exist in the cache, add it
-				nc.NodeCache.SetNode(node.Name, node)
-				continue
-			}
+	return nil
+}
 
-			if !CompareNodes(node, newNode) {
-				nc.Notify(NcMsg{
-					Header: "Watcher",
-					Node:   node,
-				})
+// eventHandler passes the events of the node informer to handle
+// The informer relists and rewatches whenever the watch is closed, a relist is delivered as adds, updates and deletes
+// Changes are sent to the Proccessor with ctx
+func (nc *NodeController) eventHandler(ctx context.Context) toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			nc.handle(ctx, watch.Event{Type: watch.Added, Object: obj.(runtime.Object)})
+		},
+		UpdateFunc: func(_, obj any) {
+			nc.handle(ctx, watch.Event{Type: watch.Modified, Object: obj.(runtime.Object)})
+		},
+		DeleteFunc: func(obj any) {
+			// A node deleted while the watch was down is delivered as a tombstone
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*v1.Node); ok {
+				nc.handle(ctx, watch.Event{Type: watch.Deleted, Object: node})
 			}
+		},
+	}
+}
+
+// handle updates the node cache from a single event and notifies the NodeController when a node has changed
+func (nc *NodeController) handle(ctx context.Context, event watch.Event) {
+	debugLog.Info("Node Watcher", "event", event.Type)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+
+		node, ok := event.Object.(*v1.Node)
+		if !ok {
+			log.Error(nil, "Error casting event object to Node")
+			return
+		}
 
-			// we always update the cache even if the node changed a field we don't care about
+		newNode, exists := nc.NodeCache.GetNode(node.Name)
+		if !exists {
+			// If the node doesn't exist in the cache, add it
 			nc.NodeCache.SetNode(node.Name, node)
+			return
+		}
+
+		// we always update the cache even if the node changed a field we don't care about
+		// The cache is updated first since the worker processing the change reads the node from it
+		nc.NodeCache.SetNode(node.Name, node)
 
-		case watch.Deleted:
-			node, ok := event.Object.(*v1.Node)
-			if !ok {
-				log.Error(nil, "Error casting event object to Node")
-				continue
+		if !CompareNodes(node, newNode) {
+			if err := nc.Notify(ctx, NcMsg{
+				Header:   "Watcher",
+				Node:     node,
+				Previous: newNode,
+			}); err != nil {
+				debugLog.Info("Controller stopped, node change not processed", "node", node.Name)
 			}
-			// Remove the node from the node list
-			nc.NodeCache.DeleteNode(node.Name)
 		}
-	}
 
-	return nil
+	case watch.Deleted:
+		node, ok := event.Object.(*v1.Node)
+		if !ok {
+			log.Error(nil, "Error casting event object to Node")
+			return
+		}
+		// Remove the node from the node list
+		nc.NodeCache.DeleteNode(node.Name)
+	}
 }
 
 // CompareNodes compares two nodes and returns true if they are equal
@@ -73,5 +108,63 @@ func CompareNodes(node1, node2 *v1.Node) bool {
 		return false
 	}
 
+	// A node uncordoned by hand is cordoned again by configs that cordon it
+	if node1.Spec.Unschedulable != node2.Spec.Unschedulable {
+		traceLog.Info("Node Unschedulable differs", "node1", node1.Name, "node2", node2.Name)
+		return false
+	}
+
+	// The remaining fields can be used by NodeConfig field selectors
+	if node1.Status.NodeInfo != node2.Status.NodeInfo {
+		traceLog.Info("Node Info differs", "node1", node1.Name, "node2", node2.Name)
+		return false
+	}
+
+	if !compareConditions(node1.Status.Conditions, node2.Status.Conditions) {
+		traceLog.Info("Node Conditions differ", "node1", node1.Name, "node2", node2.Name)
+		return false
+	}
+
+	if !compareResources(node1.Status.Allocatable, node2.Status.Allocatable) {
+		traceLog.Info("Node Allocatable differs", "node1", node1.Name, "node2", node2.Name)
+		return false
+	}
+
+	return true
+}
+
+// compareConditions compares the type and status of node conditions
+// Heartbeat and transition times change constantly and are ignored
+func compareConditions(c1, c2 []v1.NodeCondition) bool {
+	if len(c1) != len(c2) {
+		return false
+	}
+
+	statuses := make(map[v1.NodeConditionType]v1.ConditionStatus, len(c1))
+	for _, condition := range c1 {
+		statuses[condition.Type] = condition.Status
+	}
+
+	for _, condition := range c2 {
+		if status, exists := statuses[condition.Type]; !exists || status != condition.Status {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareResources compares resource lists by quantity rather than by their string form
+func compareResources(r1, r2 v1.ResourceList) bool {
+	if len(r1) != len(r2) {
+		return false
+	}
+
+	for name, q1 := range r1 {
+		if q2, exists := r2[name]; !exists || q1.Cmp(q2) != 0 {
+			return false
+		}
+	}
+
 	return true
 }
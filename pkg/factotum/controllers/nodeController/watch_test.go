@@ -1,10 +1,14 @@
 package nodecontroller
 
 import (
+	"context"
+	"sync"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
 )
 
 func TestCompareNodes(t *testing.T) {
@@ -86,6 +90,62 @@ func TestCompareNodes(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name:     "Nodes have different unschedulable",
+			node1:    &v1.Node{Spec: v1.NodeSpec{Unschedulable: true}},
+			node2:    &v1.Node{},
+			expected: false,
+		},
+		{
+			name: "Nodes have different node info",
+			node1: &v1.Node{
+				Status: v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.32.0"}},
+			},
+			node2: &v1.Node{
+				Status: v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.33.0"}},
+			},
+			expected: false,
+		},
+		{
+			name: "Nodes have different condition status",
+			node1: &v1.Node{
+				Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+			},
+			node2: &v1.Node{
+				Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}},
+			},
+			expected: false,
+		},
+		{
+			name: "Node condition heartbeats are ignored",
+			node1: &v1.Node{
+				Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.Unix(1, 0)}}},
+			},
+			node2: &v1.Node{
+				Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.Unix(2, 0)}}},
+			},
+			expected: true,
+		},
+		{
+			name: "Nodes have different allocatable",
+			node1: &v1.Node{
+				Status: v1.NodeStatus{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+			},
+			node2: &v1.Node{
+				Status: v1.NodeStatus{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}},
+			},
+			expected: false,
+		},
+		{
+			name: "Allocatable in a different format is equal",
+			node1: &v1.Node{
+				Status: v1.NodeStatus{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+			},
+			node2: &v1.Node{
+				Status: v1.NodeStatus{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4000m")}},
+			},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -97,3 +157,45 @@ func TestCompareNodes(t *testing.T) {
 		})
 	}
 }
+
+func TestEventHandler(t *testing.T) {
+	nc := &NodeController{
+		MsgChan: make(chan NcMsg),
+		NodeCache: &Cache{
+			ObjMap: make(map[string]*v1.Node),
+			Mu:     &sync.Mutex{},
+		},
+	}
+	handler := nc.eventHandler(context.Background())
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Labels: map[string]string{"team": "a"}}}
+
+	// A node seen for the first time is only cached
+	handler.OnAdd(node, true)
+	if _, exists := nc.NodeCache.GetNode("worker-1"); !exists {
+		t.Fatalf("node was not added to the cache")
+	}
+
+	// A resync passes the same node again and is not a change
+	handler.OnUpdate(node, node)
+
+	changed := node.DeepCopy()
+	changed.Labels["team"] = "b"
+
+	received := make(chan NcMsg, 1)
+	go func() {
+		received <- <-nc.MsgChan
+	}()
+
+	handler.OnUpdate(node, changed)
+	msg := <-received
+	if msg.Node.Labels["team"] != "b" || msg.Previous.Labels["team"] != "a" {
+		t.Errorf("got node %v and previous %v, want the changed node and the cached node", msg.Node.Labels, msg.Previous.Labels)
+	}
+
+	// A node deleted while the watch was down arrives as a tombstone
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "worker-1", Obj: changed})
+	if _, exists := nc.NodeCache.GetNode("worker-1"); exists {
+		t.Errorf("node was not removed from the cache")
+	}
+}
@@ -5,9 +5,10 @@ import (
 )
 
 // Handers are called with an object and a FactotumConfig
-// and are expected to update the object based on the config
-// and return true if any of the metadata was updated
+// and are expected to update the object based on the config.
+// An error is returned for any part of the config that could not be applied,
+// the rest of the config is still applied to the object.
 type Handler interface {
-	Update(object v1.Object, FactotumConfig Config) v1.Object
+	Update(object v1.Object, FactotumConfig Config) (v1.Object, error)
 	GetName() string
 }
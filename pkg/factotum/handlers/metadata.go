@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/rjbrown57/factotum/pkg/k8s"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -11,12 +13,37 @@ type MetaDataHandler struct{}
 
 // MetaDataHandler will update the metadata of the object
 // based on the annotations and labels defined in the FactotumConfig
-func (m *MetaDataHandler) Update(Object v1.Object, FactotumConfig factotum.Config) v1.Object {
+// When the config templates its values they are rendered for the object, values that fail to render are left unchanged and returned in the error
+func (m *MetaDataHandler) Update(Object v1.Object, FactotumConfig factotum.Config) (v1.Object, error) {
+
+	labels, annotations, err := RenderMetaData(Object, FactotumConfig, FactotumConfig.GetLabelSet(), FactotumConfig.GetAnnotationSet())
+
+	Object.SetAnnotations(k8s.ProcessMetaDataMap(Object.GetAnnotations(), annotations))
+	Object.SetLabels(k8s.ProcessMetaDataMap(Object.GetLabels(), labels))
+
+	return Object, err
+}
+
+// RenderMetaData returns labels and annotations rendered for Object when FactotumConfig templates its values,
+// otherwise they are returned as they are. Values that fail to render are left out and returned in the error
+func RenderMetaData(Object v1.Object, FactotumConfig factotum.Config, labels, annotations map[string]string) (map[string]string, map[string]string, error) {
+	templater, ok := FactotumConfig.(factotum.Templater)
+	if !ok || !templater.TemplatesValues() {
+		return labels, annotations, nil
+	}
+
+	var captures map[string]string
+	if capturer, ok := FactotumConfig.(factotum.Capturer); ok {
+		captures = capturer.Captures(Object)
+	}
+
+	// Templates see the object as it was before any value was changed
+	data := NewTemplateData(Object, captures)
 
-	Object.SetAnnotations(k8s.ProcessMetaDataMap(Object.GetAnnotations(), FactotumConfig.GetAnnotationSet()))
-	Object.SetLabels(k8s.ProcessMetaDataMap(Object.GetLabels(), FactotumConfig.GetLabelSet()))
+	annotations, annotationErr := RenderMap("annotation", annotations, data, false)
+	labels, labelErr := RenderMap("label", labels, data, true)
 
-	return Object
+	return labels, annotations, errors.Join(annotationErr, labelErr)
 }
 
 func (m *MetaDataHandler) GetName() string {
@@ -32,7 +32,8 @@ func TestMetaDataHandler_Update(t *testing.T) {
 			},
 		}
 
-		updatedObj := handler.Update(obj, nodeConfig)
+		updatedObj, err := handler.Update(obj, nodeConfig)
+		assert.NoError(t, err)
 		assert.NotNil(t, updatedObj)
 
 		updatedAnnotations := updatedObj.(*v1.Node).GetAnnotations()
@@ -43,4 +44,53 @@ func TestMetaDataHandler_Update(t *testing.T) {
 		assert.Equal(t, "newValue1", updatedLabels["label1"])
 		assert.Equal(t, "value2", updatedLabels["label2"])
 	})
+
+	t.Run("Templated values", func(t *testing.T) {
+		obj := &v1.Node{}
+		obj.SetName("r07-node-1")
+		obj.SetLabels(map[string]string{"pool": "batch"})
+
+		nodeConfig := &v1alpha1.NodeConfig{
+			Spec: v1alpha1.NodeConfigSpec{
+				CommonSpec: config.CommonSpec{
+					TemplateValues: true,
+					Labels: map[string]string{
+						"rack":    "{{ .Captures.rack }}",
+						"pool-id": "{{ .Labels.pool }}-1",
+						"zone":    "{{ .Labels.zone }}",
+					},
+				},
+				Selector: v1alpha1.NodeSelector{
+					Fields: &v1alpha1.NodeFieldSelector{Name: "^(?P<rack>r[0-9]+)-"},
+				},
+			},
+		}
+
+		updatedObj, err := handler.Update(obj, nodeConfig)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "label zone")
+
+		updatedLabels := updatedObj.(*v1.Node).GetLabels()
+		assert.Equal(t, "r07", updatedLabels["rack"])
+		assert.Equal(t, "batch-1", updatedLabels["pool-id"])
+		assert.NotContains(t, updatedLabels, "zone")
+	})
+
+	t.Run("Values are not templates", func(t *testing.T) {
+		obj := &v1.Node{}
+		obj.SetName("r07-node-1")
+
+		nodeConfig := &v1alpha1.NodeConfig{
+			Spec: v1alpha1.NodeConfigSpec{
+				CommonSpec: config.CommonSpec{
+					Annotations: map[string]string{"note": "{{ .Name }}"},
+				},
+			},
+		}
+
+		// Without templateValues the values are set as written
+		updatedObj, err := handler.Update(obj, nodeConfig)
+		assert.NoError(t, err)
+		assert.Equal(t, "{{ .Name }}", updatedObj.(*v1.Node).GetAnnotations()["note"])
+	})
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// templateFuncs are the functions available to templated values
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// TemplateData is the data available to templated label and annotation values
+// For example {{ .Labels.pool }}, {{ .NodeInfo.Architecture }} or {{ .Captures.rack }}
+type TemplateData struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	// NodeInfo is only set when the object is a node
+	NodeInfo corev1.NodeSystemInfo
+	// Captures are the named capture groups of the config selector regexes
+	Captures map[string]string
+}
+
+// NewTemplateData builds the template data for object before any handler has changed it
+func NewTemplateData(object v1.Object, captures map[string]string) TemplateData {
+	data := TemplateData{
+		Name:        object.GetName(),
+		Labels:      maps.Clone(object.GetLabels()),
+		Annotations: maps.Clone(object.GetAnnotations()),
+		Captures:    captures,
+	}
+
+	if node, ok := object.(*corev1.Node); ok {
+		data.NodeInfo = node.Status.NodeInfo
+	}
+
+	return data
+}
+
+// Render expands value as a template, callers decide which values are templates
+// Referencing a missing label, annotation or capture is an error
+func Render(value string, data TemplateData) (string, error) {
+	tmpl, err := template.New("value").Funcs(templateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// RenderMap renders every value in values. Keys that fail to render are left out of the result and reported in the error.
+// When labels is true the rendered values must also be valid label values.
+func RenderMap(kind string, values map[string]string, data TemplateData, labels bool) (map[string]string, error) {
+	var errs []error
+
+	// Keys are rendered in order so the reported error is stable between reconciles
+	rendered := make(map[string]string, len(values))
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		result, err := Render(values[key], data)
+		if err == nil && labels {
+			if msgs := validation.IsValidLabelValue(result); len(msgs) > 0 {
+				err = fmt.Errorf("rendered value %q is not a valid label value: %s", result, strings.Join(msgs, ", "))
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render %s %s: %w", kind, key, err))
+			continue
+		}
+
+		rendered[key] = result
+	}
+
+	return rendered, errors.Join(errs...)
+}
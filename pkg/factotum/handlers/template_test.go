@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRender(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "r12-worker-3",
+			Labels: map[string]string{"pool": "gpu"},
+		},
+		Status: v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{Architecture: "arm64", OperatingSystem: "linux"}},
+	}
+
+	data := NewTemplateData(node, map[string]string{"rack": "r12"})
+
+	tests := []struct {
+		name           string
+		value          string
+		expected       string
+		expectingError bool
+	}{
+		{name: "Literal", value: "plain", expected: "plain"},
+		{name: "Label", value: "{{ .Labels.pool }}", expected: "gpu"},
+		{name: "Node info", value: "{{ .NodeInfo.Architecture }}-{{ .NodeInfo.OperatingSystem }}", expected: "arm64-linux"},
+		{name: "Capture", value: "{{ .Captures.rack }}", expected: "r12"},
+		{name: "Function", value: `{{ .Name | trimSuffix "-3" | upper }}`, expected: "R12-WORKER"},
+		{name: "Missing label", value: "{{ .Labels.zone }}", expectingError: true},
+		{name: "Invalid template", value: "{{ .Labels.pool", expectingError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.value, data)
+			if tt.expectingError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, rendered)
+		})
+	}
+}
+
+func TestRenderMap(t *testing.T) {
+	data := NewTemplateData(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, nil)
+
+	rendered, err := RenderMap("label", map[string]string{
+		"team":    "{{ .Name }}",
+		"missing": "{{ .Labels.owner }}",
+		"invalid": "{{ .Name }} with spaces",
+	}, data, true)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "label missing")
+	assert.Contains(t, err.Error(), "label invalid")
+	assert.Equal(t, map[string]string{"team": "team-a"}, rendered)
+
+	// Annotation values are not validated as label values
+	rendered, err = RenderMap("annotation", map[string]string{"note": "{{ .Name }} with spaces"}, data, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a with spaces", rendered["note"])
+}
@@ -0,0 +1,155 @@
+// Package metrics holds the factotum metrics, they are registered in the controller-runtime registry
+// and served on the manager metrics endpoint
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+// Values of the controller label, they are also used as the kind label of ObjectConfigInfo
+const (
+	Node      = "node"
+	Namespace = "namespace"
+)
+
+var (
+	// PatchTotal counts the patches sent by each controller for each config
+	PatchTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factotum_patch_total",
+		Help: "Number of patches sent to objects by controller and config",
+	}, []string{"controller", "config"})
+
+	// PatchFailures counts the patches that returned an error
+	PatchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factotum_patch_failures_total",
+		Help: "Number of patches that failed by controller and config",
+	}, []string{"controller", "config"})
+
+	// PatchDuration is how long each patch took
+	PatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factotum_patch_duration_seconds",
+		Help:    "Time taken to patch an object by controller",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"controller"})
+
+	// MatchedObjects is the number of objects selected by each config
+	MatchedObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factotum_matched_objects",
+		Help: "Number of objects selected by a config",
+	}, []string{"controller", "config"})
+
+	// DriftCorrections counts the keys set back on objects after they were changed
+	DriftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factotum_drift_corrections_total",
+		Help: "Number of keys set back on objects after they were changed by controller and config",
+	}, []string{"controller", "config"})
+
+	// QueueDepth is the number of messages sent to a controller that it has not finished processing
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factotum_queue_depth",
+		Help: "Number of messages waiting to be processed by a controller",
+	}, []string{"controller"})
+
+	// WaitDuration is how long reconcilers are blocked waiting for a controller to finish processing
+	WaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factotum_wait_duration_seconds",
+		Help:    "Time reconcilers spent waiting for a controller to finish processing",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"controller"})
+
+	// CacheObjects is the number of objects in the cache of each controller
+	CacheObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factotum_cache_objects",
+		Help: "Number of objects in the cache of a controller",
+	}, []string{"controller"})
+
+	// RetryBacklog is the number of objects waiting to be retried after a failed patch
+	RetryBacklog = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factotum_retry_backlog",
+		Help: "Number of objects waiting to be retried after a failed patch",
+	}, []string{"controller"})
+
+	// RetriesExhausted counts the objects that still failed after every retry
+	RetriesExhausted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factotum_retries_exhausted_total",
+		Help: "Number of objects a config still failed to apply to after every retry by controller and config",
+	}, []string{"controller", "config"})
+
+	// ObjectConfigInfo is 1 for every object a config has been applied to, it is used to join objects to configs
+	ObjectConfigInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factotum_object_config_info",
+		Help: "Objects managed by a config, always 1",
+	}, []string{"kind", "object", "config"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		PatchTotal,
+		PatchFailures,
+		PatchDuration,
+		MatchedObjects,
+		DriftCorrections,
+		QueueDepth,
+		WaitDuration,
+		CacheObjects,
+		RetryBacklog,
+		RetriesExhausted,
+		ObjectConfigInfo,
+	)
+}
+
+// ObservePatch records a patch sent by controller for configName that started at start and returned err
+func ObservePatch(controller, configName string, start time.Time, err error) {
+	PatchTotal.WithLabelValues(controller, configName).Inc()
+	PatchDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+	if err != nil {
+		PatchFailures.WithLabelValues(controller, configName).Inc()
+	}
+}
+
+// ObserveWait records the time a reconciler waited for controller since start
+func ObserveWait(controller string, start time.Time) {
+	WaitDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+}
+
+// RecordDrift counts keys set back by controller for configName
+func RecordDrift(controller, configName string, count int) {
+	if count == 0 {
+		return
+	}
+	DriftCorrections.WithLabelValues(controller, configName).Add(float64(count))
+}
+
+// SetCacheSize records the number of objects in the cache of controller
+func SetCacheSize(controller string, size int) {
+	CacheObjects.WithLabelValues(controller).Set(float64(size))
+}
+
+// SetObjects records the objects selected by configName and which of them the config has been applied to
+// Objects that are no longer applied to are dropped from ObjectConfigInfo
+func SetObjects(controller, configName string, objects []config.ObjectStatus) {
+	MatchedObjects.WithLabelValues(controller, configName).Set(float64(len(objects)))
+
+	ObjectConfigInfo.DeletePartialMatch(prometheus.Labels{"kind": controller, "config": configName})
+	for _, object := range objects {
+		if object.Result == config.ResultApplied {
+			ObjectConfigInfo.WithLabelValues(controller, object.Name, configName).Set(1)
+		}
+	}
+}
+
+// Forget drops the series of a deleted config
+func Forget(controller, configName string) {
+	labels := prometheus.Labels{"controller": controller, "config": configName}
+	PatchTotal.DeletePartialMatch(labels)
+	PatchFailures.DeletePartialMatch(labels)
+	MatchedObjects.DeletePartialMatch(labels)
+	DriftCorrections.DeletePartialMatch(labels)
+	RetriesExhausted.DeletePartialMatch(labels)
+	ObjectConfigInfo.DeletePartialMatch(prometheus.Labels{"kind": controller, "config": configName})
+}
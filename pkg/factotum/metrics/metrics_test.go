@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+func TestObservePatch(t *testing.T) {
+	ObservePatch(Node, "patch-test", time.Now(), nil)
+	ObservePatch(Node, "patch-test", time.Now(), errors.New("conflict"))
+
+	if got := testutil.ToFloat64(PatchTotal.WithLabelValues(Node, "patch-test")); got != 2 {
+		t.Errorf("patch total is %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(PatchFailures.WithLabelValues(Node, "patch-test")); got != 1 {
+		t.Errorf("patch failures is %v, want 1", got)
+	}
+}
+
+func TestSetObjects(t *testing.T) {
+	SetObjects(Namespace, "objects-test", []config.ObjectStatus{
+		{Name: "a", Result: config.ResultApplied},
+		{Name: "b", Result: config.ResultApplied},
+		{Name: "c", Result: config.ResultFailed},
+	})
+
+	if got := testutil.ToFloat64(MatchedObjects.WithLabelValues(Namespace, "objects-test")); got != 3 {
+		t.Errorf("matched objects is %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(ObjectConfigInfo); got != 2 {
+		t.Errorf("info series count is %d, want 2", got)
+	}
+
+	// b is no longer applied to, so its series is dropped
+	SetObjects(Namespace, "objects-test", []config.ObjectStatus{
+		{Name: "a", Result: config.ResultApplied},
+	})
+	if got := testutil.CollectAndCount(ObjectConfigInfo); got != 1 {
+		t.Errorf("info series count is %d, want 1", got)
+	}
+
+	Forget(Namespace, "objects-test")
+	if got := testutil.CollectAndCount(ObjectConfigInfo); got != 0 {
+		t.Errorf("info series count after forget is %d, want 0", got)
+	}
+	if got := testutil.CollectAndCount(MatchedObjects); got != 0 {
+		t.Errorf("matched series count after forget is %d, want 0", got)
+	}
+}
+
+func TestRecordDrift(t *testing.T) {
+	RecordDrift(Node, "drift-test", 0)
+	if got := testutil.CollectAndCount(DriftCorrections); got != 0 {
+		t.Errorf("drift series count is %d, want 0", got)
+	}
+
+	RecordDrift(Node, "drift-test", 3)
+	if got := testutil.ToFloat64(DriftCorrections.WithLabelValues(Node, "drift-test")); got != 3 {
+		t.Errorf("drift corrections is %v, want 3", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Package retry retries objects a config failed to apply to with exponential backoff
+package retry
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+	"github.com/rjbrown57/factotum/pkg/factotum/metrics"
+	"github.com/rjbrown57/factotum/pkg/k8s"
+)
+
+const (
+	// baseDelay is the wait before the first retry, it doubles with every failed attempt
+	baseDelay = time.Second
+	// maxDelay is the longest wait between retries
+	maxDelay = 5 * time.Minute
+	// MaxAttempts is the number of times a config is applied to an object before the retries are exhausted
+	MaxAttempts = 7
+)
+
+// Key identifies an object a config failed to apply to
+type Key struct {
+	Config string
+	Object string
+}
+
+// Queue holds the objects waiting to be retried by a controller
+// Retries are exhausted after MaxAttempts, the object is then reported until the config is applied to it
+type Queue struct {
+	controller string
+	queue      workqueue.TypedRateLimitingInterface[Key]
+
+	mu        sync.Mutex
+	pending   map[Key]bool
+	exhausted map[string]map[string]config.ExhaustedRetry
+	notify    func(configName string)
+}
+
+// NewQueue returns a Queue for controller, the name is used as the controller label of the retry metrics
+func NewQueue(controller string) *Queue {
+	return &Queue{
+		controller: controller,
+		queue: workqueue.NewTypedRateLimitingQueue(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[Key](baseDelay, maxDelay),
+		),
+		pending:   make(map[Key]bool),
+		exhausted: make(map[string]map[string]config.ExhaustedRetry),
+	}
+}
+
+// OnExhausted sets the function called with the name of a config whenever its retries for an object are exhausted
+func (q *Queue) OnExhausted(notify func(configName string)) {
+	q.mu.Lock()
+	q.notify = notify
+	q.mu.Unlock()
+}
+
+// Result records the result of applying a config to an object
+// A retriable error queues the object again after a backoff, a success forgets its failures
+// A nil Queue is ignored
+func (q *Queue) Result(key Key, err error) {
+	if q == nil {
+		return
+	}
+
+	if err == nil {
+		q.forget(key)
+		return
+	}
+
+	if !k8s.Retriable(err) {
+		return
+	}
+
+	q.mu.Lock()
+
+	// The object is reported until the config is applied to it, it is not retried again on every reconcile
+	if _, exhausted := q.exhausted[key.Config][key.Object]; exhausted {
+		q.mu.Unlock()
+		return
+	}
+
+	// The first attempt is not a requeue, so the attempts so far are one more than the requeues
+	attempts := q.queue.NumRequeues(key) + 1
+	if attempts < MaxAttempts {
+		q.pending[key] = true
+		q.setBacklog()
+		q.mu.Unlock()
+
+		q.queue.AddRateLimited(key)
+		return
+	}
+
+	if q.exhausted[key.Config] == nil {
+		q.exhausted[key.Config] = make(map[string]config.ExhaustedRetry)
+	}
+	q.exhausted[key.Config][key.Object] = config.ExhaustedRetry{
+		Object:    key.Object,
+		Attempts:  int32(attempts),
+		LastError: err.Error(),
+		Time:      metav1.Now(),
+	}
+	delete(q.pending, key)
+	q.setBacklog()
+	notify := q.notify
+	q.mu.Unlock()
+
+	q.queue.Forget(key)
+	metrics.RetriesExhausted.WithLabelValues(q.controller, key.Config).Inc()
+
+	if notify != nil {
+		notify(key.Config)
+	}
+}
+
+// forget drops the failures of key once the config has been applied to the object
+func (q *Queue) forget(key Key) {
+	q.queue.Forget(key)
+
+	q.mu.Lock()
+	delete(q.pending, key)
+	delete(q.exhausted[key.Config], key.Object)
+	if len(q.exhausted[key.Config]) == 0 {
+		delete(q.exhausted, key.Config)
+	}
+	q.setBacklog()
+	q.mu.Unlock()
+}
+
+// ForgetConfig drops the exhausted retries of a deleted config, objects still queued are dropped when retried
+func (q *Queue) ForgetConfig(configName string) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	delete(q.exhausted, configName)
+	q.mu.Unlock()
+}
+
+// Exhausted returns the objects whose retries for the named config are exhausted, sorted by object name
+func (q *Queue) Exhausted(configName string) []config.ExhaustedRetry {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var exhausted []config.ExhaustedRetry
+	for _, retry := range q.exhausted[configName] {
+		exhausted = append(exhausted, retry)
+	}
+
+	slices.SortFunc(exhausted, func(a, b config.ExhaustedRetry) int {
+		return cmp.Compare(a.Object, b.Object)
+	})
+
+	return exhausted
+}
+
+// Run calls retry with each object once its backoff has passed, until ctx is done
+// retry is expected to apply the config again and pass the outcome to Result
+func (q *Queue) Run(ctx context.Context, retry func(context.Context, Key)) {
+	go func() {
+		<-ctx.Done()
+		q.queue.ShutDown()
+	}()
+
+	for {
+		key, shutdown := q.queue.Get()
+		if shutdown {
+			return
+		}
+
+		q.mu.Lock()
+		delete(q.pending, key)
+		q.setBacklog()
+		q.mu.Unlock()
+
+		retry(ctx, key)
+		q.queue.Done(key)
+	}
+}
+
+// setBacklog updates the backlog metric, q.mu must be held
+func (q *Queue) setBacklog() {
+	metrics.RetryBacklog.WithLabelValues(q.controller).Set(float64(len(q.pending)))
+}
@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestQueueResult(t *testing.T) {
+	q := NewQueue("test")
+	key := Key{Config: "config", Object: "worker-1"}
+	throttled := apierrors.NewTooManyRequests("slow down", 1)
+
+	var notified []string
+	q.OnExhausted(func(configName string) {
+		notified = append(notified, configName)
+	})
+
+	// Errors that will not succeed when sent again are not retried
+	q.Result(key, errors.New("template failed"))
+	if got := q.queue.NumRequeues(key); got != 0 {
+		t.Fatalf("non retriable error was queued %d times", got)
+	}
+
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		q.Result(key, throttled)
+		if got := q.queue.NumRequeues(key); got != attempt {
+			t.Fatalf("attempt %d: got %d requeues, want %d", attempt, got, attempt)
+		}
+	}
+
+	if len(q.Exhausted(key.Config)) != 0 {
+		t.Fatalf("retries exhausted before the last attempt")
+	}
+
+	q.Result(key, throttled)
+
+	exhausted := q.Exhausted(key.Config)
+	if len(exhausted) != 1 || exhausted[0].Object != key.Object || exhausted[0].Attempts != MaxAttempts {
+		t.Fatalf("got exhausted %+v, want %s after %d attempts", exhausted, key.Object, MaxAttempts)
+	}
+	if len(notified) != 1 || notified[0] != key.Config {
+		t.Errorf("got notifications %v, want [%s]", notified, key.Config)
+	}
+
+	// An exhausted object is not queued again by the next failure
+	q.Result(key, throttled)
+	if got := q.queue.NumRequeues(key); got != 0 {
+		t.Errorf("exhausted object was queued %d times", got)
+	}
+
+	// The object is reported until the config is applied to it
+	q.Result(key, nil)
+	if exhausted := q.Exhausted(key.Config); len(exhausted) != 0 {
+		t.Errorf("got exhausted %+v after a success, want none", exhausted)
+	}
+}
+
+func TestQueueForgetConfig(t *testing.T) {
+	q := NewQueue("test")
+	key := Key{Config: "config", Object: "worker-1"}
+
+	for range MaxAttempts {
+		q.Result(key, apierrors.NewServiceUnavailable("unavailable"))
+	}
+
+	q.ForgetConfig(key.Config)
+	if exhausted := q.Exhausted(key.Config); len(exhausted) != 0 {
+		t.Errorf("got exhausted %+v after the config was forgotten, want none", exhausted)
+	}
+}
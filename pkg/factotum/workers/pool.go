@@ -0,0 +1,156 @@
+// Package workers runs the per object work of the controllers in parallel
+package workers
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// DefaultWorkers is the number of objects a controller works on at once when no worker count is set
+const DefaultWorkers = 1
+
+type task struct {
+	run func()
+	// done is called once run has returned, or instead of run when the task is dropped
+	done func()
+	// coalesce marks a task that any later coalescing task for the same key can be folded into
+	coalesce bool
+}
+
+// Pool runs tasks on a fixed number of workers
+// Tasks with the same key, the name of the object they work on, run one at a time in the order they were submitted
+type Pool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []string          // keys with a waiting task and no running task, oldest first
+	waiting map[string][]task // tasks waiting to run for each key
+	running map[string]bool
+	stopped bool
+}
+
+func NewPool() *Pool {
+	p := &Pool{
+		waiting: make(map[string][]task),
+		running: make(map[string]bool),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Submit queues run for the object named key
+// done is always called once, after run has returned or when the pool stops before run is started
+func (p *Pool) Submit(key string, run, done func()) {
+	p.mu.Lock()
+	queued := p.add(key, task{run: run, done: done})
+	p.mu.Unlock()
+
+	if !queued {
+		done()
+	}
+}
+
+// SubmitCoalesced queues run for the object named key unless a coalesced task for key is already waiting to run.
+// It is used for work that reads the latest state of the object when it runs, so one run covers every change
+// made while it was waiting. It returns false when run was folded into the waiting task, done is then called straight away.
+func (p *Pool) SubmitCoalesced(key string, run, done func()) bool {
+	p.mu.Lock()
+
+	coalesced := slices.ContainsFunc(p.waiting[key], func(waiting task) bool { return waiting.coalesce })
+	queued := !coalesced && p.add(key, task{run: run, done: done, coalesce: true})
+	p.mu.Unlock()
+
+	if !queued {
+		done()
+	}
+	return !coalesced
+}
+
+// add queues t for key and returns false if the pool has stopped, p.mu must be held
+func (p *Pool) add(key string, t task) bool {
+	if p.stopped {
+		return false
+	}
+
+	p.waiting[key] = append(p.waiting[key], t)
+
+	// A key that is running is made ready again when its running task finishes
+	if len(p.waiting[key]) == 1 && !p.running[key] {
+		p.ready = append(p.ready, key)
+		p.cond.Signal()
+	}
+	return true
+}
+
+// Run starts count workers and returns once ctx is done and every worker has stopped
+// Tasks still waiting when ctx is done are not run, they are dropped and their done is called
+func (p *Pool) Run(ctx context.Context, count int) {
+	if count < 1 {
+		count = DefaultWorkers
+	}
+
+	var wg sync.WaitGroup
+	for range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work()
+		}()
+	}
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	wg.Wait()
+
+	p.mu.Lock()
+	dropped := p.waiting
+	p.waiting = make(map[string][]task)
+	p.ready = nil
+	p.mu.Unlock()
+
+	for _, waiting := range dropped {
+		for _, t := range waiting {
+			t.done()
+		}
+	}
+}
+
+// work runs ready tasks until the pool is stopped
+func (p *Pool) work() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for len(p.ready) == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			return
+		}
+
+		key := p.ready[0]
+		p.ready = p.ready[1:]
+
+		t := p.waiting[key][0]
+		p.waiting[key] = p.waiting[key][1:]
+		p.running[key] = true
+
+		p.mu.Unlock()
+		t.run()
+		t.done()
+		p.mu.Lock()
+
+		delete(p.running, key)
+		if len(p.waiting[key]) > 0 {
+			p.ready = append(p.ready, key)
+			p.cond.Signal()
+		} else {
+			delete(p.waiting, key)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolSerializesKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewPool()
+	go p.Run(ctx, 4)
+
+	var wg sync.WaitGroup
+	var running, maxRunning atomic.Int32
+	var mu sync.Mutex
+	var order []int
+
+	// Tasks for the same key never overlap and run in the order they were submitted
+	for i := range 10 {
+		wg.Add(1)
+		p.Submit("worker-1", func() {
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			running.Add(-1)
+		}, wg.Done)
+	}
+
+	wg.Wait()
+
+	if maxRunning.Load() != 1 {
+		t.Errorf("got %d tasks for the same key running at once, want 1", maxRunning.Load())
+	}
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("got order %v, want tasks in submission order", order)
+		}
+	}
+}
+
+func TestPoolRunsKeysInParallel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewPool()
+	go p.Run(ctx, 2)
+
+	// Both tasks must be running at once for either to finish
+	var wg sync.WaitGroup
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	for _, key := range []string{"worker-1", "worker-2"} {
+		wg.Add(1)
+		p.Submit(key, func() {
+			started <- struct{}{}
+			<-release
+		}, wg.Done)
+	}
+
+	for range 2 {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tasks for different keys did not run in parallel")
+		}
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestPoolCoalesces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewPool()
+
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	var runs atomic.Int32
+
+	// The running task keeps the coalesced tasks waiting
+	wg.Add(1)
+	p.Submit("worker-1", func() {
+		<-block
+	}, wg.Done)
+
+	wg.Add(1)
+	if !p.SubmitCoalesced("worker-1", func() { runs.Add(1) }, wg.Done) {
+		t.Fatal("first coalesced task was not queued")
+	}
+	// The folded task is done straight away
+	wg.Add(1)
+	if p.SubmitCoalesced("worker-1", func() { runs.Add(1) }, wg.Done) {
+		t.Fatal("second coalesced task was queued while the first was waiting")
+	}
+
+	go p.Run(ctx, 1)
+	close(block)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("got %d coalesced runs, want 1", runs.Load())
+	}
+
+	// Once the coalesced task has run a new one is queued again
+	wg.Add(1)
+	if !p.SubmitCoalesced("worker-1", func() {}, wg.Done) {
+		t.Error("coalesced task was not queued after the waiting task ran")
+	}
+	wg.Wait()
+}
+
+func TestPoolDropsWaitingTasks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := NewPool()
+
+	started := make(chan struct{})
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	var runs atomic.Int32
+
+	wg.Add(1)
+	p.Submit("worker-1", func() {
+		close(started)
+		<-block
+	}, wg.Done)
+
+	// The tasks waiting behind the running task are never started once the pool stops
+	for _, key := range []string{"worker-1", "worker-1"} {
+		wg.Add(1)
+		p.Submit(key, func() { runs.Add(1) }, wg.Done)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.Run(ctx, 1)
+	}()
+
+	<-started
+	cancel()
+
+	// The running task is released once the pool has stopped, so the tasks behind it are not started
+	for stopping := false; !stopping; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		stopping = p.stopped
+		p.mu.Unlock()
+	}
+	close(block)
+	<-stopped
+
+	// Tasks submitted after the pool stopped are done straight away
+	wg.Add(1)
+	p.Submit("worker-2", func() { runs.Add(1) }, wg.Done)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dropped tasks were not done")
+	}
+
+	if runs.Load() != 0 {
+		t.Errorf("got %d dropped tasks run, want 0", runs.Load())
+	}
+}
@@ -0,0 +1,157 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// FieldManagerPrefix is prepended to the config name to build the field manager used for server-side apply
+const FieldManagerPrefix = "factotum/"
+
+// maxFieldManagerLength is the longest field manager the api server will accept
+const maxFieldManagerLength = 128
+
+// RequestTimeout bounds each request sent to the api server, so a hanging request fails instead of blocking the object
+const RequestTimeout = 30 * time.Second
+
+// factotumConflictPrefix is the start of a conflict message caused by another factotum field manager
+const factotumConflictPrefix = `conflict with "` + FieldManagerPrefix
+
+// FieldManager returns the field manager a config applies with, for example factotum/nodeconfig-sample
+func FieldManager(configName string) string {
+	manager := FieldManagerPrefix + configName
+	if len(manager) > maxFieldManagerLength {
+		manager = manager[:maxFieldManagerLength]
+	}
+	return manager
+}
+
+// FilterMap returns the entries of m whose keys are present in keys
+// It is used to trim a handler mutated object down to the keys a config owns
+func FilterMap(m map[string]string, keys map[string]string) map[string]string {
+	filtered := make(map[string]string)
+	for key := range keys {
+		if value, exists := m[key]; exists {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// Apply uses server-side apply to set the labels, annotations and, for nodes, taints and unschedulable of obj.
+// obj should only contain the fields the field manager wants to own. Any field previously applied
+// by the same field manager that is missing from obj will be removed by the api server.
+// When takeOver is true every conflict is taken over, the config has chosen to adopt keys set by others
+// or is changing keys, taints or the cordon it owns that someone else changed.
+// A node applied with a resource version fails with a conflict if the node has changed since it was read.
+func Apply(ctx context.Context, c kubernetes.Interface, fieldManager string, obj metav1.Object, takeOver bool) (metav1.Object, error) {
+
+	result, err := apply(ctx, c, fieldManager, obj, false)
+
+	// Conflicts with other factotum configs have already been resolved by priority, so anything left is ours to take.
+	// We take ownership when those are the only conflicts, anything else is only taken over when the caller asks.
+	if err != nil && (resolvableConflicts(err) || takeOver && apierrors.IsConflict(err)) {
+		return apply(ctx, c, fieldManager, obj, true)
+	}
+
+	return result, err
+}
+
+func apply(ctx context.Context, c kubernetes.Interface, fieldManager string, obj metav1.Object, force bool) (metav1.Object, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	opts := metav1.ApplyOptions{FieldManager: fieldManager, Force: force}
+
+	switch o := obj.(type) {
+	case *v1.Namespace:
+		ac := applycorev1.Namespace(o.Name).
+			WithLabels(o.Labels).
+			WithAnnotations(o.Annotations)
+		return c.CoreV1().Namespaces().Apply(ctx, ac, opts)
+	case *v1.Node:
+		ac := applycorev1.Node(o.Name).
+			WithLabels(o.Labels).
+			WithAnnotations(o.Annotations)
+		if o.ResourceVersion != "" {
+			ac.WithResourceVersion(o.ResourceVersion)
+		}
+		if o.Spec.Taints != nil || o.Spec.Unschedulable {
+			spec := applycorev1.NodeSpec()
+			if o.Spec.Taints != nil {
+				spec.WithTaints(TaintApplyConfigurations(o.Spec.Taints)...)
+			}
+			// Unschedulable is only applied when set, dropping it releases ownership so the node is uncordoned
+			if o.Spec.Unschedulable {
+				spec.WithUnschedulable(true)
+			}
+			ac.WithSpec(spec)
+		}
+		return c.CoreV1().Nodes().Apply(ctx, ac, opts)
+	default:
+		return nil, fmt.Errorf("unsupported object type")
+	}
+}
+
+// TaintApplyConfigurations converts taints to their apply configuration
+func TaintApplyConfigurations(taints []v1.Taint) []*applycorev1.TaintApplyConfiguration {
+	configs := make([]*applycorev1.TaintApplyConfiguration, 0, len(taints))
+	for _, taint := range taints {
+		ac := applycorev1.Taint().
+			WithKey(taint.Key).
+			WithValue(taint.Value).
+			WithEffect(taint.Effect)
+		if taint.TimeAdded != nil {
+			ac.WithTimeAdded(*taint.TimeAdded)
+		}
+		configs = append(configs, ac)
+	}
+	return configs
+}
+
+// resolvableConflicts returns true if err is an apply conflict where every conflict is with another factotum field manager
+func resolvableConflicts(err error) bool {
+	var statusErr *apierrors.StatusError
+	if !apierrors.IsConflict(err) || !errors.As(err, &statusErr) {
+		return false
+	}
+
+	details := statusErr.Status().Details
+	if details == nil || len(details.Causes) == 0 {
+		return false
+	}
+
+	for _, cause := range details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			return false
+		}
+
+		if !strings.HasPrefix(cause.Message, factotumConflictPrefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Retriable returns true if err is an api error that may succeed when the request is sent again,
+// such as a conflict, throttling, a webhook or api server timeout or a request that reached RequestTimeout
+func Retriable(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) ||
+		apierrors.IsConflict(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err)
+}
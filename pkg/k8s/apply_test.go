@@ -0,0 +1,182 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFieldManager(t *testing.T) {
+	if got := FieldManager("nodeconfig-sample"); got != "factotum/nodeconfig-sample" {
+		t.Errorf("expected factotum/nodeconfig-sample, got %s", got)
+	}
+
+	if got := FieldManager(strings.Repeat("a", 200)); len(got) != maxFieldManagerLength {
+		t.Errorf("expected field manager to be truncated to %d, got %d", maxFieldManagerLength, len(got))
+	}
+}
+
+func TestFilterMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        map[string]string
+		keys     map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "Keep owned keys",
+			m:        map[string]string{"key1": "value1", "key2": "value2"},
+			keys:     map[string]string{"key1": "value1"},
+			expected: map[string]string{"key1": "value1"},
+		},
+		{
+			name:     "Missing keys are not applied",
+			m:        map[string]string{"key1": "value1"},
+			keys:     map[string]string{"key1": "value1", "key2": "value2"},
+			expected: map[string]string{"key1": "value1"},
+		},
+		{
+			name:     "Nil map",
+			m:        nil,
+			keys:     map[string]string{"key1": "value1"},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterMap(tt.m, tt.keys); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected map to be %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestResolvableConflicts(t *testing.T) {
+	conflictWith := func(manager string, fields ...string) error {
+		causes := []metav1.StatusCause{}
+		for _, field := range fields {
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: fmt.Sprintf("conflict with %q", manager),
+				Field:   field,
+			})
+		}
+		return apierrors.NewApplyConflict(causes, "conflict")
+	}
+
+	conflict := func(fields ...string) error {
+		return conflictWith("kubelet", fields...)
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "Taint conflict",
+			err:      conflict(".spec.taints"),
+			expected: false,
+		},
+		{
+			name:     "Unschedulable conflict",
+			err:      conflictWith("kubectl-cordon", ".spec.unschedulable"),
+			expected: false,
+		},
+		{
+			name:     "Label conflict",
+			err:      conflict(".metadata.labels.key1"),
+			expected: false,
+		},
+		{
+			name:     "Taint and label conflict",
+			err:      conflict(".spec.taints", ".metadata.labels.key1"),
+			expected: false,
+		},
+		{
+			name:     "Conflict with another factotum config",
+			err:      conflictWith("factotum/other-config", ".metadata.labels.key1"),
+			expected: true,
+		},
+		{
+			name:     "Taint conflict with another factotum config",
+			err:      conflictWith("factotum/other-config", ".spec.taints"),
+			expected: true,
+		},
+		{
+			name:     "Not a conflict",
+			err:      apierrors.NewBadRequest("bad request"),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolvableConflicts(tt.err); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAppliedKeys(t *testing.T) {
+	node := &metav1.ObjectMeta{
+		ManagedFields: []metav1.ManagedFieldsEntry{
+			{
+				Manager:   "factotum/config-a",
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:team":{}},"f:annotations":{"f:note":{}}},"f:spec":{"f:taints":{}}}`)},
+			},
+			{
+				Manager:   "kubelet",
+				Operation: metav1.ManagedFieldsOperationUpdate,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:zone":{}}}}`)},
+			},
+		},
+	}
+
+	labels, annotations, taints := AppliedKeys(node, "factotum/config-a")
+
+	if !reflect.DeepEqual(labels, map[string]bool{"team": true}) {
+		t.Errorf("expected only the applied label, got %v", labels)
+	}
+	if !reflect.DeepEqual(annotations, map[string]bool{"note": true}) {
+		t.Errorf("expected only the applied annotation, got %v", annotations)
+	}
+	if !taints {
+		t.Errorf("expected the taint list to be applied")
+	}
+}
+
+func TestRetriable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Conflict", err: apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("conflict")), expected: true},
+		{name: "Throttled", err: apierrors.NewTooManyRequests("slow down", 1), expected: true},
+		{name: "Webhook timeout", err: apierrors.NewInternalError(errors.New("failed calling webhook: context deadline exceeded")), expected: true},
+		{name: "Joined with a handler error", err: errors.Join(errors.New("template failed"), apierrors.NewServiceUnavailable("unavailable")), expected: true},
+		{name: "Request timeout", err: fmt.Errorf("apply: %w", context.DeadlineExceeded), expected: true},
+		{name: "Shutting down", err: context.Canceled, expected: false},
+		{name: "Forbidden", err: apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("forbidden")), expected: false},
+		{name: "Handler error", err: errors.New("template failed"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retriable(tt.err); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
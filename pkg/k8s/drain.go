@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// mirrorPodAnnotation is set on static pods mirrored by the kubelet, they cannot be evicted
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// EvictionResult is the outcome of a single eviction pass over a node
+type EvictionResult struct {
+	// Remaining is the number of pods still on the node that need to be evicted, including terminating pods
+	Remaining int
+	// Blocked is the number of pods whose eviction was refused, usually by a PodDisruptionBudget
+	Blocked int
+}
+
+// EvictPods requests eviction of every pod on nodeName that should be drained.
+// Evictions go through the Eviction API so PodDisruptionBudgets are honored. DaemonSet, mirror and completed pods are skipped.
+// gracePeriodSeconds overrides the pod termination grace period when it is not nil.
+func EvictPods(ctx context.Context, c kubernetes.Interface, nodeName string, gracePeriodSeconds *int64) (EvictionResult, error) {
+	var result EvictionResult
+
+	listCtx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	pods, err := c.CoreV1().Pods(metav1.NamespaceAll).List(listCtx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	for _, pod := range pods.Items {
+		if !Evictable(&pod) {
+			continue
+		}
+
+		result.Remaining++
+
+		// Pods already terminating only need to finish
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		eviction := &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			DeleteOptions: &metav1.DeleteOptions{
+				GracePeriodSeconds: gracePeriodSeconds,
+			},
+		}
+
+		err := evict(ctx, c, eviction)
+		switch {
+		case err == nil:
+		case apierrors.IsNotFound(err):
+			result.Remaining--
+		case apierrors.IsTooManyRequests(err):
+			// The eviction would violate a PodDisruptionBudget, it will be retried on the next pass
+			result.Blocked++
+		default:
+			return result, fmt.Errorf("failed to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// evict sends a single eviction, bounded by RequestTimeout
+func evict(ctx context.Context, c kubernetes.Interface, eviction *policyv1.Eviction) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	return c.CoreV1().Pods(eviction.Namespace).EvictV1(ctx, eviction)
+}
+
+// Evictable returns true if the pod should be evicted when its node is drained
+func Evictable(pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+
+	if _, mirror := pod.Annotations[mirrorPodAnnotation]; mirror {
+		return false
+	}
+
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvictable(t *testing.T) {
+	controller := true
+
+	tests := []struct {
+		name     string
+		pod      *v1.Pod
+		expected bool
+	}{
+		{
+			name:     "Running pod",
+			pod:      &v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}},
+			expected: true,
+		},
+		{
+			name:     "Completed pod",
+			pod:      &v1.Pod{Status: v1.PodStatus{Phase: v1.PodSucceeded}},
+			expected: false,
+		},
+		{
+			name: "Mirror pod",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{mirrorPodAnnotation: "hash"}},
+			},
+			expected: false,
+		},
+		{
+			name: "DaemonSet pod",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+					{Kind: "DaemonSet", Name: "ds", Controller: &controller},
+				}},
+			},
+			expected: false,
+		},
+		{
+			name: "ReplicaSet pod",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+					{Kind: "ReplicaSet", Name: "rs", Controller: &controller},
+				}},
+			},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Evictable(tt.pod); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
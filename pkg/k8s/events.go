@@ -0,0 +1,20 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ObjectReference returns the reference events about obj are recorded against
+// Node events use the node name as the UID, like the kubelet, so they are shown with the kubelet events
+func ObjectReference(obj metav1.Object) *v1.ObjectReference {
+	switch obj.(type) {
+	case *v1.Node:
+		return &v1.ObjectReference{APIVersion: "v1", Kind: "Node", Name: obj.GetName(), UID: types.UID(obj.GetName())}
+	case *v1.Namespace:
+		return &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: obj.GetName(), UID: obj.GetUID()}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,24 @@
+package k8s
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestObjectReference(t *testing.T) {
+	node := ObjectReference(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", UID: "1234"}})
+	if node.Kind != "Node" || string(node.UID) != "worker-1" {
+		t.Errorf("expected node events to use the node name as the uid, got %+v", node)
+	}
+
+	ns := ObjectReference(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", UID: "5678"}})
+	if ns.Kind != "Namespace" || ns.UID != "5678" {
+		t.Errorf("expected namespace events to use the namespace uid, got %+v", ns)
+	}
+
+	if ObjectReference(&v1.Pod{}) != nil {
+		t.Errorf("expected no reference for unsupported objects")
+	}
+}
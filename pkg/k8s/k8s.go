@@ -6,19 +6,14 @@ import (
 	"fmt"
 	"log"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 
-	"encoding/json"
-
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	"k8s.io/apimachinery/pkg/types"
-
-	"k8s.io/apimachinery/pkg/util/strategicpatch"
 )
 
 func GetConfig() *rest.Config {
@@ -54,6 +49,15 @@ func NewK8sClient() *kubernetes.Clientset {
 	return clientset
 }
 
+// NewDynamicClient returns a dynamic client, it is used for objects whose type is only known at runtime
+func NewDynamicClient() *dynamic.DynamicClient {
+	client, err := dynamic.NewForConfig(GetConfig())
+	if err != nil {
+		log.Fatalf("Error creating dynamic client: %v", err)
+	}
+	return client
+}
+
 func GetClientset(c *rest.Config) (*kubernetes.Clientset, error) {
 	clientset, err := kubernetes.NewForConfig(c)
 	if err != nil {
@@ -62,38 +66,17 @@ func GetClientset(c *rest.Config) (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-func GetNodes(c *kubernetes.Clientset) (*v1.NodeList, error) {
-	return c.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
-}
-
-func StrategicMerge(c *kubernetes.Clientset, original metav1.Object, modified metav1.Object) (metav1.Object, error) {
-	// Use the appropriate client to apply the patch based on the object's type
-	// This example assumes the object is a Namespace, but you should handle other types as needed
-
-	originalJSON, err := json.Marshal(original)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal original object: %w", err)
-	}
+func GetNodes(ctx context.Context, c kubernetes.Interface) (*v1.NodeList, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
 
-	modifiedJSON, err := json.Marshal(modified)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal modified object: %w", err)
-	}
+	return c.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+}
 
-	patchBytes, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, original)
+// GetNode reads the named node from the api server rather than a cache
+func GetNode(ctx context.Context, c kubernetes.Interface, name string) (*v1.Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
 
-	switch obj := original.(type) {
-	case *v1.Namespace:
-		if err != nil {
-			return nil, fmt.Errorf("failed to create strategic merge patch: %w", err)
-		}
-		return c.CoreV1().Namespaces().Patch(context.TODO(), obj.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
-	case *v1.Node:
-		if err != nil {
-			return nil, fmt.Errorf("failed to create strategic merge patch: %w", err)
-		}
-		return c.CoreV1().Nodes().Patch(context.TODO(), obj.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
-	default:
-		return nil, fmt.Errorf("unsupported object type")
-	}
+	return c.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
 }
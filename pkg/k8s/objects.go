@@ -0,0 +1,197 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+// ToUnstructured converts a typed object to the unstructured form applied with the dynamic client
+// The status and creation timestamp are dropped, they are never applied
+func ToUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	unstructured.RemoveNestedField(u.Object, "status")
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+
+	return u, nil
+}
+
+// resource returns the dynamic client for the namespaced resource of gvk
+func resource(c dynamic.Interface, mapper meta.RESTMapper, gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return nil, fmt.Errorf("%s is not a namespaced kind", gvk.Kind)
+	}
+
+	return c.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// immutableFields are the fields of a kind that cannot be changed once an object exists
+var immutableFields = map[schema.GroupKind][]string{
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}: {"roleRef"},
+}
+
+// immutableChanged returns true if obj sets an immutable field of its kind to a different value than existing
+func immutableChanged(existing, obj *unstructured.Unstructured) bool {
+	for _, field := range immutableFields[obj.GroupVersionKind().GroupKind()] {
+		current, _, _ := unstructured.NestedFieldNoCopy(existing.Object, field)
+		desired, _, _ := unstructured.NestedFieldNoCopy(obj.Object, field)
+		if !equality.Semantic.DeepEqual(current, desired) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnmanagedObject is returned by ApplyObject when an object with the same name exists that was not created by the config
+var ErrUnmanagedObject = errors.New("object exists and is not managed by the config")
+
+// ApplyObject uses server-side apply to create or update obj, an object created by the named config.
+// The config owns the whole object, so fields another manager has changed are taken back.
+// An object with the same name that the config did not create is only taken over when adopt is true,
+// otherwise ErrUnmanagedObject is returned and the object is left alone.
+// An object whose immutable fields differ from obj, such as the roleRef of a RoleBinding, is deleted and created again.
+func ApplyObject(ctx context.Context, c dynamic.Interface, mapper meta.RESTMapper, fieldManager, configName string, obj *unstructured.Unstructured, adopt bool) error {
+	client, err := resource(c, mapper, obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	existing, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	// An object created since the get conflicts with the apply unless it already matches obj
+	force := adopt
+	if err == nil {
+		if !adopt && !config.ManagedByConfig(existing.GetAnnotations(), configName) {
+			return ErrUnmanagedObject
+		}
+		force = true
+
+		if immutableChanged(existing, obj) {
+			// The precondition stops an object recreated since the get from being deleted
+			uid := existing.GetUID()
+			err = client.Delete(ctx, obj.GetName(), metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			force = adopt
+		}
+	}
+
+	_, err = client.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: force})
+	return err
+}
+
+// GetObject reads the named object of kind gvk in namespace
+func GetObject(ctx context.Context, c dynamic.Interface, mapper meta.RESTMapper, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	client, err := resource(c, mapper, gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	return client.Get(ctx, name, metav1.GetOptions{})
+}
+
+// ObjectDifferences returns the top level fields of desired, such as spec or data, that current does not match.
+// current may hold fields desired does not set, such as defaults set by the api server, they are ignored.
+func ObjectDifferences(current, desired *unstructured.Unstructured) []string {
+	var differences []string
+
+	for _, field := range slices.Sorted(maps.Keys(desired.Object)) {
+		if !containsValue(current.Object[field], desired.Object[field]) {
+			differences = append(differences, field)
+		}
+	}
+
+	return differences
+}
+
+// containsValue returns true if current holds every field of desired with the same value
+func containsValue(current, desired any) bool {
+	switch d := desired.(type) {
+	case map[string]any:
+		c, _ := current.(map[string]any)
+		for key, value := range d {
+			if !containsValue(c[key], value) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		c, _ := current.([]any)
+		if len(c) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !containsValue(c[i], d[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return equality.Semantic.DeepEqual(current, desired)
+	}
+}
+
+// DeleteObject deletes the named object if it was created by the named config.
+// An object that no longer exists or that is not annotated with the config is left alone.
+func DeleteObject(ctx context.Context, c dynamic.Interface, mapper meta.RESTMapper, gvk schema.GroupVersionKind, namespace, name, configName string) error {
+	client, err := resource(c, mapper, gvk, namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	obj, err := client.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !config.ManagedByConfig(obj.GetAnnotations(), configName) {
+		return nil
+	}
+
+	// The precondition stops an object recreated since the get from being deleted
+	uid := obj.GetUID()
+	err = client.Delete(ctx, name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/rjbrown57/factotum/pkg/factotum/config"
+)
+
+var quotaGVK = schema.GroupVersionKind{Version: "v1", Kind: "ResourceQuota"}
+
+func quota(name, configName string) *v1.ResourceQuota {
+	return &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "team-a",
+			Annotations: map[string]string{config.ManagedConfigAnnotation: configName},
+		},
+	}
+}
+
+func TestDeleteObject(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(quotaGVK, meta.RESTScopeNamespace)
+
+	c := dynamicfake.NewSimpleDynamicClient(scheme, quota("ours", "team-quotas"), quota("theirs", "other-config"))
+	quotas := c.Resource(v1.SchemeGroupVersion.WithResource("resourcequotas")).Namespace("team-a")
+
+	tests := []struct {
+		name    string
+		deleted bool
+	}{
+		{name: "ours", deleted: true},
+		{name: "theirs", deleted: false},
+		// A quota that has already been deleted is not an error
+		{name: "missing", deleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DeleteObject(context.Background(), c, mapper, quotaGVK, "team-a", tt.name, "team-quotas"); err != nil {
+				t.Fatalf("DeleteObject() error = %v", err)
+			}
+
+			_, err := quotas.Get(context.Background(), tt.name, metav1.GetOptions{})
+			if deleted := apierrors.IsNotFound(err); deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestToUnstructured(t *testing.T) {
+	q := quota("ours", "team-quotas")
+	q.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"}
+
+	u, err := ToUnstructured(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.GroupVersionKind() != quotaGVK || u.GetName() != "ours" || u.GetNamespace() != "team-a" {
+		t.Errorf("got %s %s/%s, want the quota", u.GroupVersionKind(), u.GetNamespace(), u.GetName())
+	}
+	if _, exists := u.Object["status"]; exists {
+		t.Errorf("status was not dropped")
+	}
+}
+
+func TestApplyObjectRoleRef(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rbacv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	gvk := rbacv1.SchemeGroupVersion.WithKind("RoleBinding")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+
+	binding := func(role string) *rbacv1.RoleBinding {
+		return &rbacv1.RoleBinding{
+			TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "team-admins",
+				Namespace:   "team-a",
+				Annotations: map[string]string{config.ManagedConfigAnnotation: "team-rbac"},
+			},
+			RoleRef: rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: role},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		role    string
+		deleted bool
+	}{
+		{name: "Same roleRef is applied", role: "admin", deleted: false},
+		{name: "Changed roleRef is created again", role: "edit", deleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dynamicfake.NewSimpleDynamicClient(scheme, binding("admin"))
+
+			obj, err := ToUnstructured(binding(tt.role))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The fake client cannot apply unstructured objects, the apply is answered with obj instead
+			c.PrependReactor("patch", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, obj, nil
+			})
+
+			if err := ApplyObject(context.Background(), c, mapper, "factotum/team-rbac", "team-rbac", obj, false); err != nil {
+				t.Fatal(err)
+			}
+
+			deletes := 0
+			for _, action := range c.Actions() {
+				if action.GetVerb() == "delete" {
+					deletes++
+				}
+			}
+
+			if deleted := deletes == 1; deleted != tt.deleted {
+				t.Errorf("got %d deletes, want the binding deleted %v", deletes, tt.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RestoreFieldManager is the field manager used to set released keys back to their previous value.
+// It is not a factotum/ field manager so restored values are treated like any other pre-existing value.
+const RestoreFieldManager = "factotum-restore"
+
+// AppliedKeys returns the labels and annotations fieldManager has applied to obj and whether it has applied the node taint list.
+// It is used to recognise keys a config set before ownership records were kept.
+func AppliedKeys(obj metav1.Object, fieldManager string) (map[string]bool, map[string]bool, bool) {
+	labels := make(map[string]bool)
+	annotations := make(map[string]bool)
+	taints := false
+
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields struct {
+			Metadata struct {
+				Labels      map[string]json.RawMessage `json:"f:labels"`
+				Annotations map[string]json.RawMessage `json:"f:annotations"`
+			} `json:"f:metadata"`
+			Spec struct {
+				Taints json.RawMessage `json:"f:taints"`
+			} `json:"f:spec"`
+		}
+
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+
+		for key := range fields.Metadata.Labels {
+			labels[strings.TrimPrefix(key, "f:")] = true
+		}
+		for key := range fields.Metadata.Annotations {
+			annotations[strings.TrimPrefix(key, "f:")] = true
+		}
+		taints = taints || fields.Spec.Taints != nil
+	}
+
+	return labels, annotations, taints
+}
+
+// Restore sets labels and annotations of obj back to the values a config replaced.
+// The values are written with RestoreFieldManager so they are kept when the config stops applying the keys.
+func Restore(ctx context.Context, c kubernetes.Interface, obj metav1.Object, labels, annotations map[string]string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+
+	// A null map in a merge patch clears it, so only non empty maps are sent
+	metadata := make(map[string]any)
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	opts := metav1.PatchOptions{FieldManager: RestoreFieldManager}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	switch o := obj.(type) {
+	case *v1.Namespace:
+		_, err = c.CoreV1().Namespaces().Patch(ctx, o.Name, types.MergePatchType, patch, opts)
+	case *v1.Node:
+		_, err = c.CoreV1().Nodes().Patch(ctx, o.Name, types.MergePatchType, patch, opts)
+	default:
+		err = fmt.Errorf("unsupported object type")
+	}
+
+	return err
+}